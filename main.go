@@ -31,7 +31,7 @@ func adder(verbose bool) {
 	}
 	// n := NaiveTraining([]int{2, 1}, data, 0.01, 20000)
 	n := nn.NewMLP([]int32{2, 1}, nn.Sigmoid{}, nn.NoActF{}, 1.0)
-	n.TrainConcurrent(data, 2000, 1.0, 0.01, 0, 0, verbose)
+	n.TrainConcurrent(data, nil, 2000, nn.NewInverseTimeDecay(1.0, 0.01), 0, 0, verbose)
 	testNN(n, data)
 }
 
@@ -46,7 +46,7 @@ func and(verbose bool) {
 	}
 	// n := NaiveTraining([]int{2, 1}, data, 0.01, 200000)
 	n := nn.NewMLP([]int32{2, 1}, nn.Sigmoid{}, nn.Sigmoid{}, 1.0)
-	n.TrainConcurrent(data, 5000, 0.5, 1e-4, 0, 0, verbose)
+	n.TrainConcurrent(data, nil, 5000, nn.NewInverseTimeDecay(0.5, 1e-4), 0, 0, verbose)
 
 	testNN(n, data)
 }
@@ -62,7 +62,7 @@ func xor(verbose bool) {
 	}
 
 	n := nn.NewMLP([]int32{2, 2, 1}, nn.Sigmoid{}, nn.NoActF{}, 1.0)
-	n.TrainConcurrent(data, 5000, 0.5, 1e-4, 0, 0, verbose)
+	n.TrainConcurrent(data, nil, 5000, nn.NewInverseTimeDecay(0.5, 1e-4), 0, 0, verbose)
 	testNN(n, data)
 }
 
@@ -27,7 +27,7 @@ var LabelVectors = map[byte]*t.Tensor{
 }
 
 func main() {
-	// Example of using a MLP to learn the mnist digit recognition dataset
+	// Example of using a MLP or a small CNN to learn the mnist digit recognition dataset
 	// The dataset contains 60000 handwriten digits from 0 to 9 in 28*28 grayscale images
 
 	// Downloaded from:
@@ -37,17 +37,15 @@ func main() {
 	// https://storage.googleapis.com/cvdf-datasets/mnist/t10k-labels-idx1-ubyte.gz
 
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [train|run]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [train|cnn|run]\n", os.Args[0])
 		os.Exit(1)
 	}
 	switch os.Args[1] {
 	case "t", "train":
-		model := train()
-		err := model.SaveToFile("mnist.nn")
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error saving model: %s\n", err.Error())
-		}
-		run(model)
+		trainAndSave(newMLP(), 10, "mnist.nn")
+
+	case "c", "cnn":
+		trainAndSave(newCNN(), 3, "mnist_cnn.nn")
 
 	case "r", "run":
 		if len(os.Args) != 3 {
@@ -64,12 +62,68 @@ func main() {
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
-		fmt.Fprintf(os.Stderr, "Usage: %s [train|run]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [train|cnn|run]\n", os.Args[0])
 		os.Exit(1)
 	}
 }
 
-func train() *nn.NeuralNetwork {
+func trainAndSave(model *nn.NeuralNetwork, epochs int, path string) {
+	// Turn the outputs into the probability of the image being each digit.
+	model.Layers = append(model.Layers, nn.NewSoftmaxLayer())
+	model.Loss = nn.CategoricalCrossEntropy{}
+	model.Metadata().SetLabels("0", "1", "2", "3", "4", "5", "6", "7", "8", "9")
+	model.Metadata()[nn.MetadataInputNormalization] = "pixel / 256"
+
+	train(model, epochs)
+	err := model.SaveToFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving model: %s\n", err.Error())
+	}
+	run(model)
+}
+
+func newMLP() *nn.NeuralNetwork {
+	model := nn.NewMLP([]int32{
+		ImageSize * ImageSize, // Input pixels
+		256,
+		256,
+		10, // Outputs
+	}, nn.Sigmoid{}, nn.NoActF{}, 1.0)
+	model.Metadata().SetInputShape(ImageSize * ImageSize)
+	return model
+}
+
+// newCNN creates two convolution and pooling stages followed by a fully
+// connected layer, which sees the images as (1 x 28 x 28) tensors. Like the
+// MLP, trainAndSave adds the softmax and cross-entropy loss.
+func newCNN() *nn.NeuralNetwork {
+	model := &nn.NeuralNetwork{
+		Layers: []nn.Layer{
+			nn.NewConv2DLayer(1, 8, 3, 1, 1, 1, nn.ReLU{}),  // 8 x 28 x 28
+			nn.NewMaxPool2DLayer(2, 2, 0),                   // 8 x 14 x 14
+			nn.NewConv2DLayer(8, 16, 3, 1, 1, 1, nn.ReLU{}), // 16 x 14 x 14
+			nn.NewMaxPool2DLayer(2, 2, 0),                   // 16 x 7 x 7
+			nn.NewFlattenLayer(),
+			nn.NewFullyConnectedLayer(16*7*7, 10, nn.NoActF{}),
+		},
+		GradientClippingLimit: 1.0,
+		Optimizer:             nn.NewSGD(0, false),
+	}
+	model.Metadata().SetInputShape(1, ImageSize, ImageSize)
+	return model
+}
+
+// imageShape is the shape the model takes each image in.
+func imageShape(model *nn.NeuralNetwork) []int32 {
+	shape, ok := model.Metadata().InputShape()
+	if !ok {
+		// Saved before the shape was recorded, only the MLP was.
+		return []int32{ImageSize * ImageSize}
+	}
+	return shape
+}
+
+func train(model *nn.NeuralNetwork, epochs int) {
 	// Build training data
 	trainSamples := 50000
 	trainImgs := readImgs("./train-images.idx3-ubyte", trainSamples)
@@ -78,22 +132,13 @@ func train() *nn.NeuralNetwork {
 	trainData := make([]nn.Sample, trainSamples)
 	for i := range trainData {
 		trainData[i] = nn.Sample{
-			In:  t.WithData([]int32{ImageSize * ImageSize}, trainImgs[i]),
+			In:  t.WithData(imageShape(model), trainImgs[i]),
 			Out: LabelVectors[trainLabels[i]],
 		}
 	}
 
-	model := nn.NewMLP([]int32{
-		ImageSize * ImageSize, // Input pixels
-		256,
-		256,
-		10, // Outputs
-	}, nn.Sigmoid{}, nn.Sigmoid{}, 1.0)
-
 	fmt.Println("Starting Training")
-	model.TrainConcurrent(trainData, 10, 0.25, 0.1, 32, 0, true)
-
-	return model
+	model.TrainConcurrent(trainData, nil, epochs, nn.NewInverseTimeDecay(0.25, 0.1), 32, 0, true)
 }
 
 func run(model *nn.NeuralNetwork) {
@@ -104,7 +149,7 @@ func run(model *nn.NeuralNetwork) {
 	testData := make([]nn.Sample, testSamples)
 	for i := range testData {
 		testData[i] = nn.Sample{
-			In:  t.WithData([]int32{ImageSize * ImageSize}, testImgs[i]),
+			In:  t.WithData(imageShape(model), testImgs[i]),
 			Out: LabelVectors[testLabels[i]],
 		}
 	}
@@ -116,7 +161,7 @@ func run(model *nn.NeuralNetwork) {
 	correctGuesses := 0
 	for _, s := range testData {
 		forward, _ := model.Forward(s.In)
-		if maxIndex(forward.Data) == maxIndex(s.Out.Data) {
+		if predictedDigit(forward) == predictedDigit(s.Out) {
 			correctGuesses++
 		}
 	}
@@ -130,7 +175,7 @@ func run(model *nn.NeuralNetwork) {
 		fmt.Println("Digit: ")
 		printDigit(s.In.Data)
 		actual, _ := model.Forward(s.In)
-		fmt.Println("Expected: ", maxIndex(s.Out.Data), " - Model's guess: ", maxIndex(actual.Data))
+		fmt.Println("Expected: ", predictedDigit(s.Out), " - Model's guess: ", predictedDigit(actual))
 	}
 }
 
@@ -203,16 +248,9 @@ func randomSubset[T any](ts []T, n int) []T {
 	return subset
 }
 
-func maxIndex(values []float64) int {
-	highestIndex := 0
-	highestVal := float64(0)
-	for i := range values {
-		if values[i] > highestVal {
-			highestIndex = i
-			highestVal = values[i]
-		}
-	}
-	return highestIndex
+// predictedDigit returns the digit with the highest output.
+func predictedDigit(output *t.Tensor) int {
+	return int(output.ArgMax(0, false).Data[0])
 }
 
 func must[T any](t T, err error) T {
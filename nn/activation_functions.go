@@ -2,8 +2,6 @@ package nn
 
 import (
 	"encoding/binary"
-	"errors"
-	"fmt"
 	"io"
 	"math"
 )
@@ -16,42 +14,121 @@ const (
 	RELU activationFunctionType = iota
 	SIGMOID
 	NO_ACT_F
+	TANH
+	LEAKY_RELU
+	ELU_ACT_F
+	SELU_ACT_F
+	GELU_ACT_F
+	GELU_TANH
+	SOFTPLUS
+	SWISH
+	SILU
+	MISH
+	HARD_SIGMOID
+
+	CUSTOM_ACT_F activationFunctionType = 255 // Followed by the name
 )
 
 type ActivationFunction interface {
 	Apply(v float64) float64
 	Derivative(v float64) float64
-	actFType() activationFunctionType
+
+	// TypeName identifies the function in saved models. Functions defined
+	// outside this package must register it with RegisterActivation.
+	TypeName() string
+}
+
+// SavableActivation is implemented by activation functions with parameters,
+// which are saved right after their type for their loader to read back.
+type SavableActivation interface {
+	ActivationFunction
+	Save(w io.Writer) error
+}
+
+// Built-in functions are saved as a single byte, like older files did.
+var builtinActivations = []string{
+	RELU:         "ReLU",
+	SIGMOID:      "Sigmoid",
+	NO_ACT_F:     "NoActF",
+	TANH:         "Tanh",
+	LEAKY_RELU:   "LeakyReLU",
+	ELU_ACT_F:    "ELU",
+	SELU_ACT_F:   "SELU",
+	GELU_ACT_F:   "GELU",
+	GELU_TANH:    "GELUTanh",
+	SOFTPLUS:     "Softplus",
+	SWISH:        "Swish",
+	SILU:         "SiLU",
+	MISH:         "Mish",
+	HARD_SIGMOID: "HardSigmoid",
+}
+
+func init() {
+	for _, actF := range []ActivationFunction{
+		ReLU{}, Sigmoid{}, NoActF{}, Tanh{}, SELU{}, GELU{}, GELU{Approximate: true},
+		Softplus{}, SiLU{}, Mish{}, HardSigmoid{},
+	} {
+		RegisterActivation(actF.TypeName(), func(io.Reader) (ActivationFunction, error) {
+			return actF, nil
+		})
+	}
+
+	// All the parameterized ones have a single parameter.
+	RegisterActivation("LeakyReLU", func(r io.Reader) (ActivationFunction, error) {
+		slope, err := readFloat64(r)
+		return LeakyReLU{Slope: slope}, err
+	})
+	RegisterActivation("ELU", func(r io.Reader) (ActivationFunction, error) {
+		alpha, err := readFloat64(r)
+		return ELU{Alpha: alpha}, err
+	})
+	RegisterActivation("Swish", func(r io.Reader) (ActivationFunction, error) {
+		beta, err := readFloat64(r)
+		return Swish{Beta: beta}, err
+	})
+}
+
+// SaveActivation writes the function's type and parameters. Layers
+// defined outside this package can use it to save their activation.
+func SaveActivation(w io.Writer, actF ActivationFunction) error {
+	err := writeTypeName(w, actF.TypeName(), builtinActivations, CUSTOM_ACT_F)
+	if err != nil {
+		return err
+	}
+	if s, ok := actF.(SavableActivation); ok {
+		return s.Save(w)
+	}
+	return nil
 }
 
-func loadActF(r io.Reader) (ActivationFunction, error) {
-	// Read type
-	var t activationFunctionType
-	err := binary.Read(r, binary.LittleEndian, &t)
+// LoadActivation reads a function written by SaveActivation, using the
+// loader registered for its type.
+func LoadActivation(r io.Reader) (ActivationFunction, error) {
+	name, err := readTypeName(r, builtinActivations, CUSTOM_ACT_F, "activation function")
 	if err != nil {
 		return nil, err
 	}
 
-	switch activationFunctionType(t) {
-	case RELU:
-		return ReLU{}, nil
-	case SIGMOID:
-		return Sigmoid{}, nil
-	case NO_ACT_F:
-		return NoActF{}, nil
-	default:
-		return nil, errors.New(
-			fmt.Sprint("Invalid activation function type found: ", t),
-		)
+	registryLock.RLock()
+	loader, ok := activationLoaders[name]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, formatError("Unregistered activation function type found: ", name)
 	}
+	return loader(r)
+}
 
+func readFloat64(r io.Reader) (float64, error) {
+	var v float64
+	err := binary.Read(r, binary.LittleEndian, &v)
+	return v, err
 }
 
 type ReLU struct{}
 
 var _ ActivationFunction = ReLU{}
 
-func (ReLU) actFType() activationFunctionType { return RELU }
+func (ReLU) TypeName() string { return "ReLU" }
 
 func (ReLU) Apply(v float64) float64 {
 	return max(0, v)
@@ -68,7 +145,7 @@ type Sigmoid struct{}
 
 var _ ActivationFunction = Sigmoid{}
 
-func (Sigmoid) actFType() activationFunctionType { return SIGMOID }
+func (Sigmoid) TypeName() string { return "Sigmoid" }
 
 func (Sigmoid) Apply(v float64) float64 {
 	return 1.0 / (1.0 + math.Exp(-v))
@@ -84,7 +161,7 @@ type NoActF struct{}
 
 var _ ActivationFunction = NoActF{}
 
-func (NoActF) actFType() activationFunctionType { return NO_ACT_F }
+func (NoActF) TypeName() string { return "NoActF" }
 
 func (NoActF) Apply(v float64) float64 {
 	return v
@@ -93,3 +170,209 @@ func (NoActF) Apply(v float64) float64 {
 func (NoActF) Derivative(v float64) float64 {
 	return 1
 }
+
+type Tanh struct{}
+
+var _ ActivationFunction = Tanh{}
+
+func (Tanh) TypeName() string { return "Tanh" }
+
+func (Tanh) Apply(v float64) float64 {
+	return math.Tanh(v)
+}
+
+func (Tanh) Derivative(v float64) float64 {
+	tv := math.Tanh(v)
+	return 1 - tv*tv
+}
+
+// LeakyReLU lets negative values through multiplied by Slope (usually 0.01).
+type LeakyReLU struct{ Slope float64 }
+
+var _ SavableActivation = LeakyReLU{}
+
+func (LeakyReLU) TypeName() string { return "LeakyReLU" }
+
+func (l LeakyReLU) Save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, l.Slope)
+}
+
+func (l LeakyReLU) Apply(v float64) float64 {
+	if v <= 0 {
+		return l.Slope * v
+	}
+	return v
+}
+
+func (l LeakyReLU) Derivative(v float64) float64 {
+	if v <= 0 {
+		return l.Slope
+	}
+	return 1
+}
+
+// ELU smoothly saturates to -Alpha for negative values (usually Alpha is 1).
+type ELU struct{ Alpha float64 }
+
+var _ SavableActivation = ELU{}
+
+func (ELU) TypeName() string { return "ELU" }
+
+func (e ELU) Save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, e.Alpha)
+}
+
+func (e ELU) Apply(v float64) float64 {
+	if v <= 0 {
+		return e.Alpha * math.Expm1(v)
+	}
+	return v
+}
+
+func (e ELU) Derivative(v float64) float64 {
+	if v <= 0 {
+		return e.Alpha * math.Exp(v)
+	}
+	return 1
+}
+
+// SELU is an ELU scaled with the constants that make it self-normalizing.
+type SELU struct{}
+
+var _ ActivationFunction = SELU{}
+
+const (
+	seluAlpha = 1.6732632423543772848170429916717
+	seluScale = 1.0507009873554804934193349852946
+)
+
+func (SELU) TypeName() string { return "SELU" }
+
+func (SELU) Apply(v float64) float64 {
+	return seluScale * ELU{Alpha: seluAlpha}.Apply(v)
+}
+
+func (SELU) Derivative(v float64) float64 {
+	return seluScale * ELU{Alpha: seluAlpha}.Derivative(v)
+}
+
+// GELU weights each value by the probability of a standard normal being
+// smaller. Approximate uses the faster tanh based approximation.
+type GELU struct{ Approximate bool }
+
+var _ ActivationFunction = GELU{}
+
+// sqrt(2/pi), used by the tanh approximation
+const geluTanhScale = 0.7978845608028654
+
+func (g GELU) TypeName() string {
+	if g.Approximate {
+		return "GELUTanh"
+	}
+	return "GELU"
+}
+
+func (g GELU) Apply(v float64) float64 {
+	if g.Approximate {
+		return 0.5 * v * (1 + math.Tanh(geluTanhScale*(v+0.044715*v*v*v)))
+	}
+	return v * normalCDF(v)
+}
+
+func (g GELU) Derivative(v float64) float64 {
+	if g.Approximate {
+		tv := math.Tanh(geluTanhScale * (v + 0.044715*v*v*v))
+		return 0.5*(1+tv) + 0.5*v*(1-tv*tv)*geluTanhScale*(1+3*0.044715*v*v)
+	}
+	// The normal's density is the derivative of its CDF.
+	return normalCDF(v) + v*math.Exp(-v*v/2)/math.Sqrt(2*math.Pi)
+}
+
+func normalCDF(v float64) float64 {
+	return 0.5 * (1 + math.Erf(v/math.Sqrt2))
+}
+
+// Softplus is a smooth ReLU, log(1 + e^v).
+type Softplus struct{}
+
+var _ ActivationFunction = Softplus{}
+
+func (Softplus) TypeName() string { return "Softplus" }
+
+func (Softplus) Apply(v float64) float64 {
+	// Rewritten so exp can't overflow.
+	return max(v, 0) + math.Log1p(math.Exp(-math.Abs(v)))
+}
+
+func (Softplus) Derivative(v float64) float64 {
+	return Sigmoid{}.Apply(v)
+}
+
+// Swish is v * sigmoid(Beta * v). With Beta 1 it's the same as SiLU.
+type Swish struct{ Beta float64 }
+
+var _ SavableActivation = Swish{}
+
+func (Swish) TypeName() string { return "Swish" }
+
+func (s Swish) Save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, s.Beta)
+}
+
+func (s Swish) Apply(v float64) float64 {
+	return v * Sigmoid{}.Apply(s.Beta*v)
+}
+
+func (s Swish) Derivative(v float64) float64 {
+	sv := Sigmoid{}.Apply(s.Beta * v)
+	return sv + s.Beta*v*sv*(1-sv)
+}
+
+// SiLU (Sigmoid Linear Unit) is v * sigmoid(v).
+type SiLU struct{}
+
+var _ ActivationFunction = SiLU{}
+
+func (SiLU) TypeName() string { return "SiLU" }
+
+func (SiLU) Apply(v float64) float64 {
+	return Swish{Beta: 1}.Apply(v)
+}
+
+func (SiLU) Derivative(v float64) float64 {
+	return Swish{Beta: 1}.Derivative(v)
+}
+
+// Mish is v * tanh(softplus(v)).
+type Mish struct{}
+
+var _ ActivationFunction = Mish{}
+
+func (Mish) TypeName() string { return "Mish" }
+
+func (Mish) Apply(v float64) float64 {
+	return v * math.Tanh(Softplus{}.Apply(v))
+}
+
+func (Mish) Derivative(v float64) float64 {
+	tv := math.Tanh(Softplus{}.Apply(v))
+	return tv + v*(1-tv*tv)*Sigmoid{}.Apply(v)
+}
+
+// HardSigmoid is a piecewise linear sigmoid, going from 0 at -3 to 1 at 3.
+type HardSigmoid struct{}
+
+var _ ActivationFunction = HardSigmoid{}
+
+func (HardSigmoid) TypeName() string { return "HardSigmoid" }
+
+func (HardSigmoid) Apply(v float64) float64 {
+	return max(0, min(1, v/6+0.5))
+}
+
+func (HardSigmoid) Derivative(v float64) float64 {
+	if v <= -3 || v >= 3 {
+		return 0
+	}
+	return 1.0 / 6
+}
@@ -0,0 +1,82 @@
+package nn
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+var allActivationFunctions = []ActivationFunction{
+	ReLU{},
+	Sigmoid{},
+	NoActF{},
+	Tanh{},
+	LeakyReLU{Slope: 0.01},
+	ELU{Alpha: 1.5},
+	SELU{},
+	GELU{},
+	GELU{Approximate: true},
+	Softplus{},
+	Swish{Beta: 2},
+	SiLU{},
+	Mish{},
+	HardSigmoid{},
+}
+
+func TestActivationFunction_Derivative(t *testing.T) {
+	// Avoiding the kinks at 0 and +-3.
+	points := []float64{-5, -2.9, -1.3, -0.4, 0.2, 0.7, 1.9, 2.9, 4}
+	for _, actF := range allActivationFunctions {
+		t.Run(fmt.Sprintf("%T%v", actF, actF), func(t *testing.T) {
+			const h = 1e-6
+			for _, v := range points {
+				numerical := (actF.Apply(v+h) - actF.Apply(v-h)) / (2 * h)
+				if math.Abs(numerical-actF.Derivative(v)) > 1e-6 {
+					t.Errorf("Derivative(%v) = %v, want %v", v, actF.Derivative(v), numerical)
+				}
+			}
+		})
+	}
+}
+
+func TestActivationFunction_Values(t *testing.T) {
+	tests := []struct {
+		actF ActivationFunction
+		v    float64
+		want float64
+	}{
+		{LeakyReLU{Slope: 0.1}, -2, -0.2},
+		{ELU{Alpha: 1}, -1, math.Exp(-1) - 1},
+		{SELU{}, 1, 1.0507009873554805},
+		{GELU{}, 1, 0.8413447460685429},
+		{GELU{Approximate: true}, 1, 0.8411919906082768},
+		{Softplus{}, 0, math.Ln2},
+		{Softplus{}, 1000, 1000},
+		{SiLU{}, 1, 0.7310585786300049},
+		{Mish{}, 1, 0.8650983882673103},
+		{HardSigmoid{}, 1.5, 0.75},
+		{HardSigmoid{}, 10, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.actF.Apply(tt.v); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%T%v.Apply(%v) = %v, want %v", tt.actF, tt.actF, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestActivationFunction_SaveLoad(t *testing.T) {
+	for _, actF := range allActivationFunctions {
+		var buf bytes.Buffer
+		if err := SaveActivation(&buf, actF); err != nil {
+			t.Fatalf("SaveActivation() error = %v", err)
+		}
+		loaded, err := LoadActivation(&buf)
+		if err != nil {
+			t.Fatalf("LoadActivation() error = %v", err)
+		}
+		if loaded != actF {
+			t.Errorf("LoadActivation() = %#v, want %#v", loaded, actF)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// Indices of the projections of a MultiHeadAttentionLayer.
+const (
+	queryProjection = iota
+	keyProjection
+	valueProjection
+	outputProjection
+	attentionProjections
+)
+
+// MultiHeadAttentionLayer is a self-attention layer over (steps x features x
+// batch) sequences. Each step is projected into a query, key and value, which
+// are split into Heads parts of features/Heads each. Every head attends to
+// the steps with scaled dot-product attention,
+//
+//	softmax(Q^T * K / sqrt(features/Heads)) * V
+//
+// and the heads' outputs are concatenated and projected back. With Causal
+// set each step only attends to itself and the ones before it.
+type MultiHeadAttentionLayer struct {
+	Weights [attentionProjections]*t.Tensor // Query, key, value and output, features x features
+	Biases  [attentionProjections]*t.Tensor // Features length vectors
+	Heads   int32
+	Causal  bool
+
+	Regularization Regularization // Of the projection weights, not saved
+}
+
+var (
+	_ Layer            = &MultiHeadAttentionLayer{}
+	_ RegularizedLayer = &MultiHeadAttentionLayer{}
+)
+
+type MultiHeadAttentionLayerGradient struct {
+	Weights [attentionProjections]*t.Tensor
+	Biases  [attentionProjections]*t.Tensor
+}
+
+var _ LayerGrad = &MultiHeadAttentionLayerGradient{}
+
+func (g *MultiHeadAttentionLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*MultiHeadAttentionLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	for i := range g.Weights {
+		g.Weights[i].AddInPlace(g2.Weights[i])
+		g.Biases[i].AddInPlace(g2.Biases[i])
+	}
+}
+
+func (g *MultiHeadAttentionLayerGradient) Scale(factor float64) {
+	for i := range g.Weights {
+		g.Weights[i].ScaleInPlace(factor)
+		g.Biases[i].ScaleInPlace(factor)
+	}
+}
+
+// MultiHeadAttentionLayerState keeps the sequences as (features x
+// steps*batch) matrices, see toColumns.
+type MultiHeadAttentionLayerState struct {
+	Steps      int32
+	InputShape []int32
+	Input      *t.Tensor
+	Queries    *t.Tensor
+	Keys       *t.Tensor
+	Values     *t.Tensor
+	Heads      *t.Tensor   // Concatenated heads' outputs
+	Attention  [][]float64 // (steps x steps) weights of each head of each sample
+}
+
+var _ LayerState = MultiHeadAttentionLayerState{}
+
+func (MultiHeadAttentionLayerState) layerState() {}
+
+func NewMultiHeadAttentionLayer(features, heads int32, causal bool) *MultiHeadAttentionLayer {
+	assert.GreaterThan(heads, 0, "Heads must be positive")
+	assert.Equal(features%heads, 0, "Features must be divisible by the heads")
+
+	l := &MultiHeadAttentionLayer{Heads: heads, Causal: causal}
+
+	// Xavier initialization
+	dev := math.Sqrt(1 / float64(features))
+	for i := range l.Weights {
+		l.Weights[i] = t.New(features, features)
+		l.Biases[i] = t.New(features, 1)
+		for j := range l.Weights[i].Data {
+			l.Weights[i].Data[j] = dev * rand.NormFloat64()
+		}
+	}
+	return l
+}
+
+// toColumns turns a (steps x features x batch) sequence into a (features x
+// steps*batch) matrix, with a column per step of each sample, so the same
+// weights can be applied to every step at once.
+func toColumns(seq *t.Tensor) *t.Tensor {
+	return seq.Permute(1, 0, 2).Reshape(seq.Dim(1), -1)
+}
+
+// asSequence views a batch as a (steps x features x batch) sequence. A
+// single (steps x features) sequence is a batch of one, except for layers
+// with a single feature: stack collapses batches of their (steps x 1)
+// samples into (steps x batch) matrices. Layers that don't know their number
+// of features pass -1.
+func asSequence(batch *t.Tensor, features int32) *t.Tensor {
+	switch {
+	case batch.Dims() == 2 && features == 1:
+		return batch.Contiguous().Reshape(batch.Dim(0), 1, batch.Dim(1))
+	case batch.Dims() == 2:
+		return batch.Contiguous().Reshape(batch.Dim(0), batch.Dim(1), 1)
+	}
+	return batch
+}
+
+// fromColumns is the inverse of toColumns.
+func fromColumns(m *t.Tensor, steps int32) *t.Tensor {
+	return m.Reshape(m.Rows(), steps, -1).Permute(1, 0, 2).Contiguous()
+}
+
+func (l *MultiHeadAttentionLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *MultiHeadAttentionLayer) project(projection int, in *t.Tensor) *t.Tensor {
+	return t.MatMul(l.Weights[projection], in).AddInPlace(l.Biases[projection])
+}
+
+// forEachHead calls f with each sample and head, and the function returning
+// the index into the Data of a (features x steps*batch) matrix of the i-th
+// feature of that head at a step.
+func (l *MultiHeadAttentionLayer) forEachHead(
+	steps, batchSize int32,
+	f func(sample, head int32, index func(i, step int32) int32),
+) {
+	headSize := l.Weights[queryProjection].Rows() / l.Heads
+	for n := range batchSize {
+		for h := range l.Heads {
+			f(n, h, func(i, step int32) int32 {
+				return (h*headSize+i)*steps*batchSize + step*batchSize + n
+			})
+		}
+	}
+}
+
+// attends reports whether the query at a step sees the key at another.
+func (l *MultiHeadAttentionLayer) attends(query, key int32) bool {
+	return !l.Causal || key <= query
+}
+
+func (l *MultiHeadAttentionLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	inputShape := slices.Clone(in.Shape)
+	in = asSequence(in, l.Weights[queryProjection].Cols())
+	assert.Equal(in.Dims(), 3, "Input must be a (steps x features x batch) sequence")
+	assert.Equal(in.Dim(1), l.Weights[queryProjection].Cols(), "Input must have the right number of features")
+
+	steps, batchSize := in.Dim(0), in.Dim(2)
+	x := toColumns(in)
+	state := MultiHeadAttentionLayerState{
+		Steps:      steps,
+		InputShape: inputShape,
+		Input:      x,
+		Queries:    l.project(queryProjection, x),
+		Keys:       l.project(keyProjection, x),
+		Values:     l.project(valueProjection, x),
+		Heads:      t.New(x.Shape...),
+		Attention:  make([][]float64, batchSize*l.Heads),
+	}
+
+	headSize := x.Rows() / l.Heads
+	scale := 1 / math.Sqrt(float64(headSize))
+	q, k, v := state.Queries.Data, state.Keys.Data, state.Values.Data
+	l.forEachHead(steps, batchSize, func(n, h int32, index func(i, step int32) int32) {
+		weights := make([]float64, steps*steps)
+		state.Attention[n*l.Heads+h] = weights
+
+		for query := range steps {
+			row := weights[query*steps : (query+1)*steps]
+			for key := range steps {
+				row[key] = math.Inf(-1) // Masked out
+				if l.attends(query, key) {
+					row[key] = 0
+					for i := range headSize {
+						row[key] += q[index(i, query)] * k[index(i, key)]
+					}
+					row[key] *= scale
+				}
+			}
+
+			lse := logSumExp(row)
+			for key := range steps {
+				row[key] = math.Exp(row[key] - lse)
+				for i := range headSize {
+					state.Heads.Data[index(i, query)] += row[key] * v[index(i, key)]
+				}
+			}
+		}
+	})
+
+	out := l.project(outputProjection, state.Heads)
+	return fromColumns(out, steps).Reshape(inputShape...), state
+}
+
+func (l *MultiHeadAttentionLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	/* For each head, with A the attention weights and S the scores before
+	   the softmax (one row per query):
+
+	   dL/dV_j  = Sum_i(A_ij * dL/dO_i)
+	   dL/dA_ij = dL/dO_i . V_j
+	   dL/dS_ij = A_ij * (dL/dA_ij - Sum_k(A_ik * dL/dA_ik))
+	   dL/dQ_i  = Sum_j(dL/dS_ij * K_j) * scale
+	   dL/dK_j  = Sum_i(dL/dS_ij * Q_i) * scale
+	*/
+	state, ok := s.(MultiHeadAttentionLayerState)
+	assert.True(ok, "State must match layer type")
+
+	delta := toColumns(asSequence(nextLayerGrad, l.Weights[outputProjection].Rows()))
+	clipColumns(delta, gradClipping)
+
+	grad := &MultiHeadAttentionLayerGradient{}
+	projected := [attentionProjections]*t.Tensor{
+		state.Queries, state.Keys, state.Values, state.Heads,
+	}
+	deltas := [attentionProjections]*t.Tensor{
+		t.New(delta.Shape...), t.New(delta.Shape...), t.New(delta.Shape...), delta,
+	}
+	headsGrad := t.MatMulTransA(l.Weights[outputProjection], delta)
+
+	steps, batchSize := state.Steps, delta.Cols()/state.Steps
+	headSize := delta.Rows() / l.Heads
+	scale := 1 / math.Sqrt(float64(headSize))
+	q, k, v := state.Queries.Data, state.Keys.Data, state.Values.Data
+	dq, dk, dv := deltas[queryProjection].Data, deltas[keyProjection].Data, deltas[valueProjection].Data
+	weightsGrad := make([]float64, steps)
+	l.forEachHead(steps, batchSize, func(n, h int32, index func(i, step int32) int32) {
+		weights := state.Attention[n*l.Heads+h]
+
+		for query := range steps {
+			row := weights[query*steps : (query+1)*steps]
+			dot := 0.0
+			for key := range steps {
+				weightsGrad[key] = 0
+				for i := range headSize {
+					dO := headsGrad.Data[index(i, query)]
+					weightsGrad[key] += dO * v[index(i, key)]
+					dv[index(i, key)] += row[key] * dO
+				}
+				dot += row[key] * weightsGrad[key]
+			}
+
+			for key := range steps {
+				if !l.attends(query, key) {
+					continue
+				}
+				scoreGrad := row[key] * (weightsGrad[key] - dot) * scale
+				for i := range headSize {
+					dq[index(i, query)] += scoreGrad * k[index(i, key)]
+					dk[index(i, key)] += scoreGrad * q[index(i, query)]
+				}
+			}
+		}
+	})
+
+	prevLayerGrad := t.New(state.Input.Shape...)
+	for i := range grad.Weights {
+		input := state.Input
+		if i == outputProjection {
+			input = projected[outputProjection]
+		} else {
+			prevLayerGrad.AddInPlace(t.MatMulTransA(l.Weights[i], deltas[i]))
+		}
+		grad.Weights[i] = t.MatMulTransB(deltas[i], input)
+		grad.Biases[i] = deltas[i].Sum(1, true)
+
+		assert.True(grad.Weights[i].IsFinite(), "Grad must be finite")
+		assert.True(grad.Biases[i].IsFinite(), "Grad must be finite")
+	}
+
+	return grad, fromColumns(prevLayerGrad, steps).Reshape(state.InputShape...)
+}
+
+func (l *MultiHeadAttentionLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	aGrad, ok := grad.(*MultiHeadAttentionLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	for i := range l.Weights {
+		l.Regularization.update(l.Weights[i], aGrad.Weights[i], opt, learningRate)
+		opt.Update(l.Biases[i], aGrad.Biases[i], learningRate)
+	}
+}
+
+func (l *MultiHeadAttentionLayer) SetRegularization(r Regularization) {
+	l.Regularization = r
+}
+
+func (l *MultiHeadAttentionLayer) penalty() float64 {
+	sum := 0.0
+	for _, weights := range l.Weights {
+		sum += l.Regularization.penalty(weights)
+	}
+	return sum
+}
+
+func (l *MultiHeadAttentionLayer) TypeName() string { return "MultiHeadAttention" }
+
+func (l *MultiHeadAttentionLayer) Save(w io.Writer) error {
+	causal := int32(0)
+	if l.Causal {
+		causal = 1
+	}
+	err := binary.Write(w, binary.LittleEndian, []int32{l.Heads, causal})
+	if err != nil {
+		return err
+	}
+	for i := range l.Weights {
+		err = l.Weights[i].Save(w)
+		if err != nil {
+			return err
+		}
+		err = l.Biases[i].Save(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadMultiHeadAttentionLayer(r io.Reader) (*MultiHeadAttentionLayer, error) {
+	config := make([]int32, 2) // Heads and causal
+	err := binary.Read(r, binary.LittleEndian, config)
+	if err != nil {
+		return nil, err
+	}
+	if config[0] <= 0 || config[1] < 0 || config[1] > 1 {
+		return nil, formatError("MultiHeadAttention layer with invalid options: ", config)
+	}
+
+	l := &MultiHeadAttentionLayer{Heads: config[0], Causal: config[1] == 1}
+	for i := range l.Weights {
+		l.Weights[i], err = t.Load(r)
+		if err != nil {
+			return nil, err
+		}
+		l.Biases[i], err = t.Load(r)
+		if err != nil {
+			return nil, err
+		}
+
+		features := l.Weights[i].Rows()
+		if l.Weights[i].Dims() != 2 || l.Weights[i].Cols() != features || features%l.Heads != 0 ||
+			features != l.Weights[queryProjection].Rows() || !isFeatureVector(l.Biases[i], features) {
+			return nil, formatError(
+				"MultiHeadAttention layer with ", l.Heads, " heads, weights ", l.Weights[i].Shape,
+				" and biases ", l.Biases[i].Shape,
+			)
+		}
+	}
+	return l, nil
+}
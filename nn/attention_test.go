@@ -0,0 +1,182 @@
+package nn
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func sequenceSamples(steps, features int32) []Sample {
+	return []Sample{
+		{In: randomTensor(steps, features), Out: randomTensor(steps, features)},
+		{In: randomTensor(steps, features), Out: randomTensor(steps, features)},
+	}
+}
+
+func TestMultiHeadAttentionLayer_Gradients(t *testing.T) {
+	for _, causal := range []bool{false, true} {
+		l := NewMultiHeadAttentionLayer(4, 2, causal)
+		n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+		samples := sequenceSamples(3, 4)
+
+		grad := n.backpropBatch(samples)[0].(*MultiHeadAttentionLayerGradient)
+		for i := range l.Weights {
+			checkGradient(t, "weights", n, samples, l.Weights[i], grad.Weights[i])
+			checkGradient(t, "biases", n, samples, l.Biases[i], grad.Biases[i])
+		}
+
+		in, expected := batchSamples(samples)
+		checkInputGradient(t, n, in, expected)
+	}
+}
+
+func TestMultiHeadAttentionLayer_Causal(t *testing.T) {
+	l := NewMultiHeadAttentionLayer(4, 2, true)
+	in := randomTensor(5, 4, 2)
+	out, _ := l.Forward(in)
+
+	// Changing the last step doesn't change the ones before it.
+	for i := 4 * 4 * 2; i < len(in.Data); i++ {
+		in.Data[i] += 1
+	}
+	changed, _ := l.Forward(in)
+	if !approxEq(changed.Slice(0, 0, 4), out.Slice(0, 0, 4)) {
+		t.Errorf("Forward() of earlier steps depends on later ones")
+	}
+	if approxEq(changed.Slice(0, 4, 5), out.Slice(0, 4, 5)) {
+		t.Errorf("Forward() of the last step doesn't depend on it")
+	}
+}
+
+func TestMultiHeadAttentionLayer_Batch(t *testing.T) {
+	l := NewMultiHeadAttentionLayer(6, 3, false)
+	in := randomTensor(4, 6, 3)
+	out, _ := l.Forward(in)
+	for n := range int32(3) {
+		single, _ := l.Forward(in.Slice(2, n, n+1))
+		if !approxEq(single, out.Slice(2, n, n+1)) {
+			t.Errorf("Forward() of sample %d = %v, want %v", n, single.Data, out.Slice(2, n, n+1).Contiguous().Data)
+		}
+	}
+}
+
+func TestTransformerEncoderBlock_Gradients(t *testing.T) {
+	l := NewTransformerEncoderBlock(4, 2, 6, false)
+	n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+	samples := sequenceSamples(3, 4)
+
+	grad := n.backpropBatch(samples)[0].(*TransformerEncoderBlockGradient)
+	attention := grad.Layers[0].(*MultiHeadAttentionLayerGradient)
+	checkGradient(t, "query weights", n, samples, l.Attention.Weights[queryProjection], attention.Weights[queryProjection])
+	checkGradient(t, "attention norm gamma", n, samples, l.AttentionNorm.Gamma,
+		grad.Layers[1].(*LayerNormLayerGradient).Gamma)
+	checkGradient(t, "hidden weights", n, samples, l.FeedForwardHidden.Weights,
+		grad.Layers[2].(*FullyConnectedLayerGradient).Weights)
+	checkGradient(t, "output biases", n, samples, l.FeedForwardOutput.Biases,
+		grad.Layers[3].(*FullyConnectedLayerGradient).Biases)
+	checkGradient(t, "feed-forward norm beta", n, samples, l.FeedForwardNorm.Beta,
+		grad.Layers[4].(*LayerNormLayerGradient).Beta)
+
+	in, expected := batchSamples(samples)
+	checkInputGradient(t, n, in, expected)
+}
+
+func TestPositionalEncodingLayers(t *testing.T) {
+	in := ts.New(3, 4, 2)
+	out, _ := NewSinusoidalPositionalEncodingLayer().Forward(in)
+	// Step 2, features 2 and 3 of the second sample.
+	if got, want := out.At(2, 2, 1), math.Sin(2/100.0); math.Abs(got-want) > 1e-12 {
+		t.Errorf("SinusoidalPositionalEncoding Forward() = %v, want %v", got, want)
+	}
+	if got, want := out.At(2, 3, 1), math.Cos(2/100.0); math.Abs(got-want) > 1e-12 {
+		t.Errorf("SinusoidalPositionalEncoding Forward() = %v, want %v", got, want)
+	}
+
+	l := NewLearnedPositionalEncodingLayer(5, 4)
+	n := &NeuralNetwork{
+		Layers:                []Layer{l, NewMultiHeadAttentionLayer(4, 1, false)},
+		GradientClippingLimit: 1e9,
+		Loss:                  MSE{},
+	}
+	samples := sequenceSamples(3, 4)
+	grad := n.backpropBatch(samples)[0].(*LearnedPositionalEncodingLayerGradient)
+	checkGradient(t, "positions", n, samples, l.Positions, grad.Positions)
+}
+
+func TestAttentionLayers_SingleFeature(t *testing.T) {
+	// Single feature samples are stacked into (steps x batch) matrices.
+	samples := sequenceSamples(3, 1)
+	in, expected := batchSamples(samples)
+	if !slices.Equal(in.Shape, []int32{3, 2}) {
+		t.Fatalf("batchSamples() shape = %v, want [3 2]", in.Shape)
+	}
+
+	positions := NewLearnedPositionalEncodingLayer(5, 1)
+	layers := []Layer{NewMultiHeadAttentionLayer(1, 1, true), NewTransformerEncoderBlock(1, 1, 3, false), positions}
+	for _, l := range layers {
+		t.Run(l.TypeName(), func(t *testing.T) {
+			n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+			if out, _ := n.Forward(in); !slices.Equal(out.Shape, in.Shape) {
+				t.Errorf("Forward() shape = %v, want %v", out.Shape, in.Shape)
+			}
+			checkInputGradient(t, n, in, expected)
+		})
+	}
+
+	n := &NeuralNetwork{Layers: []Layer{positions}, GradientClippingLimit: 1e9, Loss: MSE{}}
+	grad := n.backpropBatch(samples)[0].(*LearnedPositionalEncodingLayerGradient)
+	checkGradient(t, "positions", n, samples, positions.Positions, grad.Positions)
+}
+
+func TestAttentionLayers_SingleSequence(t *testing.T) {
+	// A (steps x features) sequence is a batch of one.
+	layers := []Layer{
+		NewMultiHeadAttentionLayer(4, 2, true),
+		NewTransformerEncoderBlock(4, 2, 8, true),
+		NewSinusoidalPositionalEncodingLayer(),
+		NewLearnedPositionalEncodingLayer(6, 4),
+	}
+	for _, l := range layers {
+		t.Run(l.TypeName(), func(t *testing.T) {
+			in := randomTensor(5, 4)
+			n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+			out, _ := n.Forward(in)
+			want, _ := n.Forward(in.Reshape(5, 4, 1))
+			if !slices.Equal(out.Shape, in.Shape) || !approxEq(out.Reshape(5, 4, 1), want) {
+				t.Errorf("Forward() = %v %v, want %v", out.Shape, out.Data, want.Data)
+			}
+			checkInputGradient(t, n, in, randomTensor(5, 4))
+		})
+	}
+}
+
+func TestAttentionLayers_SaveLoad(t *testing.T) {
+	n := &NeuralNetwork{
+		Layers: []Layer{
+			NewLearnedPositionalEncodingLayer(6, 4),
+			NewSinusoidalPositionalEncodingLayer(),
+			NewMultiHeadAttentionLayer(4, 2, true),
+			NewTransformerEncoderBlock(4, 4, 8, false),
+		},
+		Loss: MSE{},
+	}
+
+	loaded := saveAndLoad(t, n)
+
+	for i, l := range loaded.Layers {
+		if l.TypeName() != n.Layers[i].TypeName() {
+			t.Errorf("Load() layer %d = %s, want %s", i, l.TypeName(), n.Layers[i].TypeName())
+		}
+	}
+	if a := loaded.Layers[2].(*MultiHeadAttentionLayer); a.Heads != 2 || !a.Causal {
+		t.Errorf("Load() attention = %d heads, causal %v, want 2 heads, causal", a.Heads, a.Causal)
+	}
+	in := randomTensor(5, 4, 2)
+	want, _ := n.Forward(in)
+	got, _ := loaded.Forward(in)
+	if !slices.Equal(got.Shape, want.Shape) || !ts.Eq(got, want) {
+		t.Errorf("Load() network outputs %v, want %v", got.Data, want.Data)
+	}
+}
@@ -0,0 +1,296 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// BatchNormLayer normalizes each feature to zero mean and unit variance,
+// followed by a learnable scale (Gamma) and shift (Beta). Features are the
+// first dimension of the input, so it works after a FullyConnectedLayer
+// (features x batch) and after a Conv2DLayer (channels x height x width x
+// batch), where each channel is normalized over all of its pixels.
+//
+// While training it uses the statistics of the batch, and keeps a running
+// average of them to use during inference.
+type BatchNormLayer struct {
+	Gamma *t.Tensor // Features length vector
+	Beta  *t.Tensor // Features length vector
+
+	RunningMean *t.Tensor
+	RunningVar  *t.Tensor
+	Momentum    float64 // Weight of the old running statistics on each update
+	Epsilon     float64 // Added to the variance to avoid dividing by 0
+
+	training bool
+}
+
+var _ Layer = &BatchNormLayer{}
+var _ TrainingModeLayer = &BatchNormLayer{}
+
+// BatchNormLayerGradient also carries the statistics of the batch, so they
+// can update the running ones once the gradients of every sub-batch are
+// added together.
+type BatchNormLayerGradient struct {
+	Gamma *t.Tensor
+	Beta  *t.Tensor
+
+	Mean  *t.Tensor
+	Var   *t.Tensor
+	Count float64 // Values each statistic was computed over, 0 outside of training
+}
+
+var _ LayerGrad = &BatchNormLayerGradient{}
+
+func (g *BatchNormLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*BatchNormLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.Gamma.AddInPlace(g2.Gamma)
+	g.Beta.AddInPlace(g2.Beta)
+
+	if g2.Count == 0 {
+		return
+	}
+	if g.Count == 0 {
+		g.Mean, g.Var, g.Count = g2.Mean.Copy(), g2.Var.Copy(), g2.Count
+		return
+	}
+
+	// Chan et al.'s algorithm for combining the mean and variance of two sets.
+	n := g.Count + g2.Count
+	for i := range g.Mean.Data {
+		delta := g2.Mean.Data[i] - g.Mean.Data[i]
+		m2 := g.Var.Data[i]*g.Count + g2.Var.Data[i]*g2.Count + delta*delta*g.Count*g2.Count/n
+		g.Mean.Data[i] += delta * g2.Count / n
+		g.Var.Data[i] = m2 / n
+	}
+	g.Count = n
+}
+
+// Scale only affects the parameter gradients, the statistics stay the same.
+func (g *BatchNormLayerGradient) Scale(factor float64) {
+	g.Gamma.ScaleInPlace(factor)
+	g.Beta.ScaleInPlace(factor)
+}
+
+type BatchNormLayerState struct {
+	Normalized *t.Tensor // Input before scaling and shifting
+	InvStd     []float64 // 1/sqrt(var + epsilon) of each feature
+	Mean       []float64
+	Var        []float64
+	Training   bool // Whether the batch statistics were used
+}
+
+var _ LayerState = BatchNormLayerState{}
+
+func (BatchNormLayerState) layerState() {}
+
+func NewBatchNormLayer(features int32, momentum float64) *BatchNormLayer {
+	assert.True(momentum >= 0 && momentum < 1, "Momentum must be in [0, 1)")
+
+	l := &BatchNormLayer{
+		Gamma:       t.New(features, 1),
+		Beta:        t.New(features, 1),
+		RunningMean: t.New(features, 1),
+		RunningVar:  t.New(features, 1),
+		Momentum:    momentum,
+		Epsilon:     1e-5,
+	}
+	for i := range features {
+		l.Gamma.Data[i] = 1
+		l.RunningVar.Data[i] = 1
+	}
+	return l
+}
+
+func (l *BatchNormLayer) SetTraining(training bool) {
+	l.training = training
+}
+
+func (l *BatchNormLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	assert.GreaterThanOrEqual(in.Dims(), 2, "Input must have a batch dimension")
+	features := in.Dim(0)
+	assert.Equal(features, l.Gamma.Rows(), "Input must have the right number of features")
+
+	// Each feature's values are contiguous, with the batch last.
+	out := in.Copy()
+	size := out.Size() / features
+	state := BatchNormLayerState{
+		Normalized: t.New(out.Shape...),
+		InvStd:     make([]float64, features),
+		Mean:       make([]float64, features),
+		Var:        make([]float64, features),
+		Training:   l.training,
+	}
+
+	for f := range features {
+		values := out.Data[f*size : (f+1)*size]
+		if l.training {
+			state.Mean[f], state.Var[f] = meanAndVariance(values)
+		} else {
+			state.Mean[f], state.Var[f] = l.RunningMean.Data[f], l.RunningVar.Data[f]
+		}
+		state.InvStd[f] = 1 / math.Sqrt(state.Var[f]+l.Epsilon)
+
+		normalized := state.Normalized.Data[f*size : (f+1)*size]
+		for i, v := range values {
+			normalized[i] = (v - state.Mean[f]) * state.InvStd[f]
+			values[i] = l.Gamma.Data[f]*normalized[i] + l.Beta.Data[f]
+		}
+	}
+
+	return out, state
+}
+
+func (l *BatchNormLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(BatchNormLayerState)
+	assert.True(ok, "State must match layer type")
+
+	features := l.Gamma.Rows()
+	prevLayerGrad := nextLayerGrad.Copy()
+	size := prevLayerGrad.Size() / features
+	grad := &BatchNormLayerGradient{
+		Gamma: t.New(features, 1),
+		Beta:  t.New(features, 1),
+	}
+
+	for f := range features {
+		dy := prevLayerGrad.Data[f*size : (f+1)*size]
+		normalized := state.Normalized.Data[f*size : (f+1)*size]
+
+		sumDy, sumDyNormalized := 0.0, 0.0
+		for i, d := range dy {
+			sumDy += d
+			sumDyNormalized += d * normalized[i]
+		}
+		grad.Gamma.Data[f] = sumDyNormalized
+		grad.Beta.Data[f] = sumDy
+
+		/* With the running statistics the mean and variance are constants, but
+		   with the batch ones every output depends on every input:
+
+		   dx_i = gamma * invStd * (dy_i - mean(dy) - x^_i * mean(dy * x^))
+		*/
+		scale := l.Gamma.Data[f] * state.InvStd[f]
+		m := float64(size)
+		for i := range dy {
+			if state.Training {
+				dy[i] = scale * (dy[i] - sumDy/m - normalized[i]*sumDyNormalized/m)
+			} else {
+				dy[i] *= scale
+			}
+		}
+	}
+
+	if state.Training {
+		grad.Mean = t.WithData([]int32{features, 1}, state.Mean)
+		grad.Var = t.WithData([]int32{features, 1}, state.Var)
+		grad.Count = float64(size)
+	}
+
+	assert.True(grad.Gamma.IsFinite(), "Grad must be finite")
+	assert.True(grad.Beta.IsFinite(), "Grad must be finite")
+
+	return grad, prevLayerGrad
+}
+
+func (l *BatchNormLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	bnGrad, ok := grad.(*BatchNormLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	opt.Update(l.Gamma, bnGrad.Gamma, learningRate)
+	opt.Update(l.Beta, bnGrad.Beta, learningRate)
+
+	if bnGrad.Count == 0 {
+		return
+	}
+	// The running variance estimates the population's, so it's unbiased.
+	correction := 1.0
+	if bnGrad.Count > 1 {
+		correction = bnGrad.Count / (bnGrad.Count - 1)
+	}
+	for i := range l.RunningMean.Data {
+		l.RunningMean.Data[i] = l.Momentum*l.RunningMean.Data[i] + (1-l.Momentum)*bnGrad.Mean.Data[i]
+		l.RunningVar.Data[i] = l.Momentum*l.RunningVar.Data[i] + (1-l.Momentum)*bnGrad.Var.Data[i]*correction
+	}
+}
+
+// meanAndVariance returns the mean and population variance of the values.
+func meanAndVariance(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, variance / float64(len(values))
+}
+
+func (l *BatchNormLayer) features() (in, out int32) {
+	return l.Gamma.Rows(), -1
+}
+
+func (l *BatchNormLayer) TypeName() string { return "BatchNorm" }
+
+func (l *BatchNormLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, []float64{l.Momentum, l.Epsilon})
+	if err != nil {
+		return err
+	}
+
+	for _, tensor := range []*t.Tensor{l.Gamma, l.Beta, l.RunningMean, l.RunningVar} {
+		err = tensor.Save(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadBatchNormLayer(r io.Reader) (*BatchNormLayer, error) {
+	config := make([]float64, 2)
+	err := binary.Read(r, binary.LittleEndian, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !(config[0] >= 0 && config[0] < 1) || !(config[1] >= 0) {
+		return nil, formatError("BatchNorm layer with invalid momentum or epsilon: ", config)
+	}
+
+	// Gamma, beta, running mean and running variance
+	tensors := make([]*t.Tensor, 4)
+	for i := range tensors {
+		tensors[i], err = t.Load(r)
+		if err != nil {
+			return nil, err
+		}
+		if !isFeatureVector(tensors[i], tensors[0].Dim(0)) {
+			return nil, formatError("BatchNorm layer with parameters of shape ", tensors[i].Shape)
+		}
+	}
+
+	return &BatchNormLayer{
+		Gamma:       tensors[0],
+		Beta:        tensors[1],
+		RunningMean: tensors[2],
+		RunningVar:  tensors[3],
+		Momentum:    config[0],
+		Epsilon:     config[1],
+	}, nil
+}
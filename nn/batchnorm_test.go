@@ -0,0 +1,117 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestBatchNormLayer_Forward(t *testing.T) {
+	l := NewBatchNormLayer(3, 0.9)
+	l.SetTraining(true)
+	in := randomTensor(3, 50)
+	for i := range in.Data {
+		in.Data[i] = 5 + 3*in.Data[i]
+	}
+
+	out, _ := l.Forward(in)
+	mean, variance := out.Mean(1, false), out.Var(1, false)
+	for f := range 3 {
+		if math.Abs(mean.Data[f]) > 1e-9 || math.Abs(variance.Data[f]-1) > 1e-4 {
+			t.Errorf("Forward() feature %d has mean %v and variance %v, want 0 and 1", f, mean.Data[f], variance.Data[f])
+		}
+	}
+
+	// In inference mode the fresh running statistics (0 and 1) are used.
+	l.SetTraining(false)
+	out, _ = l.Forward(in)
+	if !approxEq(out, ts.Map(in, func(v float64) float64 { return v / math.Sqrt(1+l.Epsilon) })) {
+		t.Errorf("Forward() in inference mode didn't use the running statistics")
+	}
+}
+
+func TestBatchNormLayer_Gradients(t *testing.T) {
+	tests := []struct {
+		name     string
+		features int32
+		inShape  []int32
+		training bool
+	}{
+		{"dense training", 4, []int32{4}, true},
+		{"dense inference", 4, []int32{4}, false},
+		{"conv training", 2, []int32{2, 3, 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewBatchNormLayer(tt.features, 0.9)
+			l.Gamma = randomTensor(tt.features, 1)
+			l.Beta = randomTensor(tt.features, 1)
+			n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+			n.SetTraining(tt.training)
+
+			samples := make([]Sample, 5)
+			for i := range samples {
+				samples[i] = Sample{In: randomTensor(tt.inShape...), Out: randomTensor(tt.inShape...)}
+			}
+
+			grad := n.backpropBatch(samples)[0].(*BatchNormLayerGradient)
+			checkGradient(t, "gamma", n, samples, l.Gamma, grad.Gamma)
+			checkGradient(t, "beta", n, samples, l.Beta, grad.Beta)
+
+			in, expected := batchSamples(samples)
+			checkInputGradient(t, n, in, expected)
+		})
+	}
+}
+
+func TestBatchNormLayer_MergeStatistics(t *testing.T) {
+	l := NewBatchNormLayer(2, 0.5)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+	n.SetTraining(true)
+
+	samples := make([]Sample, 7)
+	for i := range samples {
+		samples[i] = Sample{In: randomTensor(2), Out: randomTensor(2)}
+	}
+	in, _ := batchSamples(samples)
+	wantMean, wantVar := in.Mean(1, true), in.Var(1, true)
+
+	// Like TrainConcurrent with uneven sub-batches.
+	grad := n.backpropBatch(samples[:3])[0]
+	grad.Add(n.backpropBatch(samples[3:])[0])
+	bnGrad := grad.(*BatchNormLayerGradient)
+	if bnGrad.Count != 7 || !approxEq(bnGrad.Mean, wantMean) || !approxEq(bnGrad.Var, wantVar) {
+		t.Fatalf("Add() statistics = %v %v, want %v %v", bnGrad.Mean.Data, bnGrad.Var.Data, wantMean.Data, wantVar.Data)
+	}
+
+	grad.Scale(1.0 / 7)
+	l.UpdateParams(grad, NewSGD(0, false), 0.1)
+	for f := range 2 {
+		mean := 0.5 * wantMean.Data[f]
+		variance := 0.5 + 0.5*wantVar.Data[f]*7/6
+		if math.Abs(l.RunningMean.Data[f]-mean) > 1e-12 || math.Abs(l.RunningVar.Data[f]-variance) > 1e-12 {
+			t.Errorf("UpdateParams() running statistics = %v %v, want %v %v",
+				l.RunningMean.Data[f], l.RunningVar.Data[f], mean, variance)
+		}
+	}
+}
+
+func TestBatchNormLayer_SaveLoad(t *testing.T) {
+	l := NewBatchNormLayer(3, 0.8)
+	l.Gamma, l.Beta = randomTensor(3, 1), randomTensor(3, 1)
+	l.RunningMean, l.RunningVar = randomTensor(3, 1), randomTensor(3, 1)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+
+	l2, ok := loaded.Layers[0].(*BatchNormLayer)
+	if !ok {
+		t.Fatalf("Load() layer = %T, want *BatchNormLayer", loaded.Layers[0])
+	}
+	if !ts.Eq(l.Gamma, l2.Gamma) || !ts.Eq(l.Beta, l2.Beta) ||
+		!ts.Eq(l.RunningMean, l2.RunningMean) || !ts.Eq(l.RunningVar, l2.RunningVar) ||
+		l.Momentum != l2.Momentum || l.Epsilon != l2.Epsilon {
+		t.Errorf("Load() = %+v, want %+v", l2, l)
+	}
+}
@@ -0,0 +1,324 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// Conv2DLayer slides square kernels over (channels x height x width) images.
+// Batches have the samples along the last dimension, so inputs are
+// (InChannels x H x W x batch) tensors.
+type Conv2DLayer struct {
+	Kernels *t.Tensor // OutChannels x InChannels x KernelSize x KernelSize
+	Biases  *t.Tensor // OutChannels length vector
+
+	InChannels, OutChannels int32
+	KernelSize              int32
+	Stride                  int32
+	Padding                 int32 // Zeros added on every side of the image
+	Dilation                int32 // Spacing between kernel elements, 1 is a regular kernel
+
+	actF ActivationFunction
+
+	Regularization Regularization // Of the kernels, not saved
+}
+
+var (
+	_ Layer            = &Conv2DLayer{}
+	_ RegularizedLayer = &Conv2DLayer{}
+)
+
+type Conv2DLayerGradient struct {
+	Kernels *t.Tensor
+	Biases  *t.Tensor
+}
+
+var _ LayerGrad = &Conv2DLayerGradient{}
+
+func (g *Conv2DLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*Conv2DLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.Kernels.AddInPlace(g2.Kernels)
+	g.Biases.AddInPlace(g2.Biases)
+}
+
+func (g *Conv2DLayerGradient) Scale(factor float64) {
+	g.Kernels.ScaleInPlace(factor)
+	g.Biases.ScaleInPlace(factor)
+}
+
+// Conv2DLayerState keeps the unrolled input patches, which are needed for
+// the kernel gradient.
+type Conv2DLayerState struct {
+	InputShape []int32
+	Columns    *t.Tensor // (InChannels*KernelSize*KernelSize) x (outH*outW*batch)
+	Z          *t.Tensor // Output before the activation function
+}
+
+var _ LayerState = Conv2DLayerState{}
+
+func (Conv2DLayerState) layerState() {}
+
+func NewConv2DLayer(
+	inChannels, outChannels, kernelSize, stride, padding, dilation int32,
+	actF ActivationFunction,
+) *Conv2DLayer {
+	assert.GreaterThan(kernelSize, 0, "Kernel size must be positive")
+	assert.GreaterThan(stride, 0, "Stride must be positive")
+	assert.GreaterThanOrEqual(padding, 0, "Padding can't be negative")
+	assert.GreaterThan(dilation, 0, "Dilation must be positive")
+
+	l := &Conv2DLayer{
+		Kernels:     t.New(outChannels, inChannels, kernelSize, kernelSize),
+		Biases:      t.New(outChannels, 1),
+		InChannels:  inChannels,
+		OutChannels: outChannels,
+		KernelSize:  kernelSize,
+		Stride:      stride,
+		Padding:     padding,
+		Dilation:    dilation,
+		actF:        actF,
+	}
+
+	// He initialization, each output sees a whole kernel's worth of inputs
+	dev := math.Sqrt(2 / float64(inChannels*kernelSize*kernelSize))
+	for i := range l.Kernels.Data {
+		l.Kernels.Data[i] = dev * rand.NormFloat64()
+	}
+
+	return l
+}
+
+// OutputSize returns the height (or width) of the output for an input of
+// the given height (or width).
+func (l *Conv2DLayer) OutputSize(inSize int32) int32 {
+	span := l.Dilation*(l.KernelSize-1) + 1
+	return (inSize+2*l.Padding-span)/l.Stride + 1
+}
+
+// Forward takes a (channels x height x width x batch) tensor, a single
+// (channels x height x width) image being a batch of one.
+func (l *Conv2DLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	inputShape := slices.Clone(in.Shape)
+	in = in.Contiguous().Reshape(batchShape(inputShape)...)
+	assert.Equal(in.Dims(), 4, "Input must be channels x height x width x batch")
+	assert.Equal(in.Dim(0), l.InChannels, "Input must have the right number of channels")
+
+	outH, outW := l.OutputSize(in.Dim(1)), l.OutputSize(in.Dim(2))
+	assert.True(outH > 0 && outW > 0, "Input is smaller than the kernel")
+
+	/* Unrolling every patch the kernels are applied to into a column (im2col)
+	   turns the convolution into a single matrix multiplication:
+
+	   Z = Kernels (out x in*k*k) * Columns (in*k*k x outH*outW*batch)
+
+	   Which with the batch last is already the (out x outH x outW x batch) output.
+	*/
+	columns := l.im2col(in.Contiguous(), outH, outW)
+	z := t.MatMul(l.kernelMatrix(), columns).AddInPlace(l.Biases)
+	z = z.Reshape(l.OutChannels, outH, outW, in.Dim(3))
+
+	state := Conv2DLayerState{
+		InputShape: inputShape,
+		Columns:    columns,
+		Z:          z,
+	}
+	return t.Map(z, l.actF.Apply), state
+}
+
+func (l *Conv2DLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	// Same as the fully connected layer, with Columns as the input.
+	state, ok := s.(Conv2DLayerState)
+	assert.True(ok, "State must match layer type")
+
+	batchSize := state.Z.Dim(3)
+	delta := t.ElementMult(nextLayerGrad, t.Map(state.Z, l.actF.Derivative))
+	// Clip each sample's delta, which are the columns of this view.
+	clipColumns(delta.Reshape(-1, batchSize), gradClipping)
+
+	deltaMatrix := delta.Reshape(l.OutChannels, -1)
+	parameterGrad := &Conv2DLayerGradient{
+		Kernels: t.MatMulTransB(deltaMatrix, state.Columns).Reshape(l.Kernels.Shape...),
+		Biases:  deltaMatrix.Sum(1, true),
+	}
+
+	// The gradient of each column goes back to the pixels it was copied from.
+	columnsGrad := t.MatMulTransA(l.kernelMatrix(), deltaMatrix)
+	// Single images were treated as a batch of one.
+	prevLayerGrad := l.col2im(columnsGrad, batchShape(state.InputShape)).Reshape(state.InputShape...)
+
+	assert.True(parameterGrad.Kernels.IsFinite(), "Grad must be finite")
+	assert.True(parameterGrad.Biases.IsFinite(), "Grad must be finite")
+
+	return parameterGrad, prevLayerGrad
+}
+
+func (l *Conv2DLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	convGrad, ok := grad.(*Conv2DLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	l.Regularization.update(l.Kernels, convGrad.Kernels, opt, learningRate)
+	opt.Update(l.Biases, convGrad.Biases, learningRate)
+}
+
+func (l *Conv2DLayer) SetRegularization(r Regularization) {
+	l.Regularization = r
+}
+
+func (l *Conv2DLayer) penalty() float64 {
+	return l.Regularization.penalty(l.Kernels)
+}
+
+// kernelMatrix views the kernels as one row per output channel.
+func (l *Conv2DLayer) kernelMatrix() *t.Tensor {
+	return l.Kernels.Reshape(l.OutChannels, -1)
+}
+
+// forEachPatchRow calls f for every row of the unrolled patches matrix and
+// every output row, with the input row it reads from (which may be out of
+// bounds because of the padding).
+func (l *Conv2DLayer) forEachPatchRow(outH int32, f func(row, c, kx, outY, inY int32)) {
+	k := l.KernelSize
+	for c := range l.InChannels {
+		for ky := range k {
+			for kx := range k {
+				row := (c*k+ky)*k + kx
+				for outY := range outH {
+					inY := outY*l.Stride - l.Padding + ky*l.Dilation
+					f(row, c, kx, outY, inY)
+				}
+			}
+		}
+	}
+}
+
+// im2col unrolls the patches of a contiguous input into the columns of a
+// matrix, with the same order as the output's elements.
+func (l *Conv2DLayer) im2col(in *t.Tensor, outH, outW int32) *t.Tensor {
+	inH, inW, n := in.Dim(1), in.Dim(2), in.Dim(3)
+	rows := l.InChannels * l.KernelSize * l.KernelSize
+	columns := t.New(rows, outH*outW*n)
+	cols := outH * outW * n
+
+	l.forEachPatchRow(outH, func(row, c, kx, outY, inY int32) {
+		if inY < 0 || inY >= inH {
+			return // Padding, leave the zeros
+		}
+		for outX := range outW {
+			inX := outX*l.Stride - l.Padding + kx*l.Dilation
+			if inX < 0 || inX >= inW {
+				continue
+			}
+			// The whole batch is contiguous in both tensors.
+			src := ((c*inH+inY)*inW + inX) * n
+			dst := row*cols + (outY*outW+outX)*n
+			copy(columns.Data[dst:dst+n], in.Data[src:src+n])
+		}
+	})
+	return columns
+}
+
+// col2im is the reverse of im2col, adding up the values of every column
+// that came from the same pixel.
+func (l *Conv2DLayer) col2im(columns *t.Tensor, inShape []int32) *t.Tensor {
+	inH, inW, n := inShape[1], inShape[2], inShape[3]
+	outH, outW := l.OutputSize(inH), l.OutputSize(inW)
+	cols := outH * outW * n
+	img := t.New(inShape...)
+
+	l.forEachPatchRow(outH, func(row, c, kx, outY, inY int32) {
+		if inY < 0 || inY >= inH {
+			return
+		}
+		for outX := range outW {
+			inX := outX*l.Stride - l.Padding + kx*l.Dilation
+			if inX < 0 || inX >= inW {
+				continue
+			}
+			dst := ((c*inH+inY)*inW + inX) * n
+			src := row*cols + (outY*outW+outX)*n
+			for i := range n {
+				img.Data[dst+i] += columns.Data[src+i]
+			}
+		}
+	})
+	return img
+}
+
+func (l *Conv2DLayer) features() (in, out int32) {
+	return l.InChannels, l.OutChannels
+}
+
+func (l *Conv2DLayer) TypeName() string { return "Conv2D" }
+
+func (l *Conv2DLayer) Save(w io.Writer) error {
+	err := SaveActivation(w, l.actF)
+	if err != nil {
+		return err
+	}
+
+	// Stride, padding and dilation can't be deduced from the tensors.
+	config := []int32{l.Stride, l.Padding, l.Dilation}
+	err = binary.Write(w, binary.LittleEndian, config)
+	if err != nil {
+		return err
+	}
+
+	err = l.Kernels.Save(w)
+	if err != nil {
+		return err
+	}
+	return l.Biases.Save(w)
+}
+
+func loadConv2DLayer(r io.Reader) (*Conv2DLayer, error) {
+	actF, err := LoadActivation(r)
+	if err != nil {
+		return nil, err
+	}
+	config := make([]int32, 3) // Stride, padding and dilation
+	err = binary.Read(r, binary.LittleEndian, config)
+	if err != nil {
+		return nil, err
+	}
+	kernels, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	biases, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if kernels.Dims() != 4 || kernels.Dim(2) != kernels.Dim(3) || kernels.Dim(2) == 0 ||
+		!isFeatureVector(biases, kernels.Dim(0)) {
+		return nil, formatError("Conv2D layer with kernels ", kernels.Shape, " and biases ", biases.Shape)
+	}
+	if config[0] <= 0 || config[1] < 0 || config[2] <= 0 {
+		return nil, formatError("Conv2D layer with invalid stride, padding or dilation: ", config)
+	}
+
+	return &Conv2DLayer{
+		Kernels:     kernels,
+		Biases:      biases,
+		InChannels:  kernels.Dim(1),
+		OutChannels: kernels.Dim(0),
+		KernelSize:  kernels.Dim(2),
+		Stride:      config[0],
+		Padding:     config[1],
+		Dilation:    config[2],
+		actF:        actF,
+	}, nil
+}
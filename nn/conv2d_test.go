@@ -0,0 +1,115 @@
+package nn
+
+import (
+	"fmt"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestConv2DLayer_Forward(t *testing.T) {
+	// A single 3x3 image with values 1..9
+	in := ts.WithData([]int32{1, 3, 3, 1}, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9})
+
+	tests := []struct {
+		name                      string
+		kernel                    []float64
+		stride, padding, dilation int32
+		want                      *ts.Tensor
+	}{
+		{
+			name:   "2x2 sum",
+			kernel: []float64{1, 1, 1, 1}, stride: 1, padding: 0, dilation: 1,
+			want: ts.WithData([]int32{1, 2, 2, 1}, []float64{12, 16, 24, 28}),
+		},
+		{
+			name:   "stride 2 with padding",
+			kernel: []float64{1, 1, 1, 1}, stride: 2, padding: 1, dilation: 1,
+			want: ts.WithData([]int32{1, 2, 2, 1}, []float64{1, 5, 11, 28}),
+		},
+		{
+			name:   "dilated corners",
+			kernel: []float64{1, 10, 100, 1000}, stride: 1, padding: 0, dilation: 2,
+			want: ts.Scalar(1 + 30 + 700 + 9000),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewConv2DLayer(1, 1, 2, tt.stride, tt.padding, tt.dilation, NoActF{})
+			copy(l.Kernels.Data, tt.kernel)
+
+			got, _ := l.Forward(in)
+			if !ts.Eq(got, tt.want) {
+				t.Errorf("Conv2DLayer.Forward() = %v, want %v", got.Data, tt.want.Data)
+			}
+		})
+	}
+}
+
+func TestConv2DLayer_Gradients(t *testing.T) {
+	configs := []struct{ kernel, stride, padding, dilation int32 }{
+		{3, 1, 0, 1},
+		{3, 2, 1, 1},
+		{2, 1, 2, 2},
+	}
+	for _, c := range configs {
+		t.Run(fmt.Sprintf("k%d s%d p%d d%d", c.kernel, c.stride, c.padding, c.dilation), func(t *testing.T) {
+			l := NewConv2DLayer(2, 3, c.kernel, c.stride, c.padding, c.dilation, Sigmoid{})
+			n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+
+			outSize := l.OutputSize(5)
+			samples := []Sample{
+				{In: randomTensor(2, 5, 5), Out: randomTensor(3, outSize, outSize)},
+				{In: randomTensor(2, 5, 5), Out: randomTensor(3, outSize, outSize)},
+			}
+
+			grad := n.backpropBatch(samples)[0].(*Conv2DLayerGradient)
+			checkGradient(t, "kernel", n, samples, l.Kernels, grad.Kernels)
+			checkGradient(t, "bias", n, samples, l.Biases, grad.Biases)
+
+			in, expected := batchSamples(samples)
+			checkInputGradient(t, n, in, expected)
+		})
+	}
+}
+
+func TestConv2DLayer_SingleImage(t *testing.T) {
+	l := NewConv2DLayer(2, 3, 3, 1, 1, 1, Tanh{})
+	n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+
+	// A (channels x height x width) image is a batch of one.
+	in := randomTensor(2, 4, 4)
+	got, _ := l.Forward(in)
+	want, _ := l.Forward(in.Reshape(2, 4, 4, 1))
+	if !ts.Eq(got, want) {
+		t.Errorf("Conv2DLayer.Forward() = %v, want %v", got.Data, want.Data)
+	}
+	checkInputGradient(t, n, in, randomTensor(3, 4, 4, 1))
+
+	_, state := l.Forward(in)
+	if _, inGrad := l.ComputeGradients(state, got, 1e9); !ts.EqDims(inGrad, in) {
+		t.Errorf("Conv2DLayer.ComputeGradients() input gradient shape = %v, want %v", inGrad.Shape, in.Shape)
+	}
+}
+
+func TestConv2DLayer_SaveLoad(t *testing.T) {
+	n := &NeuralNetwork{
+		Layers: []Layer{NewConv2DLayer(2, 4, 3, 2, 1, 2, ReLU{})},
+		Loss:   MSE{},
+	}
+
+	loaded := saveAndLoad(t, n)
+
+	l := n.Layers[0].(*Conv2DLayer)
+	l2, ok := loaded.Layers[0].(*Conv2DLayer)
+	if !ok {
+		t.Fatalf("Load() layer = %T, want *Conv2DLayer", loaded.Layers[0])
+	}
+	if !ts.Eq(l.Kernels, l2.Kernels) || !ts.Eq(l.Biases, l2.Biases) {
+		t.Errorf("Load() parameters differ")
+	}
+	if l.Stride != l2.Stride || l.Padding != l2.Padding || l.Dilation != l2.Dilation ||
+		l.InChannels != l2.InChannels || l.OutChannels != l2.OutChannels || l.KernelSize != l2.KernelSize {
+		t.Errorf("Load() = %+v, want %+v", l2, l)
+	}
+}
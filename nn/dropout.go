@@ -0,0 +1,117 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"sync"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// DropoutLayer zeroes each input with probability Rate while training,
+// scaling the rest by 1/(1-Rate) so the expected activation doesn't change
+// (inverted dropout). Outside of training it does nothing.
+type DropoutLayer struct {
+	Rate float64
+	// Seed of the masks' random numbers. Concurrent workers share them, so
+	// which worker gets which mask depends on scheduling: the masks only
+	// repeat between runs with TrainSingleThreaded or a single worker.
+	Seed int64
+
+	training bool
+	rng      *rand.Rand // Created from Seed on the first training step
+	rngLock  sync.Mutex // Workers share the layer
+}
+
+var _ Layer = &DropoutLayer{}
+var _ TrainingModeLayer = &DropoutLayer{}
+
+// DropoutLayerState keeps the mask applied to the input, already scaled.
+// It's nil when nothing was dropped.
+type DropoutLayerState struct {
+	Mask *t.Tensor
+}
+
+var _ LayerState = DropoutLayerState{}
+
+func (DropoutLayerState) layerState() {}
+
+func NewDropoutLayer(rate float64, seed int64) *DropoutLayer {
+	assert.True(rate >= 0 && rate < 1, "Rate must be in [0, 1)")
+
+	return &DropoutLayer{Rate: rate, Seed: seed}
+}
+
+func (l *DropoutLayer) SetTraining(training bool) {
+	l.training = training
+}
+
+func (l *DropoutLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	if !l.training || l.Rate == 0 {
+		return in, DropoutLayerState{}
+	}
+
+	mask := t.New(in.Shape...)
+	scale := 1 / (1 - l.Rate)
+	l.rngLock.Lock()
+	if l.rng == nil {
+		l.rng = rand.New(rand.NewSource(l.Seed))
+	}
+	for i := range mask.Data {
+		if l.rng.Float64() >= l.Rate {
+			mask.Data[i] = scale
+		}
+	}
+	l.rngLock.Unlock()
+
+	return t.ElementMult(in, mask), DropoutLayerState{Mask: mask}
+}
+
+func (l *DropoutLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(DropoutLayerState)
+	assert.True(ok, "State must match layer type")
+
+	if state.Mask == nil {
+		return noGrad{}, nextLayerGrad
+	}
+	return noGrad{}, t.ElementMult(nextLayerGrad, state.Mask)
+}
+
+func (l *DropoutLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *DropoutLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *DropoutLayer) TypeName() string { return "Dropout" }
+
+func (l *DropoutLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, l.Rate)
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, l.Seed)
+}
+
+func loadDropoutLayer(r io.Reader) (*DropoutLayer, error) {
+	var rate float64
+	err := binary.Read(r, binary.LittleEndian, &rate)
+	if err != nil {
+		return nil, err
+	}
+	var seed int64
+	err = binary.Read(r, binary.LittleEndian, &seed)
+	if err != nil {
+		return nil, err
+	}
+	if !(rate >= 0 && rate < 1) {
+		return nil, formatError("Dropout layer with invalid rate ", rate)
+	}
+	return NewDropoutLayer(rate, seed), nil
+}
@@ -0,0 +1,95 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestDropoutLayer_Forward(t *testing.T) {
+	in := ts.New(100, 50)
+	for i := range in.Data {
+		in.Data[i] = 1
+	}
+	l := NewDropoutLayer(0.25, 1)
+
+	got, _ := l.Forward(in)
+	if !ts.Eq(got, in) {
+		t.Errorf("Forward() changed the input outside of training")
+	}
+
+	l.SetTraining(true)
+	got, state := l.Forward(in)
+	dropped := 0
+	for _, v := range got.Data {
+		switch {
+		case v == 0:
+			dropped++
+		case math.Abs(v-1/0.75) > 1e-12:
+			t.Fatalf("Forward() kept value = %v, want %v", v, 1/0.75)
+		}
+	}
+	if rate := float64(dropped) / float64(len(got.Data)); math.Abs(rate-0.25) > 0.03 {
+		t.Errorf("Forward() dropped %v of the inputs, want 0.25", rate)
+	}
+
+	// The gradient only flows through the kept inputs, with the same scale.
+	_, grad := l.ComputeGradients(state, in, 1)
+	if !ts.Eq(grad, got) {
+		t.Errorf("ComputeGradients() doesn't match the mask")
+	}
+}
+
+func TestDropoutLayer_Seed(t *testing.T) {
+	in := randomTensor(20, 4)
+	// Layers built without the constructor work the same.
+	l1, l2 := NewDropoutLayer(0.5, 42), &DropoutLayer{Rate: 0.5, Seed: 42}
+	l1.SetTraining(true)
+	l2.SetTraining(true)
+
+	out1, _ := l1.Forward(in)
+	out2, _ := l2.Forward(in)
+	if !ts.Eq(out1, out2) {
+		t.Errorf("Forward() with the same seed gave different masks")
+	}
+}
+
+func TestNeuralNetwork_TrainingMode(t *testing.T) {
+	dropout := NewDropoutLayer(0.5, 1)
+	n := NewMLP([]int32{2, 4, 1}, Sigmoid{}, NoActF{}, 1)
+	n.Layers = append(n.Layers[:1], dropout, n.Layers[1])
+	samples := []Sample{{In: randomTensor(2), Out: randomTensor(1)}}
+
+	if n.Training() || dropout.training {
+		t.Fatalf("New networks must start in inference mode")
+	}
+
+	n.SetTraining(true)
+	if !dropout.training {
+		t.Errorf("SetTraining() didn't reach the layers")
+	}
+	// Evaluating is deterministic even while training.
+	if n.AverageLoss(samples) != n.AverageLoss(samples) {
+		t.Errorf("AverageLoss() used dropout")
+	}
+	if !n.Training() || !dropout.training {
+		t.Errorf("AverageLoss() didn't restore training mode")
+	}
+
+	n.TrainConcurrent(samples, nil, 1, NewInverseTimeDecay(0.1, 0), 1, 1, false)
+	if n.Training() || dropout.training {
+		t.Errorf("TrainConcurrent() left the network in training mode")
+	}
+}
+
+func TestDropoutLayer_SaveLoad(t *testing.T) {
+	n := &NeuralNetwork{Layers: []Layer{NewDropoutLayer(0.3, 7)}, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+
+	l, ok := loaded.Layers[0].(*DropoutLayer)
+	if !ok || l.Rate != 0.3 || l.Seed != 7 {
+		t.Errorf("Load() layer = %+v, want rate 0.3 and seed 7", loaded.Layers[0])
+	}
+}
@@ -0,0 +1,293 @@
+package nn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// EmbeddingLayer maps integer indices (like token IDs) to learned vectors.
+// Its input holds the indices as floats, with the batch as the last
+// dimension, and each index is replaced by a column vector: a batch of
+// single indices becomes a (features x batch) matrix and a (steps x batch)
+// batch of sequences a (steps x features x batch) one.
+type EmbeddingLayer struct {
+	Weights      *t.Tensor // Vocabulary size x features, a row per index
+	PaddingIndex int32     // Index whose vector stays at zero and is never trained, -1 for none
+
+	// Of the vectors, not saved. Only the vectors each batch uses are
+	// regularized, like they are the only ones updated.
+	Regularization Regularization
+	trained        map[int32]bool // Rows updated so far, the only ones penalized
+}
+
+var (
+	_ Layer            = &EmbeddingLayer{}
+	_ RegularizedLayer = &EmbeddingLayer{}
+)
+
+// EmbeddingLayerGradient is sparse, only having the rows of the indices the
+// batch used.
+type EmbeddingLayerGradient struct {
+	Rows map[int32][]float64
+}
+
+var _ LayerGrad = &EmbeddingLayerGradient{}
+
+func (g *EmbeddingLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*EmbeddingLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	for index, row2 := range g2.Rows {
+		row, ok := g.Rows[index]
+		if !ok {
+			g.Rows[index] = row2
+			continue
+		}
+		for i := range row {
+			row[i] += row2[i]
+		}
+	}
+}
+
+func (g *EmbeddingLayerGradient) Scale(factor float64) {
+	for _, row := range g.Rows {
+		for i := range row {
+			row[i] *= factor
+		}
+	}
+}
+
+type EmbeddingLayerState struct {
+	InputShape []int32
+	Indices    []int32
+}
+
+var _ LayerState = EmbeddingLayerState{}
+
+func (EmbeddingLayerState) layerState() {}
+
+// NewEmbeddingLayer creates a layer for indices in [0, vocabularySize), with
+// normally distributed vectors.
+func NewEmbeddingLayer(vocabularySize, features, paddingIndex int32) *EmbeddingLayer {
+	weights := t.New(vocabularySize, features)
+	for i := range weights.Data {
+		weights.Data[i] = rand.NormFloat64()
+	}
+	return NewEmbeddingLayerWithWeights(weights, paddingIndex)
+}
+
+// NewEmbeddingLayerWithWeights creates a layer using the given (vocabulary
+// size x features) vectors, like pretrained ones.
+func NewEmbeddingLayerWithWeights(weights *t.Tensor, paddingIndex int32) *EmbeddingLayer {
+	assert.Equal(weights.Dims(), 2, "Weights must be a matrix")
+	assert.True(paddingIndex >= -1 && paddingIndex < weights.Rows(), "Padding index must be -1 or a valid index")
+
+	l := &EmbeddingLayer{Weights: weights, PaddingIndex: paddingIndex}
+	if paddingIndex != -1 {
+		clear(l.row(paddingIndex))
+	}
+	return l
+}
+
+func (l *EmbeddingLayer) row(index int32) []float64 {
+	features := l.Weights.Cols()
+	return l.Weights.Data[index*features : (index+1)*features]
+}
+
+// forEachIndex calls f with each index of the input and the offset of its
+// vector in the output, whose elements are batchSize apart.
+func forEachIndex(indices []int32, batchSize, features int32, f func(index int32, offset int32)) {
+	for i, index := range indices {
+		position, sample := int32(i)/batchSize, int32(i)%batchSize
+		f(index, position*features*batchSize+sample)
+	}
+}
+
+func (l *EmbeddingLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	in = in.Contiguous()
+	if in.Dims() == 0 {
+		in = in.Reshape(1)
+	}
+
+	state := EmbeddingLayerState{InputShape: in.Shape, Indices: make([]int32, len(in.Data))}
+	for i, v := range in.Data {
+		assert.True(v == math.Trunc(v) && v >= 0 && v < float64(l.Weights.Rows()), "Indices must be valid integers")
+		state.Indices[i] = int32(v)
+	}
+
+	batchSize, features := in.Dim(in.Dims()-1), l.Weights.Cols()
+	shape := append(in.Shape[:in.Dims()-1:in.Dims()-1], features, batchSize)
+	out := t.New(shape...)
+	forEachIndex(state.Indices, batchSize, features, func(index, offset int32) {
+		for i, v := range l.row(index) {
+			out.Data[offset+int32(i)*batchSize] = v
+		}
+	})
+
+	return out, state
+}
+
+func (l *EmbeddingLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(EmbeddingLayerState)
+	assert.True(ok, "State must match layer type")
+
+	nextLayerGrad = nextLayerGrad.Contiguous()
+	grad := &EmbeddingLayerGradient{Rows: make(map[int32][]float64)}
+	batchSize, features := state.InputShape[len(state.InputShape)-1], l.Weights.Cols()
+	forEachIndex(state.Indices, batchSize, features, func(index, offset int32) {
+		if index == l.PaddingIndex {
+			return
+		}
+		row, ok := grad.Rows[index]
+		if !ok {
+			row = make([]float64, features)
+			grad.Rows[index] = row
+		}
+		for i := range row {
+			row[i] += nextLayerGrad.Data[offset+int32(i)*batchSize]
+		}
+	})
+
+	// Indices can't change smoothly, there is no gradient for them.
+	return grad, t.New(state.InputShape...)
+}
+
+func (l *EmbeddingLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	eGrad, ok := grad.(*EmbeddingLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	for _, row := range eGrad.Rows {
+		for _, v := range row {
+			assert.True(!math.IsNaN(v) && !math.IsInf(v, 0), "Grad must be finite")
+		}
+	}
+
+	// Only the rows the batch used change.
+	l.Regularization.updateRows(l.Weights, eGrad.Rows, opt, learningRate)
+
+	if l.trained == nil {
+		l.trained = make(map[int32]bool)
+	}
+	for index := range eGrad.Rows {
+		l.trained[index] = true
+	}
+}
+
+func (l *EmbeddingLayer) SetRegularization(r Regularization) {
+	l.Regularization = r
+}
+
+// penalty only counts the rows training has updated, since the rest never get
+// the penalty's gradient. Before training it's 0.
+func (l *EmbeddingLayer) penalty() float64 {
+	sum := 0.0
+	for index := range l.trained {
+		sum += l.Regularization.penalty(t.WithData([]int32{l.Weights.Cols()}, l.row(index)))
+	}
+	return sum
+}
+
+func (l *EmbeddingLayer) TypeName() string { return "Embedding" }
+
+func (l *EmbeddingLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, l.PaddingIndex)
+	if err != nil {
+		return err
+	}
+	return l.Weights.Save(w)
+}
+
+func loadEmbeddingLayer(r io.Reader) (*EmbeddingLayer, error) {
+	var paddingIndex int32
+	err := binary.Read(r, binary.LittleEndian, &paddingIndex)
+	if err != nil {
+		return nil, err
+	}
+	weights, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if weights.Dims() != 2 || paddingIndex < -1 || paddingIndex >= weights.Rows() {
+		return nil, formatError("Embedding layer with weights ", weights.Shape, " and padding index ", paddingIndex)
+	}
+	return &EmbeddingLayer{Weights: weights, PaddingIndex: paddingIndex}, nil
+}
+
+// LoadPretrainedEmbeddings reads word vectors in the text format used by
+// word2vec and GloVe, a word followed by its vector on each line, with an
+// optional "words features" first line. It returns a layer without padding
+// index along with the word of each index.
+func LoadPretrainedEmbeddings(r io.Reader) (*EmbeddingLayer, []string, error) {
+	var words []string
+	var data []float64
+	features := -1
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24) // Lines with long vectors
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if line == 1 && len(fields) == 2 {
+			_, err1 := strconv.Atoi(fields[0])
+			_, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil { // word2vec header
+				continue
+			}
+		}
+
+		if features == -1 {
+			features = len(fields) - 1
+		}
+		if len(fields)-1 != features || features == 0 {
+			return nil, nil, errors.New(fmt.Sprint(
+				"Invalid embeddings on line ", line, ": ", len(fields)-1, " values, expected ", features,
+			))
+		}
+		for _, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, nil, errors.New(fmt.Sprint("Invalid embeddings on line ", line, ": ", err))
+			}
+			data = append(data, v)
+		}
+		words = append(words, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(words) == 0 {
+		return nil, nil, errors.New("No embeddings found")
+	}
+
+	weights := t.WithData([]int32{int32(len(words)), int32(features)}, data)
+	return NewEmbeddingLayerWithWeights(weights, -1), words, nil
+}
+
+func LoadPretrainedEmbeddingsFromFile(path string) (*EmbeddingLayer, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	return LoadPretrainedEmbeddings(f)
+}
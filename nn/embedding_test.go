@@ -0,0 +1,129 @@
+package nn
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestEmbeddingLayer_Forward(t *testing.T) {
+	weights := ts.WithData([]int32{3, 2}, []float64{1, 2, 3, 4, 5, 6})
+	l := NewEmbeddingLayerWithWeights(weights, 0)
+
+	tests := []struct {
+		name string
+		in   *ts.Tensor
+		want *ts.Tensor
+	}{
+		{"single indices", ts.RowVector(2, 1).Reshape(2), ts.WithData([]int32{2, 2}, []float64{5, 3, 6, 4})},
+		{"sequences", ts.WithData([]int32{2, 2}, []float64{1, 2, 0, 1}), ts.WithData([]int32{2, 2, 2}, []float64{
+			3, 5, 4, 6, // Step 0
+			0, 3, 0, 4, // Step 1, the first sample is padding
+		})},
+	}
+	for _, tt := range tests {
+		got, _ := l.Forward(tt.in)
+		if !ts.Eq(got, tt.want) {
+			t.Errorf("Forward() of %s = %v %v, want %v %v", tt.name, got.Shape, got.Data, tt.want.Shape, tt.want.Data)
+		}
+	}
+}
+
+func TestEmbeddingLayer_Gradients(t *testing.T) {
+	l := NewEmbeddingLayer(5, 3, 0)
+	dense := NewFullyConnectedLayer(2*3, 2, Tanh{})
+	n := &NeuralNetwork{
+		Layers:                []Layer{l, NewFlattenLayer(), dense},
+		GradientClippingLimit: 1e9,
+		Loss:                  MSE{},
+	}
+	samples := []Sample{
+		{In: ts.ColumnVector(1, 4), Out: randomTensor(2)},
+		{In: ts.ColumnVector(3, 1), Out: randomTensor(2)},
+	}
+
+	grad := n.backpropBatch(samples)[0].(*EmbeddingLayerGradient)
+	if indices := slices.Sorted(maps.Keys(grad.Rows)); !slices.Equal(indices, []int32{1, 3, 4}) {
+		t.Errorf("ComputeGradients() rows = %v, want [1 3 4]", indices)
+	}
+	denseGrad := ts.New(l.Weights.Shape...)
+	for index, row := range grad.Rows {
+		copy(denseGrad.Data[index*3:], row)
+	}
+	checkGradient(t, "weights", n, samples, l.Weights, denseGrad)
+}
+
+func TestEmbeddingLayer_ScalarIndices(t *testing.T) {
+	// Learns a value per token ID, fed one ID per sample.
+	n := &NeuralNetwork{
+		Layers:                []Layer{NewEmbeddingLayer(4, 3, -1), NewFullyConnectedLayer(3, 1, NoActF{})},
+		GradientClippingLimit: 10,
+		Loss:                  MSE{},
+	}
+	var samples []Sample
+	for i := range 4 {
+		samples = append(samples, Sample{In: ts.Scalar(float64(i)), Out: ts.Scalar(float64(i) - 1.5)})
+	}
+
+	before := n.AverageLoss(samples)
+	n.TrainSingleThreaded(samples, nil, 200, NewInverseTimeDecay(0.05, 0), 0)
+	if after := n.AverageLoss(samples); after > before/100 {
+		t.Errorf("AverageLoss() after training = %v, want well below %v", after, before)
+	}
+
+	// A single ID gives a batch of one, like a stacked batch does.
+	batch, _ := batchSamples(samples)
+	if out, _ := n.Forward(batch); !slices.Equal(out.Shape, []int32{1, 4}) {
+		t.Errorf("Forward() of a batch shape = %v, want [1 4]", out.Shape)
+	}
+	if out, _ := n.Forward(ts.Scalar(2)); !slices.Equal(out.Shape, []int32{1, 1}) {
+		t.Errorf("Forward() of a single index shape = %v, want [1 1]", out.Shape)
+	}
+}
+
+func TestEmbeddingLayer_Padding(t *testing.T) {
+	l := NewEmbeddingLayer(3, 2, 1)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}, Optimizer: NewSGD(0, false)}
+	samples := []Sample{{In: ts.ColumnVector(1, 2), Out: randomTensor(2, 2)}}
+	n.TrainSingleThreaded(samples, nil, 3, NewInverseTimeDecay(0.1, 0), 0)
+
+	if !slices.Equal(l.row(1), []float64{0, 0}) {
+		t.Errorf("Padding vector = %v, want zeros", l.row(1))
+	}
+}
+
+func TestLoadPretrainedEmbeddings(t *testing.T) {
+	want := ts.WithData([]int32{2, 3}, []float64{0.1, -0.2, 0.3, 1, 2, 3})
+	for _, text := range []string{
+		"the 0.1 -0.2 0.3\ncat 1 2 3\n",        // GloVe
+		"2 3\nthe 0.1 -0.2 0.3\ncat 1 2 3\n\n", // word2vec
+	} {
+		l, words, err := LoadPretrainedEmbeddings(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("LoadPretrainedEmbeddings() error = %v", err)
+		}
+		if !slices.Equal(words, []string{"the", "cat"}) || !ts.Eq(l.Weights, want) || l.PaddingIndex != -1 {
+			t.Errorf("LoadPretrainedEmbeddings() = %v, %v, want %v, [the cat]", l.Weights.Data, words, want.Data)
+		}
+	}
+
+	for _, text := range []string{"", "the 1 2\ncat 1\n", "the 1 x\n"} {
+		if _, _, err := LoadPretrainedEmbeddings(strings.NewReader(text)); err == nil {
+			t.Errorf("LoadPretrainedEmbeddings(%q) didn't fail", text)
+		}
+	}
+}
+
+func TestEmbeddingLayer_SaveLoad(t *testing.T) {
+	l := NewEmbeddingLayer(4, 3, 2)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+	got, ok := loaded.Layers[0].(*EmbeddingLayer)
+	if !ok || got.PaddingIndex != 2 || !ts.Eq(got.Weights, l.Weights) {
+		t.Errorf("Load() layer = %+v, want %+v", loaded.Layers[0], l)
+	}
+}
@@ -0,0 +1,151 @@
+package nn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+/* Model files start with a header:
+
+   magic           "GONN"
+   version         uint32
+   metadata length uint32, followed by that many bytes of metadata (see
+                   metadata.go)
+
+   Then comes the network itself (clipping limit, layers and loss), and the
+   file ends with the CRC32 (IEEE) of everything before it.
+
+   Files saved before the header existed start directly with the network and
+   have no checksum, Load still reads them.
+*/
+
+var modelMagic = [4]byte{'G', 'O', 'N', 'N'}
+
+const modelFormatVersion uint32 = 1
+
+// Limits on what Load accepts, anything bigger is taken as corruption.
+const (
+	maxMetadataLength = 1 << 20
+	maxLayers         = 1 << 16
+	maxTypeNameLength = 256
+	maxReshapeDims    = 32
+)
+
+// FormatError is returned by Load when the data isn't a valid model. Errors
+// reading the underlying stream (like io.ErrUnexpectedEOF when it's
+// truncated) and tensor.LoadError are returned as they are.
+type FormatError struct {
+	Reason string
+}
+
+func (e *FormatError) Error() string {
+	return e.Reason
+}
+
+func formatError(a ...any) error {
+	return &FormatError{Reason: fmt.Sprint(a...)}
+}
+
+var ErrChecksumMismatch error = &FormatError{"Model file checksum doesn't match its contents, the file is corrupted"}
+
+func writeHeader(w io.Writer, metadata []byte) error {
+	err := binary.Write(w, binary.LittleEndian, modelMagic)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, modelFormatVersion)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, uint32(len(metadata)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(metadata)
+	return err
+}
+
+// readHeader reads the rest of the header after the magic, returning the
+// metadata.
+func readHeader(r io.Reader) ([]byte, error) {
+	var version uint32
+	err := binary.Read(r, binary.LittleEndian, &version)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 || version > modelFormatVersion {
+		return nil, formatError(
+			"Unsupported model file version ", version, ", the newest supported is ", modelFormatVersion,
+		)
+	}
+
+	var length uint32
+	err = binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxMetadataLength {
+		return nil, formatError("Model file metadata is too long: ", length, " bytes")
+	}
+	metadata := make([]byte, length)
+	_, err = io.ReadFull(r, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// isFeatureVector checks if v is a (features x 1) column vector.
+func isFeatureVector(v *t.Tensor, features int32) bool {
+	return slices.Equal(v.Shape, []int32{features, 1})
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the
+// middle of the model.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// featureLayer is implemented by layers that know the size of the first
+// dimension of their input and output, which is checked against their
+// neighbours' when loading. Layers that don't implement it (like
+// FlattenLayer) can change it to anything.
+type featureLayer interface {
+	// features returns the sizes, -1 for in if any is accepted and -1 for out
+	// if it's the same as the input's.
+	features() (in, out int32)
+}
+
+// checkLayerChain checks that each layer's input matches the output of the
+// previous one, when both are known.
+func checkLayerChain(layers []Layer) error {
+	current := int32(-1) // Unknown
+	for i, l := range layers {
+		fl, ok := l.(featureLayer)
+		if !ok {
+			current = -1
+			continue
+		}
+
+		in, out := fl.features()
+		if in != -1 && current != -1 && in != current {
+			return formatError(
+				"Layer ", i, " (", l.TypeName(), ") takes ", in, " features, but the previous layer outputs ", current,
+			)
+		}
+		if in != -1 {
+			current = in
+		}
+		if out != -1 {
+			current = out
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package nn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func savedNetwork(t *testing.T) (*NeuralNetwork, []byte) {
+	t.Helper()
+
+	n := NewMLP([]int32{3, 5, 2}, Tanh{}, NoActF{}, 2)
+	n.Loss = Huber{Delta: 0.5}
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return n, buf.Bytes()
+}
+
+func TestLoad_Format(t *testing.T) {
+	n, data := savedNetwork(t)
+	if !bytes.HasPrefix(data, []byte("GONN")) {
+		t.Fatalf("Save() = %q..., want the magic first", data[:4])
+	}
+
+	loaded, err := Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	in := ts.ColumnVector(1, -1, 0.5)
+	want, _ := n.Forward(in)
+	got, _ := loaded.Forward(in)
+	if !ts.Eq(got, want) || loaded.Loss != n.Loss || loaded.GradientClippingLimit != 2 {
+		t.Errorf("Load() = %+v, want %+v", loaded, n)
+	}
+}
+
+func TestLoad_Corrupted(t *testing.T) {
+	_, data := savedNetwork(t)
+
+	// Flipping a bit in a weight still parses, only the checksum catches it.
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-20] ^= 1
+	if _, err := Load(bytes.NewReader(corrupted)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Load() of a corrupted file error = %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	if _, err := Load(bytes.NewReader(data[:len(data)-2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Load() of a truncated file error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	future := bytes.Clone(data)
+	future[4] = 99 // Version
+	if _, err := Load(bytes.NewReader(future)); err == nil {
+		t.Errorf("Load() of a newer version didn't fail")
+	}
+}
+
+func TestLoad_Headerless(t *testing.T) {
+	n, _ := savedNetwork(t)
+	var buf bytes.Buffer
+	if err := n.saveNetwork(&buf); err != nil {
+		t.Fatalf("saveNetwork() error = %v", err)
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Layers) != 2 || loaded.Loss != n.Loss {
+		t.Errorf("Load() = %+v, want %+v", loaded, n)
+	}
+}
+
+func TestLoad_LegacyFile(t *testing.T) {
+	// Saved before the header, or the loss, existed.
+	n, err := LoadFromFile("../mnist/mnist_trained.nn")
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if len(n.Layers) != 3 || n.Loss != (MSE{}) {
+		t.Errorf("LoadFromFile() = %d layers and %T loss, want 3 and MSE", len(n.Layers), n.Loss)
+	}
+	if _, ok := n.Layers[0].(*FullyConnectedLayer); !ok {
+		t.Errorf("LoadFromFile() layer = %T, want *FullyConnectedLayer", n.Layers[0])
+	}
+}
+
+func networkBody(t *testing.T, layers ...Layer) []byte {
+	t.Helper()
+
+	n := &NeuralNetwork{Layers: layers, Loss: MSE{}}
+	var buf bytes.Buffer
+	if err := n.saveNetwork(&buf); err != nil {
+		t.Fatalf("saveNetwork() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	hugeLayerCount := networkBody(t)
+	binary.LittleEndian.PutUint32(hugeLayerCount[8:], 1<<30)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"mismatched layers", networkBody(t,
+			NewFullyConnectedLayer(3, 5, ReLU{}),
+			NewFullyConnectedLayer(4, 2, ReLU{}),
+		)},
+		{"mismatched after pooling", networkBody(t,
+			NewConv2DLayer(1, 4, 3, 1, 0, 1, ReLU{}),
+			NewMaxPool2DLayer(2, 2, 0),
+			NewBatchNormLayer(3, 0.9),
+		)},
+		{"invalid reshape", networkBody(t, NewReshapeLayer(-1, 2, -1))},
+		{"invalid dropout", networkBody(t, &DropoutLayer{Rate: 1})},
+		{"huge layer count", hugeLayerCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(bytes.NewReader(tt.data))
+			var formatErr *FormatError
+			if !errors.As(err, &formatErr) {
+				t.Errorf("Load() error = %v, want a *FormatError", err)
+			}
+		})
+	}
+
+	// Chains through layers that can change the size aren't rejected.
+	data := networkBody(t, NewFullyConnectedLayer(6, 4, ReLU{}), NewReshapeLayer(2, 2, -1), NewFlattenLayer(),
+		NewFullyConnectedLayer(4, 1, ReLU{}))
+	if _, err := Load(bytes.NewReader(data)); err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestLoad_InvalidTensor(t *testing.T) {
+	data := networkBody(t, NewFullyConnectedLayer(3, 5, ReLU{}))
+	// Dimension count of the weights, after the clipping limit, the layer count,
+	// the layer's type and its activation.
+	binary.LittleEndian.PutUint32(data[14:], 1000)
+
+	var loadErr *ts.LoadError
+	if _, err := Load(bytes.NewReader(data)); !errors.As(err, &loadErr) {
+		t.Errorf("Load() error = %v, want a *tensor.LoadError", err)
+	}
+}
+
+func FuzzLoad(f *testing.F) {
+	n := NewMLP([]int32{3, 4, 2}, LeakyReLU{Slope: 0.1}, NoActF{}, 1)
+	n.Layers = append(n.Layers, NewDropoutLayer(0.5, 1), NewLayerNormLayer(2), &SoftmaxLayer{})
+	n.Loss = Huber{Delta: 1}
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		f.Fatalf("Save() error = %v", err)
+	}
+	f.Add(buf.Bytes())
+	buf.Reset()
+	if err := n.saveNetwork(&buf); err != nil {
+		f.Fatalf("saveNetwork() error = %v", err)
+	}
+	f.Add(buf.Bytes())
+	conv := &NeuralNetwork{Layers: []Layer{
+		NewConv2DLayer(1, 2, 3, 1, 1, 1, ReLU{}),
+		NewAvgPool2DLayer(2, 2, 0),
+		NewBatchNormLayer(2, 0.9),
+		NewFlattenLayer(),
+	}, Loss: CategoricalCrossEntropy{}}
+	block, _, _ := residualBlock(3)
+	sequence := &NeuralNetwork{Layers: []Layer{
+		NewEmbeddingLayer(10, 4, 0),
+		NewLearnedPositionalEncodingLayer(6, 4),
+		NewMultiHeadAttentionLayer(4, 2, true),
+		NewLSTMLayer(4, 3, false),
+		block,
+	}, Loss: MSE{}}
+	for _, n := range []*NeuralNetwork{conv, sequence} {
+		buf.Reset()
+		if err := n.saveNetwork(&buf); err != nil {
+			f.Fatalf("saveNetwork() error = %v", err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, err := Load(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err := n.Save(io.Discard); err != nil {
+			t.Errorf("Save() of a loaded network error = %v", err)
+		}
+		// Loaded networks must also run, which panics if they don't.
+		if in := fuzzInput(n); in != nil {
+			n.Forward(in)
+		}
+	})
+}
+
+// fuzzInput builds a batch of one for networks starting like the fuzzing
+// seeds, with the images and sequences 6 pixels or steps long. It returns nil
+// for the rest.
+func fuzzInput(n *NeuralNetwork) *ts.Tensor {
+	if len(n.Layers) == 0 {
+		return nil
+	}
+	switch l := n.Layers[0].(type) {
+	case *FullyConnectedLayer:
+		in, _ := l.features()
+		return ts.New(in, 1)
+	case *Conv2DLayer:
+		in, _ := l.features()
+		return ts.New(in, 6, 6, 1)
+	case *EmbeddingLayer:
+		return ts.New(6, 1) // The first index every step
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package nn
 
 import (
-	"encoding/binary"
 	"io"
 	"math"
 	"math/rand"
@@ -16,9 +15,14 @@ type FullyConnectedLayer struct {
 	Weights *t.Tensor // MxN array
 	Biases  *t.Tensor // N length vector
 	actF    ActivationFunction
+
+	Regularization Regularization // Of the weights, not saved
 }
 
-var _ Layer = &FullyConnectedLayer{}
+var (
+	_ Layer            = &FullyConnectedLayer{}
+	_ RegularizedLayer = &FullyConnectedLayer{}
+)
 
 // FullyConnectedLayerGradient holds the gradients for the weights and biases
 // of a FullyConnectedLayer, used for updating parameters during backpropagation.
@@ -45,8 +49,8 @@ func (g *FullyConnectedLayerGradient) Scale(factor float64) {
 // FullyConnectedLayerState stores the input and intermediate values
 // (Z) during the forward pass, necessary for calculating gradients later.
 type FullyConnectedLayerState struct {
-	Input *t.Tensor
-	Z     *t.Tensor // Z is the partial activation = Wx + b, stored for backpropagation.
+	Input *t.Tensor // One sample per column
+	Z     *t.Tensor // Z is the partial activation = WX + b, stored for backpropagation.
 }
 
 var _ LayerState = FullyConnectedLayerState{}
@@ -78,11 +82,16 @@ func (l *FullyConnectedLayer) initializeHe(in, out int32) {
 	}
 }
 
+// Forward takes a (features x batch) matrix, a column vector being a batch of one.
 func (l *FullyConnectedLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
-	assert.Equal(in.Cols(), 1, "Input must be a column vector")
+	if in.Dims() == 1 && l.Weights.Cols() == 1 { // A batch of scalars
+		in = in.Reshape(1, in.Dim(0))
+	}
+	assert.LessThanOrEqual(in.Dims(), 2, "Input must be a matrix")
 	assert.Equal(l.Weights.Cols(), in.Rows(), "Input must be the right size")
 
-	z := t.Add(t.MatMul(l.Weights, in), l.Biases)
+	// The bias column gets broadcast to every sample
+	z := t.MatMul(l.Weights, in).AddInPlace(l.Biases)
 
 	// Cached values
 	state := FullyConnectedLayerState{
@@ -108,7 +117,9 @@ func (l *FullyConnectedLayer) ComputeGradients(
 
 	   delta = ( dL/da_j * dactF/dz_j )
 
-	   With it we can calculate the gradients using matrix operations.
+	   With it we can calculate the gradients using matrix operations. For a
+	   batch, delta has a column per sample, and multiplying by the input's
+	   transpose sums the gradients of all of them.
 	*/
 	state, ok := s.(FullyConnectedLayerState)
 	assert.True(ok, "State must match layer type")
@@ -116,20 +127,17 @@ func (l *FullyConnectedLayer) ComputeGradients(
 	actFDerivatives := t.Map(state.Z, l.actF.Derivative)
 	delta := t.ElementMult(nextLayerGrad, actFDerivatives)
 
-	// Clip delta to avoid infinite gradients.
-	norm := delta.ColVectorNorm2()
-	if norm > gradClipping {
-		delta.ScaleInPlace(gradClipping / norm)
-	}
+	// Clip each sample's delta to avoid infinite gradients.
+	clipColumns(delta, gradClipping)
 
 	parameterGrad := &FullyConnectedLayerGradient{
 		// Weight gradient turns out to be just delta * input^T.
-		Weights: t.MatMul(delta, t.MatTranspose(state.Input)),
-		// Similarly, the bias gradient is just delta.
-		Biases: delta,
+		Weights: t.MatMulTransB(delta, state.Input),
+		// Similarly, the bias gradient is just delta, summed over the batch.
+		Biases: delta.Sum(1, true),
 	}
 	// Finally, the gradient of the loss respecting the previous layer's output.
-	prevLayerGrad := t.MatMul(t.MatTranspose(l.Weights), delta)
+	prevLayerGrad := t.MatMulTransA(l.Weights, delta)
 
 	// Check we haven't blown up
 	assert.True(parameterGrad.Weights.IsFinite(), "Grad must be finite")
@@ -138,24 +146,34 @@ func (l *FullyConnectedLayer) ComputeGradients(
 	return parameterGrad, prevLayerGrad
 }
 
-func (l *FullyConnectedLayer) UpdateParams(grad LayerGrad, learningRate float64) {
+func (l *FullyConnectedLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
 	assert.GreaterThan(learningRate, 0, "Must be positive")
 
 	fCGrad, ok := grad.(*FullyConnectedLayerGradient)
 	assert.True(ok, "Gradient must match layer type")
 
 	// Modify parameters according to gradient and learning rate
-	l.Weights.SubInPlace(t.ScalarMult(fCGrad.Weights, learningRate))
-	l.Biases.SubInPlace(t.ScalarMult(fCGrad.Biases, learningRate))
+	l.Regularization.update(l.Weights, fCGrad.Weights, opt, learningRate)
+	opt.Update(l.Biases, fCGrad.Biases, learningRate)
 }
 
-func (l *FullyConnectedLayer) save(w io.Writer) error {
-	// Write the name and actF
-	err := binary.Write(w, binary.LittleEndian, FULLY_CONNECTED_LAYER)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(w, binary.LittleEndian, l.actF.actFType())
+func (l *FullyConnectedLayer) SetRegularization(r Regularization) {
+	l.Regularization = r
+}
+
+func (l *FullyConnectedLayer) penalty() float64 {
+	return l.Regularization.penalty(l.Weights)
+}
+
+func (l *FullyConnectedLayer) features() (in, out int32) {
+	return l.Weights.Cols(), l.Weights.Rows()
+}
+
+func (l *FullyConnectedLayer) TypeName() string { return "FullyConnected" }
+
+func (l *FullyConnectedLayer) Save(w io.Writer) error {
+	// The network already wrote the type, only the actF is needed
+	err := SaveActivation(w, l.actF)
 	if err != nil {
 		return err
 	}
@@ -166,7 +184,7 @@ func (l *FullyConnectedLayer) save(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	l.Biases.Save(w)
+	err = l.Biases.Save(w)
 	if err != nil {
 		return err
 	}
@@ -175,8 +193,8 @@ func (l *FullyConnectedLayer) save(w io.Writer) error {
 
 func loadFullyConnectedLayer(r io.Reader) (*FullyConnectedLayer, error) {
 	// This load function is called after reading the type,
-	// we just need to read the actFType and then the tensors.
-	actF, err := loadActF(r)
+	// we just need to read the actF and then the tensors.
+	actF, err := LoadActivation(r)
 	if err != nil {
 		return nil, err
 	}
@@ -188,6 +206,9 @@ func loadFullyConnectedLayer(r io.Reader) (*FullyConnectedLayer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if weights.Dims() != 2 || !isFeatureVector(biases, weights.Rows()) {
+		return nil, formatError("Fully connected layer with weights ", weights.Shape, " and biases ", biases.Shape)
+	}
 
 	return &FullyConnectedLayer{
 		Weights: weights,
@@ -195,3 +216,21 @@ func loadFullyConnectedLayer(r io.Reader) (*FullyConnectedLayer, error) {
 		actF:    actF,
 	}, nil
 }
+
+// clipColumns scales down every column whose norm exceeds limit.
+func clipColumns(m *t.Tensor, limit float64) {
+	rows, cols := int(m.Rows()), int(m.Cols())
+	for c := range cols {
+		norm := 0.0
+		for r := range rows {
+			norm += m.Data[r*cols+c] * m.Data[r*cols+c]
+		}
+		norm = math.Sqrt(norm)
+
+		if norm > limit {
+			for r := range rows {
+				m.Data[r*cols+c] *= limit / norm
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package nn
 
 import (
+	"math"
 	"testing"
 
 	ts "github.com/ManuelGarciaF/neural-networks/tensor"
@@ -53,6 +54,20 @@ func TestFullyConnectedLayer_Forward(t *testing.T) {
 			},
 			want: ts.ColumnVector(1*5+2*6+0.5, 3*5+4*6+0.2),
 		},
+		{
+			name: "2x2 forward batch of 2",
+			fields: fields{
+				weights: ts.WithData([]int32{2, 2}, []float64{1, 2, 3, 4}),
+				bias:    ts.ColumnVector(0.5, 0.2),
+			},
+			args: args{
+				in: ts.WithData([]int32{2, 2}, []float64{5, 1, 6, 0}),
+			},
+			want: ts.WithData([]int32{2, 2}, []float64{
+				1*5 + 2*6 + 0.5, 1*1 + 2*0 + 0.5,
+				3*5 + 4*6 + 0.2, 3*1 + 4*0 + 0.2,
+			}),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -67,3 +82,36 @@ func TestFullyConnectedLayer_Forward(t *testing.T) {
 		})
 	}
 }
+
+func TestFullyConnectedLayer_BatchedGradients(t *testing.T) {
+	// The gradients of a batch must be the sum of each sample's gradients.
+	n := NewMLP([]int32{3, 4, 2}, Sigmoid{}, NoActF{}, 1e6)
+	samples := []Sample{
+		{In: ts.ColumnVector(1, 2, 3), Out: ts.ColumnVector(1, 0)},
+		{In: ts.ColumnVector(-1, 0.5, 0), Out: ts.ColumnVector(0, 1)},
+		{In: ts.ColumnVector(0.2, 0.1, -2), Out: ts.ColumnVector(1, 1)},
+	}
+
+	batched := n.backpropBatch(samples)
+	summed := n.backpropBatch(samples[:1])
+	for _, s := range samples[1:] {
+		for layer, grad := range n.backpropBatch([]Sample{s}) {
+			summed[layer].Add(grad)
+		}
+	}
+
+	for layer := range n.Layers {
+		b := batched[layer].(*FullyConnectedLayerGradient)
+		s := summed[layer].(*FullyConnectedLayerGradient)
+		for i := range b.Weights.Data {
+			if math.Abs(b.Weights.Data[i]-s.Weights.Data[i]) > 1e-9 {
+				t.Fatalf("layer %d weight gradients = %v, want %v", layer, b.Weights.Data, s.Weights.Data)
+			}
+		}
+		for i := range b.Biases.Data {
+			if math.Abs(b.Biases.Data[i]-s.Biases.Data[i]) > 1e-9 {
+				t.Fatalf("layer %d bias gradients = %v, want %v", layer, b.Biases.Data, s.Biases.Data)
+			}
+		}
+	}
+}
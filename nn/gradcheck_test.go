@@ -0,0 +1,102 @@
+package nn
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// checkGradient compares grad, the computed gradient of the network's total
+// loss over the samples respecting param, against central differences.
+func checkGradient(t *testing.T, name string, n *NeuralNetwork, samples []Sample, param, grad *ts.Tensor) {
+	t.Helper()
+
+	// Not using AverageLoss, which would switch to inference mode.
+	in, expected := batchSamples(samples)
+	totalLoss := func() float64 {
+		out, _ := n.Forward(in)
+		return n.Loss.Value(out, expected)
+	}
+
+	const h = 1e-5
+	for i := range param.Data {
+		original := param.Data[i]
+		param.Data[i] = original + h
+		plus := totalLoss()
+		param.Data[i] = original - h
+		minus := totalLoss()
+		param.Data[i] = original
+
+		numerical := (plus - minus) / (2 * h)
+		if math.Abs(numerical-grad.Data[i]) > 1e-5*max(1, math.Abs(numerical)) {
+			t.Errorf("%s gradient[%d] = %v, want %v", name, i, grad.Data[i], numerical)
+		}
+	}
+}
+
+// checkInputGradient checks the gradient a layer passes back to its input,
+// using the network's loss on that layer's output.
+func checkInputGradient(t *testing.T, n *NeuralNetwork, in, expected *ts.Tensor) {
+	t.Helper()
+
+	out, states := n.Forward(in)
+	lossGrad := n.Loss.Gradient(out, expected)
+	if len(n.Layers) != 1 {
+		t.Fatalf("checkInputGradient only supports single layer networks")
+	}
+	_, inGrad := n.Layers[0].ComputeGradients(states[0], lossGrad, math.Inf(1))
+
+	const h = 1e-5
+	for i := range in.Data {
+		original := in.Data[i]
+		in.Data[i] = original + h
+		outPlus, _ := n.Forward(in)
+		in.Data[i] = original - h
+		outMinus, _ := n.Forward(in)
+		in.Data[i] = original
+
+		numerical := (n.Loss.Value(outPlus, expected) - n.Loss.Value(outMinus, expected)) / (2 * h)
+		if math.Abs(numerical-inGrad.Data[i]) > 1e-5*max(1, math.Abs(numerical)) {
+			t.Errorf("input gradient[%d] = %v, want %v", i, inGrad.Data[i], numerical)
+		}
+	}
+}
+
+func randomTensor(shape ...int32) *ts.Tensor {
+	tensor := ts.New(shape...)
+	for i := range tensor.Data {
+		tensor.Data[i] = rand.NormFloat64()
+	}
+	return tensor
+}
+
+func approxEq(t1, t2 *ts.Tensor) bool {
+	if !ts.EqDims(t1, t2) {
+		return false
+	}
+	t1, t2 = t1.Contiguous(), t2.Contiguous()
+	for i := range t1.Data {
+		if math.Abs(t1.Data[i]-t2.Data[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+// saveAndLoad saves n and loads it back.
+func saveAndLoad(t *testing.T, n *NeuralNetwork) *NeuralNetwork {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return loaded
+}
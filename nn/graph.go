@@ -0,0 +1,550 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+/* A Graph connects layers in any directed acyclic graph instead of a chain,
+   for things like residual connections or networks with several inputs and
+   outputs. It's built by adding nodes that take the outputs of earlier ones:
+
+   g := nn.NewGraph()
+   in := g.Input()
+   hidden := g.Layer(nn.NewFullyConnectedLayer(8, 8, nn.ReLU{}), in)
+   g.SetOutputs(g.Add(in, hidden))
+
+   Graphs with a single input and output are layers themselves, so they can
+   be used as blocks of a NeuralNetwork. GraphNetwork trains ones with
+   several.
+*/
+
+// Node identifies a node of a Graph, it's its index in Nodes.
+type Node int32
+
+type graphNodeType byte
+
+const (
+	INPUT_NODE  graphNodeType = iota // One of the graph's inputs
+	LAYER_NODE                       // A layer applied to its only input
+	ADD_NODE                         // The sum of its inputs
+	CONCAT_NODE                      // Its inputs joined along Axis
+)
+
+type GraphNode struct {
+	Type   graphNodeType
+	Layer  Layer  // For LAYER_NODE
+	Axis   int32  // For CONCAT_NODE, it can't be the batch dimension
+	Inputs []Node // Nodes whose outputs this one takes
+}
+
+type Graph struct {
+	Nodes   []GraphNode
+	Inputs  []Node // INPUT_NODE nodes, in the order the inputs are given
+	Outputs []Node
+}
+
+var (
+	_ Layer            = &Graph{}
+	_ RegularizedLayer = &Graph{}
+)
+
+// GraphGradient has the gradient of each layer node, and nil for the rest.
+type GraphGradient struct {
+	Layers []LayerGrad
+}
+
+var _ LayerGrad = &GraphGradient{}
+
+func (g *GraphGradient) Add(another LayerGrad) {
+	g2, ok := another.(*GraphGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	for i, lg := range g.Layers {
+		if lg != nil {
+			lg.Add(g2.Layers[i])
+		}
+	}
+}
+
+func (g *GraphGradient) Scale(factor float64) {
+	for _, lg := range g.Layers {
+		if lg != nil {
+			lg.Scale(factor)
+		}
+	}
+}
+
+// GraphState has the state of each layer node and the shape of every node's
+// output.
+type GraphState struct {
+	Layers []LayerState
+	Shapes [][]int32
+}
+
+var _ LayerState = GraphState{}
+
+func (GraphState) layerState() {}
+
+func NewGraph() *Graph {
+	return &Graph{}
+}
+
+func (g *Graph) addNode(node GraphNode) Node {
+	for _, in := range node.Inputs {
+		assert.True(in >= 0 && int(in) < len(g.Nodes), "Inputs must be nodes of the graph")
+	}
+	g.Nodes = append(g.Nodes, node)
+	return Node(len(g.Nodes) - 1)
+}
+
+// Input adds a new input to the graph.
+func (g *Graph) Input() Node {
+	node := g.addNode(GraphNode{Type: INPUT_NODE})
+	g.Inputs = append(g.Inputs, node)
+	return node
+}
+
+// Layer adds a node applying the layer to the output of another one.
+func (g *Graph) Layer(l Layer, in Node) Node {
+	return g.addNode(GraphNode{Type: LAYER_NODE, Layer: l, Inputs: []Node{in}})
+}
+
+// Add adds a node summing the outputs of others, which must have the same
+// shape.
+func (g *Graph) Add(nodes ...Node) Node {
+	assert.GreaterThanOrEqual(len(nodes), 2, "Must add at least 2 nodes")
+	return g.addNode(GraphNode{Type: ADD_NODE, Inputs: slices.Clone(nodes)})
+}
+
+// Concat adds a node joining the outputs of others along an axis, like 0 for
+// the features of (features x batch) matrices or the channels of images.
+func (g *Graph) Concat(axis int32, nodes ...Node) Node {
+	assert.GreaterThanOrEqual(len(nodes), 2, "Must concatenate at least 2 nodes")
+	assert.GreaterThanOrEqual(axis, 0, "Axis can't be negative")
+	return g.addNode(GraphNode{Type: CONCAT_NODE, Axis: axis, Inputs: slices.Clone(nodes)})
+}
+
+// SetOutputs sets the nodes whose outputs are the graph's.
+func (g *Graph) SetOutputs(nodes ...Node) {
+	g.Outputs = slices.Clone(nodes)
+}
+
+// order returns the nodes in topological order, each after its inputs.
+func (g *Graph) order() ([]Node, error) {
+	// Kahn's algorithm
+	pending := make([]int, len(g.Nodes)) // Inputs not yet in the order
+	consumers := make([][]Node, len(g.Nodes))
+	var order []Node
+	for i, node := range g.Nodes {
+		for _, in := range node.Inputs {
+			if in < 0 || int(in) >= len(g.Nodes) {
+				return nil, formatError("Graph node ", i, " takes the nonexistent node ", in)
+			}
+			consumers[in] = append(consumers[in], Node(i))
+		}
+		pending[i] = len(node.Inputs)
+		if pending[i] == 0 {
+			order = append(order, Node(i))
+		}
+	}
+
+	for i := 0; i < len(order); i++ {
+		for _, consumer := range consumers[order[i]] {
+			pending[consumer]--
+			if pending[consumer] == 0 {
+				order = append(order, consumer)
+			}
+		}
+	}
+	if len(order) != len(g.Nodes) {
+		return nil, formatError("Graph has a cycle")
+	}
+	return order, nil
+}
+
+func (g *Graph) mustOrder() []Node {
+	order, err := g.order()
+	assert.True(err == nil, "Graph must be acyclic")
+	return order
+}
+
+// ForwardAll takes a batch of each of the graph's inputs and returns the
+// graph's outputs.
+func (g *Graph) ForwardAll(inputs []*t.Tensor) ([]*t.Tensor, GraphState) {
+	assert.Equal(len(inputs), len(g.Inputs), "Must give every input")
+
+	outputs := make([]*t.Tensor, len(g.Nodes))
+	state := GraphState{
+		Layers: make([]LayerState, len(g.Nodes)),
+		Shapes: make([][]int32, len(g.Nodes)),
+	}
+	for i, node := range g.Inputs {
+		outputs[node] = inputs[i]
+	}
+
+	for _, n := range g.mustOrder() {
+		node := g.Nodes[n]
+		switch node.Type {
+		case INPUT_NODE:
+			assert.True(outputs[n] != nil, "Input nodes must be graph inputs")
+		case LAYER_NODE:
+			outputs[n], state.Layers[n] = node.Layer.Forward(outputs[node.Inputs[0]])
+		case ADD_NODE:
+			outputs[n] = outputs[node.Inputs[0]].Copy()
+			for _, in := range node.Inputs[1:] {
+				assert.True(slices.Equal(outputs[in].Shape, outputs[n].Shape), "Added nodes must have the same shape")
+				outputs[n].AddInPlace(outputs[in])
+			}
+		case CONCAT_NODE:
+			ins := make([]*t.Tensor, len(node.Inputs))
+			for i, in := range node.Inputs {
+				ins[i] = outputs[in]
+			}
+			outputs[n] = concat(int(node.Axis), ins)
+		}
+		state.Shapes[n] = outputs[n].Shape
+	}
+
+	results := make([]*t.Tensor, len(g.Outputs))
+	for i, node := range g.Outputs {
+		results[i] = outputs[node]
+	}
+	return results, state
+}
+
+// BackwardAll takes the gradient of each of the graph's outputs, nil if it
+// doesn't affect the loss, and returns the parameters' gradient and the
+// gradient of each of the inputs.
+func (g *Graph) BackwardAll(
+	s GraphState,
+	outputGrads []*t.Tensor,
+	gradClipping float64,
+) (*GraphGradient, []*t.Tensor) {
+	assert.Equal(len(outputGrads), len(g.Outputs), "Must give every output's gradient")
+
+	grads := make([]*t.Tensor, len(g.Nodes))
+	for i, node := range g.Outputs {
+		if outputGrads[i] != nil {
+			accumulateGradient(grads, node, outputGrads[i])
+		}
+	}
+	return g.backward(s, grads, gradClipping)
+}
+
+// accumulateGradient adds grad to the gradient of node n, nodes used more
+// than once get the sum of their consumers' gradients.
+func accumulateGradient(grads []*t.Tensor, n Node, grad *t.Tensor) {
+	if grads[n] == nil {
+		grads[n] = grad
+	} else {
+		grads[n] = t.Add(grads[n], grad)
+	}
+}
+
+// backward backpropagates the gradients given for any node, nil for the
+// ones that only affect the loss through other nodes.
+func (g *Graph) backward(
+	s GraphState,
+	grads []*t.Tensor,
+	gradClipping float64,
+) (*GraphGradient, []*t.Tensor) {
+	accumulate := func(n Node, grad *t.Tensor) { accumulateGradient(grads, n, grad) }
+
+	grad := &GraphGradient{Layers: make([]LayerGrad, len(g.Nodes))}
+	order := g.mustOrder()
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		node := g.Nodes[n]
+		if grads[n] == nil { // Doesn't affect any output
+			grads[n] = t.New(s.Shapes[n]...)
+		}
+
+		switch node.Type {
+		case LAYER_NODE:
+			var inGrad *t.Tensor
+			grad.Layers[n], inGrad = node.Layer.ComputeGradients(s.Layers[n], grads[n], gradClipping)
+			accumulate(node.Inputs[0], inGrad)
+		case ADD_NODE:
+			for _, in := range node.Inputs {
+				accumulate(in, grads[n])
+			}
+		case CONCAT_NODE:
+			start := int32(0)
+			for _, in := range node.Inputs {
+				size := s.Shapes[in][node.Axis]
+				accumulate(in, grads[n].Slice(int(node.Axis), start, start+size).Contiguous())
+				start += size
+			}
+		}
+	}
+
+	inputGrads := make([]*t.Tensor, len(g.Inputs))
+	for i, node := range g.Inputs {
+		inputGrads[i] = grads[node]
+	}
+	return grad, inputGrads
+}
+
+// Forward is only valid for graphs with a single input and output.
+func (g *Graph) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	assert.True(len(g.Inputs) == 1 && len(g.Outputs) == 1, "Graph must have a single input and output")
+
+	outputs, state := g.ForwardAll([]*t.Tensor{in})
+	return outputs[0], state
+}
+
+func (g *Graph) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(GraphState)
+	assert.True(ok, "State must match layer type")
+
+	grad, inputGrads := g.BackwardAll(state, []*t.Tensor{nextLayerGrad}, gradClipping)
+	return grad, inputGrads[0]
+}
+
+func (g *Graph) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	gGrad, ok := grad.(*GraphGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	for i, node := range g.Nodes {
+		if node.Type == LAYER_NODE {
+			node.Layer.UpdateParams(gGrad.Layers[i], opt, learningRate)
+		}
+	}
+}
+
+// SetRegularization sets r on every layer of the graph with weights.
+func (g *Graph) SetRegularization(r Regularization) {
+	setRegularization(g.layers(), r)
+}
+
+func (g *Graph) penalty() float64 {
+	return regularizationPenalty(g.layers())
+}
+
+// layers returns the layers of the graph's layer nodes.
+func (g *Graph) layers() []Layer {
+	var layers []Layer
+	for _, node := range g.Nodes {
+		if node.Type == LAYER_NODE {
+			layers = append(layers, node.Layer)
+		}
+	}
+	return layers
+}
+
+func (g *Graph) SetTraining(training bool) {
+	for _, node := range g.Nodes {
+		if l, ok := node.Layer.(TrainingModeLayer); ok {
+			l.SetTraining(training)
+		}
+	}
+}
+
+func (g *Graph) TypeName() string { return "Graph" }
+
+/* Graphs are saved as:
+
+   nodes   int32 count, then for each node its type byte, its layer (with
+           its type, like in a network) or axis if it has one, and its
+           inputs as an int32 count followed by the nodes
+   inputs  int32 count followed by the nodes
+   outputs int32 count followed by the nodes
+*/
+
+func (g *Graph) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, int32(len(g.Nodes)))
+	if err != nil {
+		return err
+	}
+	for _, node := range g.Nodes {
+		err = binary.Write(w, binary.LittleEndian, node.Type)
+		if err != nil {
+			return err
+		}
+		switch node.Type {
+		case LAYER_NODE:
+			err = saveLayer(w, node.Layer)
+		case CONCAT_NODE:
+			err = binary.Write(w, binary.LittleEndian, node.Axis)
+		}
+		if err != nil {
+			return err
+		}
+		err = saveNodes(w, node.Inputs)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = saveNodes(w, g.Inputs)
+	if err != nil {
+		return err
+	}
+	return saveNodes(w, g.Outputs)
+}
+
+func saveNodes(w io.Writer, nodes []Node) error {
+	err := binary.Write(w, binary.LittleEndian, int32(len(nodes)))
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, nodes)
+}
+
+func loadNodes(r io.Reader, nodeCount int32) ([]Node, error) {
+	var count int32
+	err := binary.Read(r, binary.LittleEndian, &count)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count > maxLayers {
+		return nil, formatError("Invalid number of graph nodes: ", count)
+	}
+	nodes := make([]Node, count)
+	err = binary.Read(r, binary.LittleEndian, nodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node < 0 || int32(node) >= nodeCount {
+			return nil, formatError("Graph references the nonexistent node ", node)
+		}
+	}
+	return nodes, nil
+}
+
+// loadGraph loads a graph used as a layer, which must have a single input
+// and output.
+func loadGraph(r io.Reader) (*Graph, error) {
+	g, err := readGraph(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Inputs) != 1 || len(g.Outputs) != 1 {
+		return nil, formatError(
+			"Graph layer with ", len(g.Inputs), " inputs and ", len(g.Outputs),
+			" outputs, only graph networks can have several",
+		)
+	}
+	return g, nil
+}
+
+// readGraph reads what Save writes, with any number of inputs and outputs.
+func readGraph(r io.Reader) (*Graph, error) {
+	var nodeCount int32
+	err := binary.Read(r, binary.LittleEndian, &nodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if nodeCount < 0 || nodeCount > maxLayers {
+		return nil, formatError("Invalid number of graph nodes: ", nodeCount)
+	}
+
+	g := &Graph{Nodes: make([]GraphNode, nodeCount)}
+	for i := range g.Nodes {
+		node := &g.Nodes[i]
+		err = binary.Read(r, binary.LittleEndian, &node.Type)
+		if err != nil {
+			return nil, err
+		}
+		switch node.Type {
+		case INPUT_NODE, ADD_NODE:
+		case LAYER_NODE:
+			node.Layer, err = loadLayer(r)
+		case CONCAT_NODE:
+			err = binary.Read(r, binary.LittleEndian, &node.Axis)
+		default:
+			return nil, formatError("Invalid graph node type found: ", node.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.Inputs, err = loadNodes(r, nodeCount)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs := len(node.Inputs)
+		if (node.Type == INPUT_NODE && inputs != 0) || (node.Type == LAYER_NODE && inputs != 1) ||
+			((node.Type == ADD_NODE || node.Type == CONCAT_NODE) && inputs < 2) || node.Axis < 0 {
+			return nil, formatError("Graph node ", i, " of type ", node.Type, " with ", inputs, " inputs")
+		}
+	}
+
+	g.Inputs, err = loadNodes(r, nodeCount)
+	if err != nil {
+		return nil, err
+	}
+	g.Outputs, err = loadNodes(r, nodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Outputs) == 0 {
+		return nil, formatError("Graph without outputs")
+	}
+
+	// Every input node must be exactly one of the graph's inputs.
+	isInput := make([]bool, nodeCount)
+	for _, node := range g.Inputs {
+		if g.Nodes[node].Type != INPUT_NODE || isInput[node] {
+			return nil, formatError("Graph input ", node, " isn't an input node or is repeated")
+		}
+		isInput[node] = true
+	}
+	for i, node := range g.Nodes {
+		if node.Type == INPUT_NODE && !isInput[i] {
+			return nil, formatError("Graph input node ", i, " isn't one of the graph's inputs")
+		}
+	}
+	_, err = g.order()
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// concat joins tensors along an axis, their other dimensions must match.
+func concat(axis int, ts []*t.Tensor) *t.Tensor {
+	first := ts[0]
+	assert.True(axis < first.Dims()-1, "Can't concatenate along the batch dimension")
+
+	shape := slices.Clone(first.Shape)
+	shape[axis] = 0
+	for _, tensor := range ts {
+		assert.Equal(tensor.Dims(), first.Dims(), "Tensors must have the same dimensions")
+		for d := range shape {
+			assert.True(d == axis || tensor.Shape[d] == first.Shape[d], "Tensors must match outside the axis")
+		}
+		shape[axis] += tensor.Shape[axis]
+	}
+	out := t.New(shape...)
+
+	// Each tensor contributes a block of its size along the axis times the
+	// size of the following dimensions, for every index of the previous ones.
+	outer := int32(1)
+	for _, dim := range shape[:axis] {
+		outer *= dim
+	}
+	data := make([][]float64, len(ts))
+	for i, tensor := range ts {
+		data[i] = tensor.Contiguous().Data
+	}
+	offset := int32(0)
+	for o := range outer {
+		for _, d := range data {
+			block := int32(len(d)) / outer
+			copy(out.Data[offset:offset+block], d[o*block:(o+1)*block])
+			offset += block
+		}
+	}
+	return out
+}
@@ -0,0 +1,233 @@
+package nn
+
+import (
+	"io"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// GraphNetwork trains a Graph with any number of inputs and outputs. The
+// loss is the sum of Loss over every output, outputs computed by a softmax
+// layer get the same fused cross-entropy gradient as NeuralNetwork's.
+type GraphNetwork struct {
+	Graph                 *Graph
+	GradientClippingLimit float64
+	Loss                  Loss
+	Optimizer             Optimizer
+
+	training bool
+	metadata Metadata
+}
+
+type GraphSample struct{ In, Out []*t.Tensor } // One per graph input and output
+
+// NewGraphNetwork uses MSE as its loss and plain SGD as its optimizer, like
+// NewMLP.
+func NewGraphNetwork(g *Graph, gradientClippingLimit float64) *GraphNetwork {
+	_, err := g.order()
+	assert.True(err == nil, "Graph must be acyclic")
+	assert.GreaterThan(len(g.Outputs), 0, "Graph must have outputs")
+
+	return &GraphNetwork{
+		Graph:                 g,
+		GradientClippingLimit: gradientClippingLimit,
+		Loss:                  MSE{},
+		Optimizer:             NewSGD(0, false),
+	}
+}
+
+// optimizer works like NeuralNetwork's, defaulting to plain SGD.
+func (n *GraphNetwork) optimizer() Optimizer {
+	if n.Optimizer == nil {
+		n.Optimizer = NewSGD(0, false)
+	}
+	return n.Optimizer
+}
+
+// loss works like NeuralNetwork's, defaulting to MSE.
+func (n *GraphNetwork) loss() Loss {
+	if n.Loss == nil {
+		return MSE{}
+	}
+	return n.Loss
+}
+
+// Forward takes a batch of each input, with the samples along the last
+// dimension, and returns a batch of each output.
+func (n *GraphNetwork) Forward(inputs ...*t.Tensor) ([]*t.Tensor, GraphState) {
+	return n.Graph.ForwardAll(inputs)
+}
+
+// SetTraining works like NeuralNetwork's.
+func (n *GraphNetwork) SetTraining(training bool) {
+	n.training = training
+	n.Graph.SetTraining(training)
+}
+
+func (n *GraphNetwork) Training() bool {
+	return n.training
+}
+
+// SetRegularization works like NeuralNetwork's.
+func (n *GraphNetwork) SetRegularization(r Regularization) {
+	n.Graph.SetRegularization(r)
+}
+
+// batchGraphSamples stacks each of the samples' inputs and outputs.
+func batchGraphSamples(samples []GraphSample) (ins, outs []*t.Tensor) {
+	stackEach := func(count int, get func(s GraphSample) []*t.Tensor, stack func([]*t.Tensor) *t.Tensor) []*t.Tensor {
+		batches := make([]*t.Tensor, count)
+		for i := range batches {
+			ts := make([]*t.Tensor, len(samples))
+			for j, s := range samples {
+				assert.Equal(len(get(s)), count, "Samples must have a tensor per graph input and output")
+				ts[j] = get(s)[i]
+			}
+			batches[i] = stack(ts)
+		}
+		return batches
+	}
+	ins = stackEach(len(samples[0].In), func(s GraphSample) []*t.Tensor { return s.In }, stack)
+	outs = stackEach(len(samples[0].Out), func(s GraphSample) []*t.Tensor { return s.Out }, stackTargets)
+	return ins, outs
+}
+
+// AverageLoss is always evaluated in inference mode. It includes the layers'
+// regularization penalties.
+func (n *GraphNetwork) AverageLoss(samples []GraphSample) float64 {
+	if n.training {
+		n.SetTraining(false)
+		defer n.SetTraining(true)
+	}
+
+	sum := 0.0
+	for start := 0; start < len(samples); start += evaluationBatchSize {
+		end := min(start+evaluationBatchSize, len(samples))
+		ins, expected := batchGraphSamples(samples[start:end])
+		actual, _ := n.Forward(ins...)
+		for i := range actual {
+			sum += n.loss().Value(actual[i], expected[i])
+		}
+	}
+	return sum/float64(len(samples)) + n.Graph.penalty()
+}
+
+// backpropBatch returns the gradient of the loss summed over the samples.
+func (n *GraphNetwork) backpropBatch(samples []GraphSample) *GraphGradient {
+	ins, expected := batchGraphSamples(samples)
+	actual, state := n.Forward(ins...)
+
+	grads := make([]*t.Tensor, len(n.Graph.Nodes))
+	for i, node := range n.Graph.Outputs {
+		var last Layer
+		if n.Graph.Nodes[node].Type == LAYER_NODE {
+			last = n.Graph.Nodes[node].Layer
+		}
+		lossGrad, fused := outputLossGradient(n.loss(), last, actual[i], expected[i])
+		if fused { // Starts from the softmax's input
+			node = n.Graph.Nodes[node].Inputs[0]
+		}
+		accumulateGradient(grads, node, lossGrad)
+	}
+	grad, _ := n.Graph.backward(state, grads, n.GradientClippingLimit)
+	return grad
+}
+
+// Train trains the network using mini-batch SGD, a batch size of 0 uses
+// every sample at once. The validation samples are optional, and only used
+// to drive the scheduler.
+func (n *GraphNetwork) Train(
+	samples []GraphSample,
+	validation []GraphSample,
+	epochs int,
+	scheduler LRScheduler,
+	batchSize int,
+	verboseEpochs bool,
+) {
+	if batchSize == 0 {
+		batchSize = len(samples)
+	}
+	trainMiniBatches(n, samples, validation, epochs, scheduler, batchSize, verboseEpochs,
+		func(_ int, batch []GraphSample, learningRate float64) {
+			grad := n.backpropBatch(batch)
+			grad.Scale(1.0 / float64(len(batch)))
+			n.Graph.UpdateParams(grad, n.optimizer(), learningRate)
+		},
+	)
+}
+
+// Metadata returns the network's metadata, which can be modified in place.
+func (n *GraphNetwork) Metadata() Metadata {
+	if n.metadata == nil {
+		n.metadata = Metadata{}
+	}
+	return n.metadata
+}
+
+// network returns a NeuralNetwork made of just the graph, sharing n's
+// fields, which is how graph networks are saved.
+func (n *GraphNetwork) network() *NeuralNetwork {
+	return &NeuralNetwork{
+		Layers:                []Layer{n.Graph},
+		GradientClippingLimit: n.GradientClippingLimit,
+		Loss:                  n.Loss,
+		Optimizer:             n.Optimizer,
+		metadata:              n.Metadata(),
+	}
+}
+
+// Save uses the same format as NeuralNetwork, with the graph as its only
+// layer.
+func (n *GraphNetwork) Save(w io.Writer) error {
+	return n.network().Save(w)
+}
+
+// LoadGraphNetwork reads a network saved by GraphNetwork.Save. Unlike Load,
+// which only takes graphs with a single input and output as a layer, it
+// accepts graphs with several.
+func LoadGraphNetwork(r io.Reader) (*GraphNetwork, error) {
+	return graphNetwork(load(r, loadGraphNetworkLayer))
+}
+
+func (n *GraphNetwork) SaveToFile(path string) error {
+	return n.network().SaveToFile(path)
+}
+
+func LoadGraphNetworkFromFile(path string) (*GraphNetwork, error) {
+	return graphNetwork(loadFromFile(path, loadGraphNetworkLayer))
+}
+
+// loadGraphNetworkLayer reads the graph a graph network is saved as.
+func loadGraphNetworkLayer(r io.Reader) (Layer, error) {
+	name, err := readTypeName(r, builtinLayers, CUSTOM_LAYER, "layer")
+	if err != nil {
+		return nil, err
+	}
+	if name != "Graph" {
+		return nil, formatError("Graph network without a graph")
+	}
+	return layerLoader(readGraph)(r)
+}
+
+// graphNetwork converts a loaded network back into a graph network.
+func graphNetwork(nn *NeuralNetwork, err error) (*GraphNetwork, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(nn.Layers) != 1 {
+		return nil, formatError("Graph network with ", len(nn.Layers), " layers")
+	}
+	g, ok := nn.Layers[0].(*Graph)
+	if !ok {
+		return nil, formatError("Graph network without a graph")
+	}
+
+	return &GraphNetwork{
+		Graph:                 g,
+		GradientClippingLimit: nn.GradientClippingLimit,
+		Loss:                  nn.Loss,
+		Optimizer:             nn.Optimizer,
+		metadata:              nn.metadata,
+	}, nil
+}
@@ -0,0 +1,267 @@
+package nn
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// residualBlock returns a graph computing in + FC(FC(in)).
+func residualBlock(features int32) (*Graph, *FullyConnectedLayer, *FullyConnectedLayer) {
+	g := NewGraph()
+	in := g.Input()
+	hidden := NewFullyConnectedLayer(features, 5, Tanh{})
+	output := NewFullyConnectedLayer(5, features, NoActF{})
+	g.SetOutputs(g.Add(in, g.Layer(output, g.Layer(hidden, in))))
+	return g, hidden, output
+}
+
+func TestGraph_ResidualGradients(t *testing.T) {
+	g, hidden, output := residualBlock(3)
+	n := &NeuralNetwork{Layers: []Layer{g}, GradientClippingLimit: 1e9, Loss: MSE{}}
+	samples := []Sample{
+		{In: randomTensor(3, 1), Out: randomTensor(3, 1)},
+		{In: randomTensor(3, 1), Out: randomTensor(3, 1)},
+	}
+
+	grad := n.backpropBatch(samples)[0].(*GraphGradient)
+	checkGradient(t, "hidden weights", n, samples, hidden.Weights, grad.Layers[1].(*FullyConnectedLayerGradient).Weights)
+	checkGradient(t, "output biases", n, samples, output.Biases, grad.Layers[2].(*FullyConnectedLayerGradient).Biases)
+
+	in, expected := batchSamples(samples)
+	checkInputGradient(t, n, in, expected)
+}
+
+func TestGraph_MultipleInputsAndOutputs(t *testing.T) {
+	// Two inputs joined and split into a regression and a classification head,
+	// with the joined features also passed straight to a third output.
+	g := NewGraph()
+	a, b := g.Input(), g.Input()
+	joined := g.Concat(0, g.Layer(NewFullyConnectedLayer(2, 3, Tanh{}), a), b)
+	shared := NewFullyConnectedLayer(7, 4, Sigmoid{})
+	features := g.Layer(shared, joined)
+	regression := g.Layer(NewFullyConnectedLayer(4, 1, NoActF{}), features)
+	g.SetOutputs(regression, g.Layer(NewFullyConnectedLayer(4, 2, Sigmoid{}), features), joined)
+
+	n := NewGraphNetwork(g, 1e9)
+	ins := []*ts.Tensor{randomTensor(2, 3), randomTensor(4, 3)}
+	expected := []*ts.Tensor{randomTensor(1, 3), randomTensor(2, 3), randomTensor(7, 3)}
+
+	outs, state := n.Forward(ins...)
+	for i, want := range [][]int32{{1, 3}, {2, 3}, {7, 3}} {
+		if !slices.Equal(outs[i].Shape, want) {
+			t.Errorf("Forward() output %d shape = %v, want %v", i, outs[i].Shape, want)
+		}
+	}
+	if !ts.Eq(outs[2].Slice(0, 3, 7), ins[1]) {
+		t.Errorf("Forward() concatenation = %v, want %v after the first input's", outs[2].Data, ins[1].Data)
+	}
+
+	totalLoss := func() float64 {
+		outs, _ := n.Forward(ins...)
+		sum := 0.0
+		for i := range outs {
+			sum += n.Loss.Value(outs[i], expected[i])
+		}
+		return sum
+	}
+	lossGrads := make([]*ts.Tensor, len(outs))
+	for i := range outs {
+		lossGrads[i] = n.Loss.Gradient(outs[i], expected[i])
+	}
+	grad, inGrads := g.BackwardAll(state, lossGrads, math.Inf(1))
+
+	const h = 1e-5
+	check := func(name string, values, computed *ts.Tensor) {
+		for i := range values.Data {
+			original := values.Data[i]
+			values.Data[i] = original + h
+			plus := totalLoss()
+			values.Data[i] = original - h
+			minus := totalLoss()
+			values.Data[i] = original
+
+			numerical := (plus - minus) / (2 * h)
+			if math.Abs(numerical-computed.Data[i]) > 1e-5*max(1, math.Abs(numerical)) {
+				t.Errorf("%s gradient[%d] = %v, want %v", name, i, computed.Data[i], numerical)
+			}
+		}
+	}
+	check("shared weights", shared.Weights, grad.Layers[features].(*FullyConnectedLayerGradient).Weights)
+	check("first input", ins[0], inGrads[0])
+	check("second input", ins[1], inGrads[1])
+	if grad.Layers[joined] != nil {
+		t.Errorf("BackwardAll() gradient of a concatenation = %v, want nil", grad.Layers[joined])
+	}
+
+	// Outputs without a gradient are like ones with a zero gradient.
+	_, inGrads = g.BackwardAll(state, []*ts.Tensor{lossGrads[0], nil, nil}, math.Inf(1))
+	_, want := g.BackwardAll(state, []*ts.Tensor{lossGrads[0], ts.New(2, 3), ts.New(7, 3)}, math.Inf(1))
+	for i := range want {
+		if !approxEq(inGrads[i], want[i]) {
+			t.Errorf("BackwardAll() input %d gradient = %v, want %v", i, inGrads[i].Data, want[i].Data)
+		}
+	}
+}
+
+func TestGraphNetwork_Train(t *testing.T) {
+	// Learns to output the sum and difference of two inputs.
+	g := NewGraph()
+	a, b := g.Input(), g.Input()
+	joined := g.Concat(0, a, b)
+	g.SetOutputs(
+		g.Layer(NewFullyConnectedLayer(2, 1, NoActF{}), joined),
+		g.Layer(NewFullyConnectedLayer(2, 1, NoActF{}), joined),
+	)
+	n := NewGraphNetwork(g, 10)
+
+	samples := make([]GraphSample, 64)
+	for i := range samples {
+		x, y := randomTensor(1, 1), randomTensor(1, 1)
+		samples[i] = GraphSample{
+			In:  []*ts.Tensor{x, y},
+			Out: []*ts.Tensor{ts.Add(x, y), ts.Sub(x, y)},
+		}
+	}
+
+	before := n.AverageLoss(samples)
+	n.Train(samples, nil, 100, NewInverseTimeDecay(0.05, 0), 16, false)
+	if after := n.AverageLoss(samples); after > before/100 {
+		t.Errorf("AverageLoss() after training = %v, want well below %v", after, before)
+	}
+	if n.Training() {
+		t.Errorf("Training() after Train() = true, want false")
+	}
+}
+
+func TestGraphNetwork_SoftmaxCrossEntropy(t *testing.T) {
+	// Saturated softmax outputs only get a finite gradient when it's fused
+	// with the cross-entropy, like NeuralNetwork does.
+	fc := NewFullyConnectedLayer(2, 3, NoActF{})
+	fc.Weights.ScaleInPlace(100)
+	g := NewGraph()
+	in := g.Input()
+	hidden := g.Layer(fc, in)
+	g.SetOutputs(g.Layer(NewSoftmaxLayer(), hidden))
+	n := NewGraphNetwork(g, 1e9)
+	n.Loss = CategoricalCrossEntropy{}
+
+	samples := []Sample{
+		{In: ts.ColumnVector(1, -1), Out: ts.ColumnVector(0, 1, 0)},
+		{In: ts.ColumnVector(-2, 1), Out: ts.ColumnVector(1, 0, 0)},
+	}
+	graphSamples := make([]GraphSample, len(samples))
+	for i, s := range samples {
+		graphSamples[i] = GraphSample{In: []*ts.Tensor{s.In}, Out: []*ts.Tensor{s.Out}}
+	}
+	mlp := &NeuralNetwork{Layers: []Layer{fc, NewSoftmaxLayer()}, GradientClippingLimit: 1e9, Loss: CategoricalCrossEntropy{}}
+
+	got := n.backpropBatch(graphSamples).Layers[hidden].(*FullyConnectedLayerGradient).Weights
+	want := mlp.backpropBatch(samples)[0].(*FullyConnectedLayerGradient).Weights
+	if !got.IsFinite() || !approxEq(got, want) {
+		t.Errorf("backpropBatch() weights gradient = %v, want %v", got.Data, want.Data)
+	}
+}
+
+func TestGraph_Order(t *testing.T) {
+	g := NewGraph()
+	// Nodes added out of order still run after their inputs.
+	g.Nodes = []GraphNode{
+		{Type: ADD_NODE, Inputs: []Node{1, 2}},
+		{Type: LAYER_NODE, Layer: NewFullyConnectedLayer(2, 2, ReLU{}), Inputs: []Node{2}},
+		{Type: INPUT_NODE},
+	}
+	g.Inputs, g.Outputs = []Node{2}, []Node{0}
+	order, err := g.order()
+	if err != nil || !slices.Equal(order, []Node{2, 1, 0}) {
+		t.Errorf("order() = %v, %v, want [2 1 0]", order, err)
+	}
+
+	g.Nodes[1].Inputs = []Node{0}
+	if _, err := g.order(); err == nil {
+		t.Errorf("order() of a cycle succeeded")
+	}
+}
+
+func TestGraph_SaveLoad(t *testing.T) {
+	block, _, _ := residualBlock(4)
+	g := NewGraph()
+	a, b := g.Input(), g.Input()
+	joined := g.Concat(0, g.Layer(block, a), b)
+	g.SetOutputs(g.Layer(NewFullyConnectedLayer(6, 2, Sigmoid{}), joined), a)
+	n := NewGraphNetwork(g, 3)
+	n.Loss = Huber{Delta: 1}
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// As a layer it would only fail on Forward.
+	var formatErr *FormatError
+	if _, err := Load(bytes.NewReader(buf.Bytes())); !errors.As(err, &formatErr) {
+		t.Errorf("Load() of a graph with 2 inputs error = %v, want a *FormatError", err)
+	}
+	loaded, err := LoadGraphNetwork(&buf)
+	if err != nil {
+		t.Fatalf("LoadGraphNetwork() error = %v", err)
+	}
+
+	if loaded.GradientClippingLimit != 3 || loaded.Loss != n.Loss {
+		t.Errorf("LoadGraphNetwork() = clipping %v, loss %v", loaded.GradientClippingLimit, loaded.Loss)
+	}
+	if loaded.Metadata()[MetadataArchitecture] != "Graph" {
+		t.Errorf("LoadGraphNetwork() architecture = %q, want \"Graph\"", loaded.Metadata()[MetadataArchitecture])
+	}
+	ins := []*ts.Tensor{randomTensor(4, 3), randomTensor(2, 3)}
+	want, _ := n.Forward(ins...)
+	got, _ := loaded.Forward(ins...)
+	for i := range want {
+		if !ts.Eq(got[i], want[i]) {
+			t.Errorf("LoadGraphNetwork() output %d = %v, want %v", i, got[i].Data, want[i].Data)
+		}
+	}
+}
+
+func TestGraph_LoadInvalid(t *testing.T) {
+	input := GraphNode{Type: INPUT_NODE}
+	layer := GraphNode{Type: LAYER_NODE, Layer: NewFullyConnectedLayer(2, 2, ReLU{}), Inputs: []Node{0}}
+	tests := []struct {
+		name  string
+		graph *Graph
+	}{
+		{"cycle", &Graph{
+			Nodes: []GraphNode{input, {Type: ADD_NODE, Inputs: []Node{0, 2}}, {Type: LAYER_NODE,
+				Layer: NewFullyConnectedLayer(2, 2, ReLU{}), Inputs: []Node{1}}},
+			Inputs: []Node{0}, Outputs: []Node{2},
+		}},
+		{"nonexistent node", &Graph{Nodes: []GraphNode{input, layer}, Inputs: []Node{0}, Outputs: []Node{5}}},
+		{"layer as input", &Graph{Nodes: []GraphNode{input, layer}, Inputs: []Node{1}, Outputs: []Node{1}}},
+		{"unused input node", &Graph{Nodes: []GraphNode{input, layer}, Outputs: []Node{1}}},
+		{"repeated input", &Graph{
+			Nodes:  []GraphNode{input, {Type: ADD_NODE, Inputs: []Node{0, 2}}, input},
+			Inputs: []Node{0, 0}, Outputs: []Node{1},
+		}},
+		{"single input add", &Graph{
+			Nodes:  []GraphNode{input, {Type: ADD_NODE, Inputs: []Node{0}}},
+			Inputs: []Node{0}, Outputs: []Node{1},
+		}},
+		{"no graph outputs", &Graph{Nodes: []GraphNode{input, layer}, Inputs: []Node{0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (&GraphNetwork{Graph: tt.graph, Loss: MSE{}}).Save(&buf); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			_, err := LoadGraphNetwork(&buf)
+			var formatErr *FormatError
+			if !errors.As(err, &formatErr) {
+				t.Errorf("LoadGraphNetwork() error = %v, want a *FormatError", err)
+			}
+		})
+	}
+}
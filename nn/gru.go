@@ -0,0 +1,150 @@
+package nn
+
+import (
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// GRULayer is a gated recurrent unit layer. Its gates are stacked in the
+// order reset, update and candidate, the reset gate only applying to the
+// hidden part of the candidate (x_* and h_* being each gate's input and
+// hidden parts):
+//
+//	r, u = sigmoid(x_r + h_r), sigmoid(x_u + h_u)
+//	n    = tanh(x_n + r * h_n)
+//	h_t  = (1 - u) * n + u * h_(t-1)
+type GRULayer struct {
+	recurrent
+}
+
+var (
+	_ Layer            = &GRULayer{}
+	_ RegularizedLayer = &GRULayer{}
+)
+
+const gruGates = 3
+
+type GRULayerState struct {
+	InputShape      []int32
+	Inputs          []*t.Tensor // Each step's (features x batch) input
+	Hidden          []*t.Tensor // Hidden state before each step, and after the last
+	Gates           []*t.Tensor // Each step's gates, after their activation
+	HiddenCandidate []*t.Tensor // Each step's h_n
+}
+
+var _ LayerState = GRULayerState{}
+
+func (GRULayerState) layerState() {}
+
+func NewGRULayer(inputSize, hiddenSize int32, returnSequences bool) *GRULayer {
+	return &GRULayer{newRecurrent(gruGates, inputSize, hiddenSize, returnSequences)}
+}
+
+func (l *GRULayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	steps := l.splitSteps(in)
+	batchSize := steps[0].Cols()
+	state := GRULayerState{
+		InputShape:      in.Shape,
+		Inputs:          steps,
+		Hidden:          make([]*t.Tensor, len(steps)+1),
+		Gates:           make([]*t.Tensor, len(steps)),
+		HiddenCandidate: make([]*t.Tensor, len(steps)),
+	}
+	state.Hidden[0] = l.initialState(batchSize)
+
+	// Each gate is a block of size elements in the gates' Data.
+	size := int(l.hiddenSize() * batchSize)
+	for s, x := range steps {
+		gates := t.MatMul(l.InputWeights, x).AddInPlace(l.Biases)
+		hiddenPart := t.MatMul(l.HiddenWeights, state.Hidden[s])
+		prevH := state.Hidden[s]
+		h := l.initialState(batchSize)
+
+		for j := range size {
+			r := sigmoid(gates.Data[j] + hiddenPart.Data[j])
+			u := sigmoid(gates.Data[size+j] + hiddenPart.Data[size+j])
+			n := math.Tanh(gates.Data[2*size+j] + r*hiddenPart.Data[2*size+j])
+			gates.Data[j], gates.Data[size+j], gates.Data[2*size+j] = r, u, n
+
+			h.Data[j] = (1-u)*n + u*prevH.Data[j]
+		}
+		state.Gates[s], state.Hidden[s+1] = gates, h
+		state.HiddenCandidate[s] = t.WithData([]int32{l.hiddenSize(), batchSize}, hiddenPart.Data[2*size:])
+	}
+
+	return l.output(state.Hidden[1:]), state
+}
+
+func (l *GRULayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(GRULayerState)
+	assert.True(ok, "State must match layer type")
+
+	grad := l.newGradient()
+	outputGrads := l.outputGrads(nextLayerGrad, len(state.Inputs))
+	inputGrads := make([]*t.Tensor, len(state.Inputs))
+
+	// Gradient of the hidden state coming from the following step
+	var fromNext *t.Tensor
+	for s := len(state.Inputs) - 1; s >= 0; s-- {
+		dh := hiddenGrad(outputGrads[s], fromNext)
+		if dh == nil { // Nothing after this step depends on it
+			inputGrads[s] = t.New(state.Inputs[s].Shape...)
+			continue
+		}
+
+		// Gradient of the gates before their activation
+		gates, prevH, hn := state.Gates[s], state.Hidden[s], state.HiddenCandidate[s]
+		delta := t.New(gates.Shape...)
+		size := len(prevH.Data)
+		for j := range size {
+			r, u, n := gates.Data[j], gates.Data[size+j], gates.Data[2*size+j]
+
+			dn := dh.Data[j] * (1 - u) * (1 - n*n)
+			delta.Data[j] = dn * hn.Data[j] * r * (1 - r)
+			delta.Data[size+j] = dh.Data[j] * (prevH.Data[j] - n) * u * (1 - u)
+			delta.Data[2*size+j] = dn
+		}
+		clipColumns(delta, gradClipping)
+
+		// The reset gate scales the candidate's hidden part.
+		hiddenDelta := delta.Copy()
+		for j := range size {
+			hiddenDelta.Data[2*size+j] *= gates.Data[j]
+		}
+
+		grad.accumulate(delta, hiddenDelta, state.Inputs[s], prevH)
+		inputGrads[s] = t.MatMulTransA(l.InputWeights, delta)
+		fromNext = nil
+		if !l.truncated(s, len(state.Inputs)) {
+			fromNext = t.MatMulTransA(l.HiddenWeights, hiddenDelta)
+			for j := range size {
+				fromNext.Data[j] += dh.Data[j] * gates.Data[size+j]
+			}
+		}
+	}
+
+	grad.assertFinite()
+
+	return grad, inputGrad(inputGrads, state.InputShape)
+}
+
+func (l *GRULayer) TypeName() string { return "GRU" }
+
+func (l *GRULayer) Save(w io.Writer) error {
+	return l.recurrent.save(w)
+}
+
+func loadGRULayer(r io.Reader) (*GRULayer, error) {
+	rec, err := loadRecurrent(r, gruGates)
+	if err != nil {
+		return nil, err
+	}
+	return &GRULayer{rec}, nil
+}
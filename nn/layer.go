@@ -1,9 +1,6 @@
 package nn
 
 import (
-	"encoding/binary"
-	"errors"
-	"fmt"
 	"io"
 
 	t "github.com/ManuelGarciaF/neural-networks/tensor"
@@ -16,11 +13,22 @@ type Layer interface {
 	// ComputeGradients returns the weight gradient for the current layer and the activation gradient for previous layers.
 	ComputeGradients(state LayerState, nextLayerGradient *t.Tensor, gradClipping float64) (LayerGrad, *t.Tensor)
 
-	// UpdateParams updates layer parameters based on gradient.
-	UpdateParams(grads LayerGrad, learningRate float64)
+	// UpdateParams updates layer parameters based on gradient, using the optimizer for each of them.
+	UpdateParams(grads LayerGrad, opt Optimizer, learningRate float64)
 
-	// Serialization methods
-	save(w io.Writer) error // Writes the current layer (including name and constructor params)
+	// TypeName identifies the kind of layer in saved models. Layers defined
+	// outside this package must register it with RegisterLayer.
+	TypeName() string
+
+	// Save writes the layer's constructor params and parameters, which the
+	// loader registered for its TypeName reads back.
+	Save(w io.Writer) error
+}
+
+// TrainingModeLayer is implemented by layers that behave differently while
+// training, the network tells them when that is.
+type TrainingModeLayer interface {
+	SetTraining(training bool)
 }
 
 // LayerGrad stores the gradient for a layer with respect to its parameters.
@@ -29,30 +37,133 @@ type LayerGrad interface {
 	Scale(factor float64)
 }
 
+// noGrad is the gradient of layers without trainable parameters.
+type noGrad struct{}
+
+var _ LayerGrad = noGrad{}
+
+func (noGrad) Add(another LayerGrad) {}
+
+func (noGrad) Scale(factor float64) {}
+
 // LayerState stores the cached values from forwarding to be reused for backpropagation
 type LayerState interface {
 	layerState() // Marker method
 }
 
+// BaseLayerState can be embedded to implement LayerState outside this package.
+type BaseLayerState struct{}
+
+func (BaseLayerState) layerState() {}
+
 type layerType byte
 
 const (
 	FULLY_CONNECTED_LAYER layerType = iota
+	SOFTMAX_LAYER
+	CONV2D_LAYER
+	MAX_POOL2D_LAYER
+	AVG_POOL2D_LAYER
+	FLATTEN_LAYER
+	RESHAPE_LAYER
+	DROPOUT_LAYER
+	BATCH_NORM_LAYER
+	LAYER_NORM_LAYER
+	SIMPLE_RNN_LAYER
+	LSTM_LAYER
+	GRU_LAYER
+	MULTI_HEAD_ATTENTION_LAYER
+	TRANSFORMER_ENCODER_BLOCK
+	SINUSOIDAL_POSITIONAL_ENCODING_LAYER
+	LEARNED_POSITIONAL_ENCODING_LAYER
+	EMBEDDING_LAYER
+	GRAPH_LAYER
+	PRELU_LAYER
+
+	CUSTOM_LAYER layerType = 255 // Followed by the name
 )
 
+// Built-in layers are saved as a single byte, like older files did.
+var builtinLayers = []string{
+	FULLY_CONNECTED_LAYER:                "FullyConnected",
+	SOFTMAX_LAYER:                        "Softmax",
+	CONV2D_LAYER:                         "Conv2D",
+	MAX_POOL2D_LAYER:                     "MaxPool2D",
+	AVG_POOL2D_LAYER:                     "AvgPool2D",
+	FLATTEN_LAYER:                        "Flatten",
+	RESHAPE_LAYER:                        "Reshape",
+	DROPOUT_LAYER:                        "Dropout",
+	BATCH_NORM_LAYER:                     "BatchNorm",
+	LAYER_NORM_LAYER:                     "LayerNorm",
+	SIMPLE_RNN_LAYER:                     "SimpleRNN",
+	LSTM_LAYER:                           "LSTM",
+	GRU_LAYER:                            "GRU",
+	MULTI_HEAD_ATTENTION_LAYER:           "MultiHeadAttention",
+	TRANSFORMER_ENCODER_BLOCK:            "TransformerEncoderBlock",
+	SINUSOIDAL_POSITIONAL_ENCODING_LAYER: "SinusoidalPositionalEncoding",
+	LEARNED_POSITIONAL_ENCODING_LAYER:    "LearnedPositionalEncoding",
+	EMBEDDING_LAYER:                      "Embedding",
+	GRAPH_LAYER:                          "Graph",
+	PRELU_LAYER:                          "PReLU",
+}
+
+func init() {
+	RegisterLayer("FullyConnected", layerLoader(loadFullyConnectedLayer))
+	RegisterLayer("Softmax", func(io.Reader) (Layer, error) { return NewSoftmaxLayer(), nil })
+	RegisterLayer("Conv2D", layerLoader(loadConv2DLayer))
+	RegisterLayer("MaxPool2D", layerLoader(loadMaxPool2DLayer))
+	RegisterLayer("AvgPool2D", layerLoader(loadAvgPool2DLayer))
+	RegisterLayer("Flatten", layerLoader(loadFlattenLayer))
+	RegisterLayer("Reshape", layerLoader(loadReshapeLayer))
+	RegisterLayer("Dropout", layerLoader(loadDropoutLayer))
+	RegisterLayer("BatchNorm", layerLoader(loadBatchNormLayer))
+	RegisterLayer("LayerNorm", layerLoader(loadLayerNormLayer))
+	RegisterLayer("SimpleRNN", layerLoader(loadSimpleRNNLayer))
+	RegisterLayer("LSTM", layerLoader(loadLSTMLayer))
+	RegisterLayer("GRU", layerLoader(loadGRULayer))
+	RegisterLayer("MultiHeadAttention", layerLoader(loadMultiHeadAttentionLayer))
+	RegisterLayer("TransformerEncoderBlock", layerLoader(loadTransformerEncoderBlock))
+	RegisterLayer("SinusoidalPositionalEncoding", func(io.Reader) (Layer, error) {
+		return NewSinusoidalPositionalEncodingLayer(), nil
+	})
+	RegisterLayer("LearnedPositionalEncoding", layerLoader(loadLearnedPositionalEncodingLayer))
+	RegisterLayer("Embedding", layerLoader(loadEmbeddingLayer))
+	RegisterLayer("Graph", layerLoader(loadGraph))
+	RegisterLayer("PReLU", layerLoader(loadPReLULayer))
+}
+
+// layerLoader adapts the load function of a specific layer type.
+func layerLoader[L Layer](load func(r io.Reader) (L, error)) LayerLoader {
+	return func(r io.Reader) (Layer, error) {
+		l, err := load(r)
+		if err != nil {
+			return nil, err // Not a nil L wrapped in an interface
+		}
+		return l, nil
+	}
+}
+
+func saveLayer(w io.Writer, l Layer) error {
+	err := writeTypeName(w, l.TypeName(), builtinLayers, CUSTOM_LAYER)
+	if err != nil {
+		return err
+	}
+	return l.Save(w)
+}
+
 func loadLayer(r io.Reader) (Layer, error) {
 	// Read type of layer
-	var t layerType
-	err := binary.Read(r, binary.LittleEndian, &t)
+	name, err := readTypeName(r, builtinLayers, CUSTOM_LAYER, "layer")
 	if err != nil {
 		return nil, err
 	}
 
 	// Call layer specific load function
-	switch layerType(t) {
-	case FULLY_CONNECTED_LAYER:
-		return loadFullyConnectedLayer(r)
-	default:
-		return nil, errors.New(fmt.Sprint("Invalid layer type found: ", t))
+	registryLock.RLock()
+	loader, ok := layerLoaders[name]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, formatError("Unregistered layer type found: ", name)
 	}
+	return loader(r)
 }
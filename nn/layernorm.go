@@ -0,0 +1,204 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// LayerNormLayer normalizes the features of each sample to zero mean and unit
+// variance, followed by a learnable scale (Gamma) and shift (Beta). Features
+// are the dimension right before the batch, so (features x batch) inputs
+// are normalized per sample and (steps x features x batch) sequences per
+// step. Unlike BatchNormLayer it behaves the same while training.
+type LayerNormLayer struct {
+	Gamma   *t.Tensor // Features length vector
+	Beta    *t.Tensor // Features length vector
+	Epsilon float64   // Added to the variance to avoid dividing by 0
+}
+
+var _ Layer = &LayerNormLayer{}
+
+type LayerNormLayerGradient struct {
+	Gamma *t.Tensor
+	Beta  *t.Tensor
+}
+
+var _ LayerGrad = &LayerNormLayerGradient{}
+
+func (g *LayerNormLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*LayerNormLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.Gamma.AddInPlace(g2.Gamma)
+	g.Beta.AddInPlace(g2.Beta)
+}
+
+func (g *LayerNormLayerGradient) Scale(factor float64) {
+	g.Gamma.ScaleInPlace(factor)
+	g.Beta.ScaleInPlace(factor)
+}
+
+type LayerNormLayerState struct {
+	Normalized *t.Tensor // Input before scaling and shifting
+	InvStd     []float64 // 1/sqrt(var + epsilon) of each normalized group
+}
+
+var _ LayerState = LayerNormLayerState{}
+
+func (LayerNormLayerState) layerState() {}
+
+func NewLayerNormLayer(features int32) *LayerNormLayer {
+	l := &LayerNormLayer{
+		Gamma:   t.New(features, 1),
+		Beta:    t.New(features, 1),
+		Epsilon: 1e-5,
+	}
+	for i := range l.Gamma.Data {
+		l.Gamma.Data[i] = 1
+	}
+	return l
+}
+
+// forEachGroup calls f with the indices into Data of every group of values
+// normalized together, ordered by feature.
+func (l *LayerNormLayer) forEachGroup(shape []int32, f func(group int, indices []int32)) {
+	features, batchSize := shape[len(shape)-2], shape[len(shape)-1]
+	outer := int32(1)
+	for _, dim := range shape[:len(shape)-2] {
+		outer *= dim
+	}
+
+	indices := make([]int32, features)
+	for o := range outer {
+		for n := range batchSize {
+			for feat := range features {
+				indices[feat] = (o*features+feat)*batchSize + n
+			}
+			f(int(o*batchSize+n), indices)
+		}
+	}
+}
+
+func (l *LayerNormLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	assert.GreaterThanOrEqual(in.Dims(), 2, "Input must have a batch dimension")
+	assert.Equal(in.Dim(in.Dims()-2), l.Gamma.Rows(), "Input must have the right number of features")
+
+	out := in.Copy()
+	state := LayerNormLayerState{
+		Normalized: t.New(out.Shape...),
+		InvStd:     make([]float64, out.Size()/l.Gamma.Rows()),
+	}
+
+	values := make([]float64, l.Gamma.Rows())
+	l.forEachGroup(out.Shape, func(group int, indices []int32) {
+		for feat, i := range indices {
+			values[feat] = out.Data[i]
+		}
+		mean, variance := meanAndVariance(values)
+		invStd := 1 / math.Sqrt(variance+l.Epsilon)
+		state.InvStd[group] = invStd
+
+		for feat, i := range indices {
+			normalized := (values[feat] - mean) * invStd
+			state.Normalized.Data[i] = normalized
+			out.Data[i] = l.Gamma.Data[feat]*normalized + l.Beta.Data[feat]
+		}
+	})
+
+	return out, state
+}
+
+func (l *LayerNormLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(LayerNormLayerState)
+	assert.True(ok, "State must match layer type")
+
+	prevLayerGrad := nextLayerGrad.Copy()
+	grad := &LayerNormLayerGradient{
+		Gamma: t.New(l.Gamma.Shape...),
+		Beta:  t.New(l.Beta.Shape...),
+	}
+
+	// Same as BatchNormLayer's, but over the features instead of the batch:
+	// dx_i = invStd * (dx^_i - mean(dx^) - x^_i * mean(dx^ * x^))
+	features := float64(l.Gamma.Rows())
+	normalizedGrad := make([]float64, l.Gamma.Rows())
+	l.forEachGroup(prevLayerGrad.Shape, func(group int, indices []int32) {
+		sum, sumNormalized := 0.0, 0.0
+		for feat, i := range indices {
+			dy, normalized := prevLayerGrad.Data[i], state.Normalized.Data[i]
+			grad.Gamma.Data[feat] += dy * normalized
+			grad.Beta.Data[feat] += dy
+
+			normalizedGrad[feat] = dy * l.Gamma.Data[feat]
+			sum += normalizedGrad[feat]
+			sumNormalized += normalizedGrad[feat] * normalized
+		}
+		for feat, i := range indices {
+			normalized := state.Normalized.Data[i]
+			prevLayerGrad.Data[i] = state.InvStd[group] *
+				(normalizedGrad[feat] - sum/features - normalized*sumNormalized/features)
+		}
+	})
+
+	assert.True(grad.Gamma.IsFinite(), "Grad must be finite")
+	assert.True(grad.Beta.IsFinite(), "Grad must be finite")
+
+	return grad, prevLayerGrad
+}
+
+func (l *LayerNormLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	lnGrad, ok := grad.(*LayerNormLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	opt.Update(l.Gamma, lnGrad.Gamma, learningRate)
+	opt.Update(l.Beta, lnGrad.Beta, learningRate)
+}
+
+// The normalized dimension might not be the first one, which never changes.
+func (l *LayerNormLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *LayerNormLayer) TypeName() string { return "LayerNorm" }
+
+func (l *LayerNormLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, l.Epsilon)
+	if err != nil {
+		return err
+	}
+	err = l.Gamma.Save(w)
+	if err != nil {
+		return err
+	}
+	return l.Beta.Save(w)
+}
+
+func loadLayerNormLayer(r io.Reader) (*LayerNormLayer, error) {
+	var epsilon float64
+	err := binary.Read(r, binary.LittleEndian, &epsilon)
+	if err != nil {
+		return nil, err
+	}
+	gamma, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	beta, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if !isFeatureVector(gamma, gamma.Dim(0)) || !isFeatureVector(beta, gamma.Dim(0)) || !(epsilon >= 0) {
+		return nil, formatError("LayerNorm layer with gamma ", gamma.Shape, ", beta ", beta.Shape, " and epsilon ", epsilon)
+	}
+	return &LayerNormLayer{Gamma: gamma, Beta: beta, Epsilon: epsilon}, nil
+}
@@ -0,0 +1,65 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestLayerNormLayer_Forward(t *testing.T) {
+	l := NewLayerNormLayer(4)
+	// 3 steps of 4 features, 2 samples. Spread out so Epsilon is negligible.
+	in := randomTensor(3, 4, 2).ScaleInPlace(100)
+
+	out, _ := l.Forward(in)
+	mean, variance := out.Mean(1, false), out.Var(1, false)
+	for i := range mean.Data {
+		if math.Abs(mean.Data[i]) > 1e-9 || math.Abs(variance.Data[i]-1) > 1e-3 {
+			t.Errorf("Forward() group %d has mean %v and variance %v, want 0 and 1", i, mean.Data[i], variance.Data[i])
+		}
+	}
+}
+
+func TestLayerNormLayer_Gradients(t *testing.T) {
+	tests := []struct {
+		name    string
+		inShape []int32
+	}{
+		{"dense", []int32{5}},
+		{"sequence", []int32{3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLayerNormLayer(5)
+			l.Gamma = randomTensor(5, 1)
+			l.Beta = randomTensor(5, 1)
+			n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+			samples := make([]Sample, 3)
+			for i := range samples {
+				samples[i] = Sample{In: randomTensor(tt.inShape...), Out: randomTensor(tt.inShape...)}
+			}
+
+			grad := n.backpropBatch(samples)[0].(*LayerNormLayerGradient)
+			checkGradient(t, "gamma", n, samples, l.Gamma, grad.Gamma)
+			checkGradient(t, "beta", n, samples, l.Beta, grad.Beta)
+
+			in, expected := batchSamples(samples)
+			checkInputGradient(t, n, in, expected)
+		})
+	}
+}
+
+func TestLayerNormLayer_SaveLoad(t *testing.T) {
+	l := NewLayerNormLayer(3)
+	l.Gamma, l.Beta = randomTensor(3, 1), randomTensor(3, 1)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+
+	l2, ok := loaded.Layers[0].(*LayerNormLayer)
+	if !ok || !ts.Eq(l.Gamma, l2.Gamma) || !ts.Eq(l.Beta, l2.Beta) || l.Epsilon != l2.Epsilon {
+		t.Errorf("Load() = %+v, want %+v", loaded.Layers[0], l)
+	}
+}
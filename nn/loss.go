@@ -0,0 +1,233 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+type lossType byte
+
+const (
+	MSE_LOSS lossType = iota
+	MAE_LOSS
+	HUBER_LOSS
+	BINARY_CROSS_ENTROPY_LOSS
+	CATEGORICAL_CROSS_ENTROPY_LOSS
+)
+
+// Probabilities are clamped to [epsilon, 1-epsilon] before taking logs so
+// cross-entropy never returns infinities.
+const epsilon = 1e-12
+
+// Loss measures how far the network's output is from the expected one.
+type Loss interface {
+	// Value returns the loss summed over every element of the output.
+	Value(output, expected *t.Tensor) float64
+
+	// Gradient returns dL/da for each element of the output.
+	Gradient(output, expected *t.Tensor) *t.Tensor
+
+	lossType() lossType
+}
+
+func saveLoss(w io.Writer, l Loss) error {
+	err := binary.Write(w, binary.LittleEndian, l.lossType())
+	if err != nil {
+		return err
+	}
+
+	// Huber is the only loss with parameters.
+	if h, ok := l.(Huber); ok {
+		return binary.Write(w, binary.LittleEndian, h.Delta)
+	}
+	return nil
+}
+
+func loadLoss(r io.Reader) (Loss, error) {
+	var lt lossType
+	err := binary.Read(r, binary.LittleEndian, &lt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch lt {
+	case MSE_LOSS:
+		return MSE{}, nil
+	case MAE_LOSS:
+		return MAE{}, nil
+	case HUBER_LOSS:
+		var h Huber
+		err = binary.Read(r, binary.LittleEndian, &h.Delta)
+		if err != nil {
+			return nil, err
+		}
+		if !(h.Delta > 0) {
+			return nil, formatError("Huber loss with invalid delta ", h.Delta)
+		}
+		return h, nil
+	case BINARY_CROSS_ENTROPY_LOSS:
+		return BinaryCrossEntropy{}, nil
+	case CATEGORICAL_CROSS_ENTROPY_LOSS:
+		return CategoricalCrossEntropy{}, nil
+	default:
+		return nil, formatError("Invalid loss type found: ", lt)
+	}
+}
+
+// MSE Squared error, averaged over samples by NeuralNetwork.AverageLoss.
+type MSE struct{}
+
+var _ Loss = MSE{}
+
+func (MSE) lossType() lossType { return MSE_LOSS }
+
+func (MSE) Value(output, expected *t.Tensor) float64 {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	sum := 0.0
+	for i, a := range output.Data {
+		sum += (a - expected.Data[i]) * (a - expected.Data[i])
+	}
+	return sum
+}
+
+func (MSE) Gradient(output, expected *t.Tensor) *t.Tensor {
+	// dL/da_k = 2*(a_k - y_k)
+	return t.ScalarMult(t.Sub(output, expected), 2)
+}
+
+// MAE Absolute error, less sensitive to outliers than MSE.
+type MAE struct{}
+
+var _ Loss = MAE{}
+
+func (MAE) lossType() lossType { return MAE_LOSS }
+
+func (MAE) Value(output, expected *t.Tensor) float64 {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	sum := 0.0
+	for i, a := range output.Data {
+		sum += math.Abs(a - expected.Data[i])
+	}
+	return sum
+}
+
+func (MAE) Gradient(output, expected *t.Tensor) *t.Tensor {
+	grad := t.Sub(output, expected)
+	for i, v := range grad.Data {
+		switch {
+		case v > 0:
+			grad.Data[i] = 1
+		case v < 0:
+			grad.Data[i] = -1
+		default:
+			grad.Data[i] = 0
+		}
+	}
+	return grad
+}
+
+// Huber Quadratic for errors smaller than Delta, linear past it.
+type Huber struct {
+	Delta float64
+}
+
+var _ Loss = Huber{}
+
+func (Huber) lossType() lossType { return HUBER_LOSS }
+
+func (h Huber) Value(output, expected *t.Tensor) float64 {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+	assert.GreaterThan(h.Delta, 0, "Delta must be positive")
+
+	sum := 0.0
+	for i, a := range output.Data {
+		diff := math.Abs(a - expected.Data[i])
+		if diff <= h.Delta {
+			sum += 0.5 * diff * diff
+		} else {
+			sum += h.Delta * (diff - 0.5*h.Delta)
+		}
+	}
+	return sum
+}
+
+func (h Huber) Gradient(output, expected *t.Tensor) *t.Tensor {
+	assert.GreaterThan(h.Delta, 0, "Delta must be positive")
+
+	grad := t.Sub(output, expected)
+	for i, v := range grad.Data {
+		grad.Data[i] = max(-h.Delta, min(h.Delta, v))
+	}
+	return grad
+}
+
+// BinaryCrossEntropy For outputs in (0, 1), like the ones produced by
+// Sigmoid, each treated as an independent probability.
+type BinaryCrossEntropy struct{}
+
+var _ Loss = BinaryCrossEntropy{}
+
+func (BinaryCrossEntropy) lossType() lossType { return BINARY_CROSS_ENTROPY_LOSS }
+
+func (BinaryCrossEntropy) Value(output, expected *t.Tensor) float64 {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	sum := 0.0
+	for i, a := range output.Data {
+		p := clampProbability(a)
+		y := expected.Data[i]
+		sum -= y*math.Log(p) + (1-y)*math.Log(1-p)
+	}
+	return sum
+}
+
+func (BinaryCrossEntropy) Gradient(output, expected *t.Tensor) *t.Tensor {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	// dL/da_k = (a_k - y_k) / (a_k * (1 - a_k))
+	grad := output.Copy()
+	for i, a := range output.Data {
+		p := clampProbability(a)
+		grad.Data[i] = (p - expected.Data[i]) / (p * (1 - p))
+	}
+	return grad
+}
+
+// CategoricalCrossEntropy For outputs forming a probability distribution,
+// with one-hot (or otherwise normalized) expected outputs.
+type CategoricalCrossEntropy struct{}
+
+var _ Loss = CategoricalCrossEntropy{}
+
+func (CategoricalCrossEntropy) lossType() lossType { return CATEGORICAL_CROSS_ENTROPY_LOSS }
+
+func (CategoricalCrossEntropy) Value(output, expected *t.Tensor) float64 {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	sum := 0.0
+	for i, a := range output.Data {
+		sum -= expected.Data[i] * math.Log(clampProbability(a))
+	}
+	return sum
+}
+
+func (CategoricalCrossEntropy) Gradient(output, expected *t.Tensor) *t.Tensor {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	// dL/da_k = -y_k / a_k
+	grad := output.Copy()
+	for i, a := range output.Data {
+		grad.Data[i] = -expected.Data[i] / clampProbability(a)
+	}
+	return grad
+}
+
+func clampProbability(p float64) float64 {
+	return max(epsilon, min(1-epsilon, p))
+}
@@ -0,0 +1,72 @@
+package nn
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestLoss_Gradient(t *testing.T) {
+	tests := []struct {
+		name     string
+		loss     Loss
+		output   *ts.Tensor
+		expected *ts.Tensor
+	}{
+		{"MSE", MSE{}, ts.ColumnVector(0.5, -1, 2), ts.ColumnVector(1, 0, 2.5)},
+		{"MAE", MAE{}, ts.ColumnVector(0.5, -1, 2), ts.ColumnVector(1, 0, 2.5)},
+		{"Huber", Huber{Delta: 1}, ts.ColumnVector(0.5, -1, 4), ts.ColumnVector(1, 0, 2)},
+		{"BinaryCrossEntropy", BinaryCrossEntropy{}, ts.ColumnVector(0.2, 0.7, 0.9), ts.ColumnVector(0, 1, 1)},
+		{"CategoricalCrossEntropy", CategoricalCrossEntropy{}, ts.ColumnVector(0.2, 0.7, 0.1), ts.ColumnVector(0, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grad := tt.loss.Gradient(tt.output, tt.expected)
+
+			// Compare against central differences
+			const h = 1e-6
+			for i := range tt.output.Data {
+				plus := tt.output.Copy()
+				plus.Data[i] += h
+				minus := tt.output.Copy()
+				minus.Data[i] -= h
+				numerical := (tt.loss.Value(plus, tt.expected) - tt.loss.Value(minus, tt.expected)) / (2 * h)
+
+				if math.Abs(numerical-grad.Data[i]) > 1e-4 {
+					t.Errorf("Gradient()[%d] = %v, want %v", i, grad.Data[i], numerical)
+				}
+			}
+		})
+	}
+}
+
+func TestNeuralNetwork_SaveLoadLoss(t *testing.T) {
+	n := NewMLP([]int32{2, 3, 1}, Sigmoid{}, NoActF{}, 1.0)
+	n.Loss = Huber{Delta: 0.5}
+
+	loaded := saveAndLoad(t, n)
+	if loaded.Loss != n.Loss {
+		t.Errorf("Load().Loss = %v, want %v", loaded.Loss, n.Loss)
+	}
+}
+
+func TestNeuralNetwork_DefaultLoss(t *testing.T) {
+	// Networks built without NewMLP have no loss set, they use MSE.
+	n := &NeuralNetwork{Layers: []Layer{NewFullyConnectedLayer(2, 1, NoActF{})}}
+	samples := []Sample{{In: randomTensor(2, 1), Out: randomTensor(1, 1)}}
+
+	out, _ := n.Forward(samples[0].In)
+	if got, want := n.AverageLoss(samples), (MSE{}).Value(out, samples[0].Out); got != want {
+		t.Errorf("AverageLoss() = %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if loaded, err := Load(&buf); err != nil || loaded.Loss != (MSE{}) {
+		t.Errorf("Load() = %v, %v, want MSE loss", loaded, err)
+	}
+}
@@ -0,0 +1,159 @@
+package nn
+
+import (
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// LSTMLayer is a long short-term memory recurrent layer. Its gates are
+// stacked in the order input, forget, cell and output:
+//
+//	i, f, o = sigmoid(z_i), sigmoid(z_f), sigmoid(z_o)
+//	g       = tanh(z_g)
+//	c_t     = f * c_(t-1) + i * g
+//	h_t     = o * tanh(c_t)
+type LSTMLayer struct {
+	recurrent
+}
+
+var (
+	_ Layer            = &LSTMLayer{}
+	_ RegularizedLayer = &LSTMLayer{}
+)
+
+const lstmGates = 4
+
+type LSTMLayerState struct {
+	InputShape []int32
+	Inputs     []*t.Tensor // Each step's (features x batch) input
+	Hidden     []*t.Tensor // Hidden state before each step, and after the last
+	Cells      []*t.Tensor // Cell state before each step, and after the last
+	Gates      []*t.Tensor // Each step's gates, after their activation
+}
+
+var _ LayerState = LSTMLayerState{}
+
+func (LSTMLayerState) layerState() {}
+
+func NewLSTMLayer(inputSize, hiddenSize int32, returnSequences bool) *LSTMLayer {
+	l := &LSTMLayer{newRecurrent(lstmGates, inputSize, hiddenSize, returnSequences)}
+
+	// Starting with the forget gate open helps remembering.
+	for i := hiddenSize; i < 2*hiddenSize; i++ {
+		l.Biases.Data[i] = 1
+	}
+	return l
+}
+
+func (l *LSTMLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	steps := l.splitSteps(in)
+	batchSize := steps[0].Cols()
+	state := LSTMLayerState{
+		InputShape: in.Shape,
+		Inputs:     steps,
+		Hidden:     make([]*t.Tensor, len(steps)+1),
+		Cells:      make([]*t.Tensor, len(steps)+1),
+		Gates:      make([]*t.Tensor, len(steps)),
+	}
+	state.Hidden[0] = l.initialState(batchSize)
+	state.Cells[0] = l.initialState(batchSize)
+
+	// Each gate is a block of size elements in the gates' Data.
+	size := int(l.hiddenSize() * batchSize)
+	for s, x := range steps {
+		gates := t.MatMul(l.InputWeights, x).AddInPlace(t.MatMul(l.HiddenWeights, state.Hidden[s]))
+		gates.AddInPlace(l.Biases)
+		c := l.initialState(batchSize)
+		h := l.initialState(batchSize)
+
+		for j := range size {
+			i := sigmoid(gates.Data[j])
+			f := sigmoid(gates.Data[size+j])
+			g := math.Tanh(gates.Data[2*size+j])
+			o := sigmoid(gates.Data[3*size+j])
+			gates.Data[j], gates.Data[size+j], gates.Data[2*size+j], gates.Data[3*size+j] = i, f, g, o
+
+			c.Data[j] = f*state.Cells[s].Data[j] + i*g
+			h.Data[j] = o * math.Tanh(c.Data[j])
+		}
+		state.Gates[s], state.Cells[s+1], state.Hidden[s+1] = gates, c, h
+	}
+
+	return l.output(state.Hidden[1:]), state
+}
+
+func (l *LSTMLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(LSTMLayerState)
+	assert.True(ok, "State must match layer type")
+
+	grad := l.newGradient()
+	outputGrads := l.outputGrads(nextLayerGrad, len(state.Inputs))
+	inputGrads := make([]*t.Tensor, len(state.Inputs))
+
+	// Gradients of the hidden and cell states coming from the following step
+	var fromNext, cellFromNext *t.Tensor
+	for s := len(state.Inputs) - 1; s >= 0; s-- {
+		dh := hiddenGrad(outputGrads[s], fromNext)
+		if dh == nil { // Nothing after this step depends on it
+			inputGrads[s] = t.New(state.Inputs[s].Shape...)
+			continue
+		}
+
+		// Gradient of the gates before their activation
+		gates, c, prevC := state.Gates[s], state.Cells[s+1], state.Cells[s]
+		delta := t.New(gates.Shape...)
+		dPrevC := t.New(c.Shape...)
+		size := len(c.Data)
+		for j := range size {
+			i, f, g, o := gates.Data[j], gates.Data[size+j], gates.Data[2*size+j], gates.Data[3*size+j]
+			tc := math.Tanh(c.Data[j])
+
+			dc := dh.Data[j] * o * (1 - tc*tc)
+			if cellFromNext != nil {
+				dc += cellFromNext.Data[j]
+			}
+			delta.Data[j] = dc * g * i * (1 - i)
+			delta.Data[size+j] = dc * prevC.Data[j] * f * (1 - f)
+			delta.Data[2*size+j] = dc * i * (1 - g*g)
+			delta.Data[3*size+j] = dh.Data[j] * tc * o * (1 - o)
+			dPrevC.Data[j] = dc * f
+		}
+		clipColumns(delta, gradClipping)
+
+		grad.accumulate(delta, delta, state.Inputs[s], state.Hidden[s])
+		inputGrads[s] = t.MatMulTransA(l.InputWeights, delta)
+		fromNext, cellFromNext = nil, nil
+		if !l.truncated(s, len(state.Inputs)) {
+			fromNext, cellFromNext = t.MatMulTransA(l.HiddenWeights, delta), dPrevC
+		}
+	}
+
+	grad.assertFinite()
+
+	return grad, inputGrad(inputGrads, state.InputShape)
+}
+
+func (l *LSTMLayer) TypeName() string { return "LSTM" }
+
+func (l *LSTMLayer) Save(w io.Writer) error {
+	return l.recurrent.save(w)
+}
+
+func loadLSTMLayer(r io.Reader) (*LSTMLayer, error) {
+	rec, err := loadRecurrent(r, lstmGates)
+	if err != nil {
+		return nil, err
+	}
+	return &LSTMLayer{rec}, nil
+}
+
+func sigmoid(v float64) float64 {
+	return Sigmoid{}.Apply(v)
+}
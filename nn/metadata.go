@@ -0,0 +1,257 @@
+package nn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+// Metadata is the key/value information saved in a model file's header, next
+// to the weights. Besides the keys below, anything else can be stored, like
+// free-form tags for the model.
+type Metadata map[string]string
+
+// Well known metadata keys. Save fills in the architecture, loss, optimizer
+// and creation time in the file, and the training methods the training
+// parameters.
+const (
+	MetadataArchitecture       = "architecture"
+	MetadataInputShape         = "input_shape" // Of a single sample, see InputShape
+	MetadataLabels             = "labels"      // One per line, see Labels
+	MetadataInputNormalization = "input_normalization"
+	MetadataLoss               = "loss"
+	MetadataOptimizer          = "optimizer"
+	MetadataTraining           = "training"
+	MetadataCreated            = "created" // RFC 3339
+)
+
+// Labels returns the name of each output, if they were set.
+func (m Metadata) Labels() []string {
+	labels, ok := m[MetadataLabels]
+	if !ok {
+		return nil
+	}
+	return strings.Split(labels, "\n")
+}
+
+// SetLabels names each of the outputs, they can't contain newlines.
+func (m Metadata) SetLabels(labels ...string) {
+	for _, label := range labels {
+		assert.False(strings.Contains(label, "\n"), "Labels can't contain newlines")
+	}
+	m[MetadataLabels] = strings.Join(labels, "\n")
+}
+
+// InputShape returns the shape of a single input sample (without the batch
+// dimension), if it was set.
+func (m Metadata) InputShape() ([]int32, bool) {
+	value, ok := m[MetadataInputShape]
+	if !ok {
+		return nil, false
+	}
+	dims := strings.Split(value, "x")
+	shape := make([]int32, len(dims))
+	for i, dim := range dims {
+		size, err := strconv.ParseInt(dim, 10, 32)
+		if err != nil || size <= 0 {
+			return nil, false
+		}
+		shape[i] = int32(size)
+	}
+	return shape, true
+}
+
+// SetInputShape records the shape of a single input sample, like
+// SetInputShape(1, 28, 28) for grayscale images, saved as "1x28x28".
+func (m Metadata) SetInputShape(shape ...int32) {
+	dims := make([]string, len(shape))
+	for i, dim := range shape {
+		assert.GreaterThan(dim, 0, "Dimensions must be positive")
+		dims[i] = fmt.Sprint(dim)
+	}
+	m[MetadataInputShape] = strings.Join(dims, "x")
+}
+
+// Created returns when the model was first saved.
+func (m Metadata) Created() (time.Time, bool) {
+	created, err := time.Parse(time.RFC3339, m[MetadataCreated])
+	return created, err == nil
+}
+
+// Metadata returns the network's metadata, which can be modified in place.
+func (n *NeuralNetwork) Metadata() Metadata {
+	if n.metadata == nil {
+		n.metadata = Metadata{}
+	}
+	return n.metadata
+}
+
+// savedMetadata returns a copy of the metadata with the keys describing the
+// network filled in, which is what Save writes. The network's own metadata
+// isn't modified, training may be writing to it.
+func (n *NeuralNetwork) savedMetadata() Metadata {
+	m := maps.Clone(n.Metadata())
+
+	layers := make([]string, len(n.Layers))
+	for i, l := range n.Layers {
+		layers[i] = l.TypeName()
+		if fl, ok := l.(featureLayer); ok {
+			if in, out := fl.features(); in != -1 && out != -1 {
+				layers[i] += fmt.Sprint("(", in, " -> ", out, ")")
+			}
+		}
+	}
+	m[MetadataArchitecture] = strings.Join(layers, ", ")
+
+	loss := n.loss()
+	m[MetadataLoss] = strings.TrimPrefix(fmt.Sprintf("%T%+v", loss, loss), "nn.")
+	if n.Optimizer != nil {
+		m[MetadataOptimizer] = describe(n.Optimizer)
+	}
+	// Saving a loaded model keeps its original creation time.
+	if _, ok := m[MetadataCreated]; !ok {
+		m[MetadataCreated] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return m
+}
+
+// typeName returns the name of v's type, without the package for the ones in
+// this one.
+func typeName(v any) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fmt.Sprintf("%T", v), "*"), "nn.")
+}
+
+// describe formats v like the loss, "Type{Field:value ...}", but only with the
+// exported fields. Those are the hyperparameters of optimizers and schedulers,
+// the unexported ones are their state.
+func describe(v any) string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "<nil>"
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "<nil>"
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Sprint(rv.Interface())
+	}
+
+	var fields []string
+	for i := range rv.NumField() {
+		if field := rv.Type().Field(i); field.IsExported() {
+			fields = append(fields, field.Name+":"+describe(rv.Field(i).Interface()))
+		}
+	}
+	return typeName(v) + "{" + strings.Join(fields, " ") + "}"
+}
+
+/* Metadata is encoded as the number of entries followed by each key and
+   value, sorted by key:
+
+   entries uint32
+   key     uint32 length, followed by the bytes
+   value   uint32 length, followed by the bytes
+*/
+
+func (m Metadata) encode() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(m)))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		for _, s := range []string{key, m[key]} {
+			binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		}
+	}
+	return buf.Bytes()
+}
+
+func decodeMetadata(data []byte) (Metadata, error) {
+	m := Metadata{}
+	if len(data) == 0 {
+		return m, nil
+	}
+
+	r := bytes.NewReader(data)
+	var entries uint32
+	err := binary.Read(r, binary.LittleEndian, &entries)
+	if err != nil {
+		return nil, formatError("Invalid model metadata")
+	}
+	// Each entry takes at least 8 bytes.
+	if uint64(entries)*8 > uint64(r.Len()) {
+		return nil, formatError("Invalid model metadata entry count: ", entries)
+	}
+
+	readString := func() (string, error) {
+		var length uint32
+		err := binary.Read(r, binary.LittleEndian, &length)
+		if err != nil || uint64(length) > uint64(r.Len()) {
+			return "", formatError("Invalid model metadata")
+		}
+		s := make([]byte, length)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	}
+	for range entries {
+		key, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[key]; ok {
+			return nil, formatError("Repeated model metadata key: ", key)
+		}
+		m[key] = value
+	}
+	if r.Len() != 0 {
+		return nil, formatError("Invalid model metadata")
+	}
+	return m, nil
+}
+
+// LoadMetadata reads only the metadata of a model written by Save, without
+// loading the weights or verifying the checksum. Files saved before metadata
+// existed have none.
+func LoadMetadata(r io.Reader) (Metadata, error) {
+	var magic [4]byte
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	if magic != modelMagic {
+		return Metadata{}, nil
+	}
+
+	data, err := readHeader(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return decodeMetadata(data)
+}
+
+func LoadMetadataFromFile(path string) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadMetadata(bufio.NewReader(f))
+}
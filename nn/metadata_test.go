@@ -0,0 +1,129 @@
+package nn
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetadata_SaveLoad(t *testing.T) {
+	n := NewMLP([]int32{4, 3, 2}, ReLU{}, NoActF{}, 1)
+	n.Layers = append(n.Layers, NewSoftmaxLayer())
+	n.Loss = Huber{Delta: 0.5}
+	n.Optimizer = NewAdam(0.9, 0.999)
+	n.Metadata().SetLabels("cat", "dog")
+	n.Metadata()["dataset"] = "pets v2"
+	n.TrainSingleThreaded([]Sample{{In: randomTensor(4, 1), Out: randomTensor(2, 1)}}, nil, 2,
+		NewInverseTimeDecay(0.1, 0), 0)
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, ok := n.Metadata()[MetadataArchitecture]; ok {
+		t.Errorf("Save() modified the network's metadata: %q", n.Metadata())
+	}
+	metadata, err := LoadMetadata(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadMetadata() error = %v", err)
+	}
+
+	want := Metadata{
+		MetadataArchitecture: "FullyConnected(4 -> 3), FullyConnected(3 -> 2), Softmax",
+		MetadataLabels:       "cat\ndog",
+		MetadataLoss:         "Huber{Delta:0.5}",
+		MetadataOptimizer:    "Adam{Beta1:0.9 Beta2:0.999}",
+		MetadataTraining:     "epochs: 2, full batch, scheduler: InverseTimeDecay{Initial:0.1 Decay:0}",
+		MetadataCreated:      metadata[MetadataCreated],
+		"dataset":            "pets v2",
+	}
+	created, ok := want.Created()
+	if !ok || time.Since(created) > time.Minute {
+		t.Errorf("Save() created = %q, want the current time", want[MetadataCreated])
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, got := range []Metadata{metadata, loaded.Metadata()} {
+		if !maps.Equal(got, want) {
+			t.Errorf("Metadata = %q, want %q", got, want)
+		}
+	}
+	if labels := loaded.Metadata().Labels(); !slices.Equal(labels, []string{"cat", "dog"}) {
+		t.Errorf("Labels() = %q, want [cat dog]", labels)
+	}
+}
+
+func TestMetadata_TooLong(t *testing.T) {
+	n := &NeuralNetwork{Layers: []Layer{NewSoftmaxLayer()}}
+	n.Metadata()["notes"] = strings.Repeat("a", maxMetadataLength)
+
+	// Files Load would reject aren't written.
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err == nil || buf.Len() != 0 {
+		t.Errorf("Save() error = %v after writing %d bytes, want an error before writing", err, buf.Len())
+	}
+}
+
+func TestMetadata_InputShape(t *testing.T) {
+	m := Metadata{}
+	if _, ok := m.InputShape(); ok {
+		t.Errorf("InputShape() of empty metadata is set")
+	}
+	m.SetInputShape(1, 28, 28)
+	if shape, ok := m.InputShape(); !ok || !slices.Equal(shape, []int32{1, 28, 28}) || m[MetadataInputShape] != "1x28x28" {
+		t.Errorf("InputShape() = %v, %v saved as %q, want [1 28 28]", shape, ok, m[MetadataInputShape])
+	}
+	m[MetadataInputShape] = "1xax28"
+	if _, ok := m.InputShape(); ok {
+		t.Errorf("InputShape() of invalid value is set")
+	}
+}
+
+func TestMetadata_Hyperparameters(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{NewSGD(0.9, true), "SGD{Momentum:0.9 Nesterov:true}"},
+		{NewAdamW(0.9, 0.999, 0.01), "AdamW{Adam:Adam{Beta1:0.9 Beta2:0.999} WeightDecay:0.01}"},
+		{NewLinearWarmup(NewStepDecay(0.1, 0.5, 3), 10),
+			"LinearWarmup{Scheduler:StepDecay{Initial:0.1 Factor:0.5 EpochsPerStep:3} WarmupSteps:10}"},
+	}
+	for _, tt := range tests {
+		if got := describe(tt.v); got != tt.want {
+			t.Errorf("describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestMetadata_Legacy(t *testing.T) {
+	metadata, err := LoadMetadataFromFile("../mnist/mnist_trained.nn")
+	if err != nil || len(metadata) != 0 {
+		t.Errorf("LoadMetadataFromFile() = %v, %v, want no metadata", metadata, err)
+	}
+}
+
+func TestMetadata_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", Metadata{"key": "value"}.encode()[:10]},
+		{"too many entries", []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"repeated key", []byte{2, 0, 0, 0, 1, 0, 0, 0, 'a', 0, 0, 0, 0, 1, 0, 0, 0, 'a', 0, 0, 0, 0}},
+		{"trailing bytes", append(Metadata{}.encode(), 1)},
+	}
+	for _, tt := range tests {
+		var formatErr *FormatError
+		if _, err := decodeMetadata(tt.data); !errors.As(err, &formatErr) {
+			t.Errorf("decodeMetadata() of %s error = %v, want a *FormatError", tt.name, err)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package nn
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
@@ -16,12 +19,36 @@ import (
 type NeuralNetwork struct {
 	Layers                []Layer
 	GradientClippingLimit float64
+	Loss                  Loss
+	Optimizer             Optimizer
+
+	training bool
+	metadata Metadata
 }
 
 type Sample struct{ In, Out *t.Tensor } // Both column vectors
 
+// optimizer returns the network's optimizer, networks without one get plain
+// SGD like NewMLP.
+func (n *NeuralNetwork) optimizer() Optimizer {
+	if n.Optimizer == nil {
+		n.Optimizer = NewSGD(0, false)
+	}
+	return n.Optimizer
+}
+
+// loss returns the network's loss, networks without one use MSE like NewMLP.
+func (n *NeuralNetwork) loss() Loss {
+	if n.Loss == nil {
+		return MSE{}
+	}
+	return n.Loss
+}
+
 // NewMLP (Multi-Layer Perceptron) Creates a network of fully connected layers.
-// Arch is a list of layer sizes, including input and output
+// Arch is a list of layer sizes, including input and output.
+// The network uses MSE as its loss and plain SGD as its optimizer, change Loss
+// and Optimizer to train differently.
 func NewMLP(
 	arch []int32,
 	actF ActivationFunction,
@@ -36,9 +63,29 @@ func NewMLP(
 
 	layers = append(layers, NewFullyConnectedLayer(arch[len(arch)-2], arch[len(arch)-1], outputActF))
 
-	return &NeuralNetwork{Layers: layers, GradientClippingLimit: gradientClippingLimit}
+	return &NeuralNetwork{
+		Layers:                layers,
+		GradientClippingLimit: gradientClippingLimit,
+		Loss:                  MSE{},
+		Optimizer:             NewSGD(0, false),
+	}
+}
+
+// NewMLPWithRegularization is NewMLP with every layer regularized by r.
+func NewMLPWithRegularization(
+	arch []int32,
+	actF ActivationFunction,
+	outputActF ActivationFunction,
+	gradientClippingLimit float64,
+	r Regularization,
+) *NeuralNetwork {
+	n := NewMLP(arch, actF, outputActF, gradientClippingLimit)
+	n.SetRegularization(r)
+	return n
 }
 
+// Forward takes a batch of inputs, with the samples along the last
+// dimension. A single column vector is a batch of one.
 func (n *NeuralNetwork) Forward(input *t.Tensor) (*t.Tensor, []LayerState) {
 	activations := make([]*t.Tensor, len(n.Layers)+1)
 	states := make([]LayerState, len(n.Layers))
@@ -49,72 +96,106 @@ func (n *NeuralNetwork) Forward(input *t.Tensor) (*t.Tensor, []LayerState) {
 	return activations[len(activations)-1], states
 }
 
+// SetTraining switches the network between training and inference mode,
+// which changes how some layers (like DropoutLayer) behave. Networks start in
+// inference mode, the training methods switch to training mode until they
+// return.
+func (n *NeuralNetwork) SetTraining(training bool) {
+	n.training = training
+	for _, l := range n.Layers {
+		if l, ok := l.(TrainingModeLayer); ok {
+			l.SetTraining(training)
+		}
+	}
+}
+
+func (n *NeuralNetwork) Training() bool {
+	return n.training
+}
+
+// SetRegularization sets r on every layer with weights, layers can also be
+// regularized individually through their Regularization field.
+func (n *NeuralNetwork) SetRegularization(r Regularization) {
+	setRegularization(n.Layers, r)
+}
+
+// Samples are evaluated in batches of this size to bound memory usage.
+const evaluationBatchSize = 256
+
+// AverageLoss is always evaluated in inference mode. It includes the layers'
+// regularization penalties, which for embeddings only count the vectors
+// trained so far.
 func (n *NeuralNetwork) AverageLoss(samples []Sample) float64 {
-	// Mean squared error
+	if n.training {
+		n.SetTraining(false)
+		defer n.SetTraining(true)
+	}
+
 	sum := 0.0
-	for _, s := range samples {
-		actual, _ := n.Forward(s.In)
-		for i := int32(0); i < actual.Rows(); i++ {
-			sum += math.Pow(s.Out.At(i)-actual.At(i), 2)
-		}
+	for start := 0; start < len(samples); start += evaluationBatchSize {
+		end := min(start+evaluationBatchSize, len(samples))
+		in, expected := batchSamples(samples[start:end])
+		actual, _ := n.Forward(in)
+		sum += n.loss().Value(actual, expected)
 	}
-	return sum / float64(len(samples))
+	return sum/float64(len(samples)) + regularizationPenalty(n.Layers)
 }
 
-func (n *NeuralNetwork) TrainSingleThreaded(data []Sample, epochs int, startingLearningRate float64, decay float64, verboseSteps int) {
+// TrainSingleThreaded trains the network using full-batch gradient descent.
+// The validation samples are optional, and only used to drive the scheduler.
+func (n *NeuralNetwork) TrainSingleThreaded(
+	data []Sample,
+	validation []Sample,
+	epochs int,
+	scheduler LRScheduler,
+	verboseSteps int,
+) {
+	n.SetTraining(true)
+	defer n.SetTraining(false)
+	n.Metadata()[MetadataTraining] = fmt.Sprint(
+		"epochs: ", epochs, ", full batch, scheduler: ", describe(scheduler),
+	)
+
 	for i := range epochs {
-		// Decay the learningRate
-		learningRate := startingLearningRate / (1.0 + decay*float64(i))
+		learningRate := scheduler.Step()
 
 		n.BackpropStepSingleThreaded(data, learningRate)
 
 		if verboseSteps > 0 && i%(epochs/verboseSteps) == 0 {
 			fmt.Printf("iter:%7d - lr:%3f - Loss: %7.5f\n", i, learningRate, n.AverageLoss(data))
 		}
-	}
 
+		scheduler.EndEpoch(n.validationLoss(validation))
+	}
 }
 
 func (n *NeuralNetwork) BackpropStepSingleThreaded(samples []Sample, learningRate float64) {
 	if learningRate <= 0 {
 		return
 	}
-	// A gradient per layer
-	gradientAccums := make([]LayerGrad, len(n.Layers))
-
-	for _, sample := range samples {
-		activation, states := n.Forward(sample.In)
-
-		lossGrad := computeLossGradient(activation, sample.Out)
-
-		grads := n.Backward(states, lossGrad)
+	// A gradient per layer, for the whole batch
+	gradientAccums := n.backpropBatch(samples)
 
-		for layer := range gradientAccums {
-			if gradientAccums[layer] == nil {
-				gradientAccums[layer] = grads[layer]
-			} else {
-				gradientAccums[layer].Add(grads[layer])
-			}
-		}
-	}
 	// Apply updates
 	for i, layer := range n.Layers {
 		// Normalize gradient
 		gradientAccums[i].Scale(1.0 / float64(len(samples)))
 
-		layer.UpdateParams(gradientAccums[i], learningRate)
+		layer.UpdateParams(gradientAccums[i], n.optimizer(), learningRate)
 	}
 }
 
 type NetworkGrad = []LayerGrad // Makes it easier to think about
 
 // Train the network using mini-batch SGD.
+// The validation samples are optional, and only used to drive the scheduler.
 // Remember that using the verbose option is really expensive since it calculates the global loss
+// With more than one worker, seeded layers like DropoutLayer aren't reproducible.
 func (n *NeuralNetwork) TrainConcurrent(
 	samples []Sample,
+	validation []Sample,
 	epochs int,
-	startingLearningRate float64,
-	decay float64,
+	scheduler LRScheduler,
 	batchSize int,
 	workers int,
 	verboseEpochs bool,
@@ -140,63 +221,123 @@ func (n *NeuralNetwork) TrainConcurrent(
 
 	// Number of samples to send to each worker
 	workSize := ceilingDiv(batchSize, workers)
-	numSubBatches := ceilingDiv(batchSize, workSize)
 
-	stepsPerEpoch := ceilingDiv(len(samples), batchSize)
-	steps := epochs * stepsPerEpoch
-	for step := range steps {
-		fmt.Print("\rStarting step: ", step)
+	trainMiniBatches(n, samples, validation, epochs, scheduler, batchSize, verboseEpochs,
+		func(step int, batch []Sample, learningRate float64) {
+			fmt.Print("\rStarting step: ", step)
 
-		epoch := step / stepsPerEpoch
-		// Decay the learning rate.
-		learningRate := startingLearningRate / (1.0 + decay*float64(epoch))
+			// Send part of the samples to each worker
+			numSubBatches := 0
+			for start := 0; start < len(batch); start += workSize {
+				end := min(start+workSize, len(batch))
+				workChan <- batch[start:end] // Send part of the batch off to a worker
+				numSubBatches++
+			}
 
-		batch := randomSubset(samples, batchSize)
+			// Collect results
+			networkGrad := make([]LayerGrad, len(n.Layers)) // Network grad for accumulating results.
+			for range numSubBatches {
+				subBatchNetworkGrad := <-gradChan
+				for layer := range subBatchNetworkGrad { // Add layer by layer
+					if networkGrad[layer] == nil {
+						networkGrad[layer] = subBatchNetworkGrad[layer]
+					} else {
+						networkGrad[layer].Add(subBatchNetworkGrad[layer])
+					}
+				}
+			}
 
-		// Send part of the samples to each worker
-		for start := 0; start < batchSize; start += workSize {
-			end := min(start+workSize, batchSize)
-			workChan <- batch[start:end] // Send part of the batch off to a worker
-		}
+			// Apply updates
+			for i, layer := range n.Layers {
+				// Normalize gradient
+				networkGrad[i].Scale(1.0 / float64(len(batch)))
 
-		// Collect results
-		networkGrad := make([]LayerGrad, len(n.Layers)) // Network grad for accumulating results.
-		for range numSubBatches {
-			subBatchNetworkGrad := <-gradChan
-			for layer := range subBatchNetworkGrad { // Add layer by layer
-				if networkGrad[layer] == nil {
-					networkGrad[layer] = subBatchNetworkGrad[layer]
-				} else {
-					networkGrad[layer].Add(subBatchNetworkGrad[layer])
-				}
+				layer.UpdateParams(networkGrad[i], n.optimizer(), learningRate)
 			}
-		}
+		},
+	)
+	fmt.Printf("\r                        \n") // Clear current step line for cleaner logs
 
-		// Apply updates
-		for i, layer := range n.Layers {
-			// Normalize gradient
-			networkGrad[i].Scale(1.0 / float64(batchSize))
+	// Wait until workers finished
+	close(workChan)
+	wg.Wait()
+}
+
+// trainedNetwork is what trainMiniBatches needs from a network.
+type trainedNetwork[S any] interface {
+	SetTraining(training bool)
+	Metadata() Metadata
+	AverageLoss(samples []S) float64
+}
+
+// trainMiniBatches runs the training loop of NeuralNetwork and GraphNetwork,
+// calling step to train on each random batch with a positive learning rate.
+// The validation samples are optional, and only used to drive the scheduler.
+func trainMiniBatches[S any](
+	n trainedNetwork[S],
+	samples []S,
+	validation []S,
+	epochs int,
+	scheduler LRScheduler,
+	batchSize int,
+	verboseEpochs bool,
+	step func(step int, batch []S, learningRate float64),
+) {
+	n.SetTraining(true)
+	defer n.SetTraining(false)
+	n.Metadata()[MetadataTraining] = fmt.Sprint(
+		"epochs: ", epochs, ", batch size: ", batchSize, ", scheduler: ", describe(scheduler),
+	)
+
+	stepsPerEpoch := ceilingDiv(len(samples), batchSize)
+	for i := range epochs * stepsPerEpoch {
+		epoch := i / stepsPerEpoch
+		learningRate := scheduler.Step()
 
-			layer.UpdateParams(networkGrad[i], learningRate)
+		batch := randomSubset(samples, batchSize)
+		if learningRate > 0 {
+			step(i, batch, learningRate)
 		}
 
-		if verboseEpochs && step%stepsPerEpoch == 0 {
+		if verboseEpochs && i%stepsPerEpoch == 0 {
 			fmt.Printf("\repoch:%3d - lr: %1.4f - Batch Loss: %7.5f\n", epoch, learningRate, n.AverageLoss(batch))
 		}
+
+		if (i+1)%stepsPerEpoch == 0 {
+			valLoss := math.NaN()
+			if len(validation) > 0 {
+				valLoss = n.AverageLoss(validation)
+				if verboseEpochs {
+					fmt.Printf("\repoch:%3d - Validation Loss: %7.5f\n", epoch, valLoss)
+				}
+			}
+			scheduler.EndEpoch(valLoss)
+		}
 	}
-	fmt.Printf("\r                        \n") // Clear current step line for cleaner logs
+}
 
-	// Wait until workers finished
-	close(workChan)
-	wg.Wait()
+// validationLoss returns NaN when there is no validation data.
+func (n *NeuralNetwork) validationLoss(validation []Sample) float64 {
+	if len(validation) == 0 {
+		return math.NaN()
+	}
+	return n.AverageLoss(validation)
 }
 
 // Backward returns the list of gradients for each successive layer.
 func (n *NeuralNetwork) Backward(states []LayerState, lossGradient *t.Tensor) []LayerGrad {
+	return n.backward(states, lossGradient, len(n.Layers))
+}
+
+// backward backpropagates actGrad starting from the layer before end, the
+// layers after it get no gradient.
+func (n *NeuralNetwork) backward(states []LayerState, actGrad *t.Tensor, end int) []LayerGrad {
 	gradientList := make([]LayerGrad, len(n.Layers))
+	for layer := end; layer < len(n.Layers); layer++ {
+		gradientList[layer] = noGrad{}
+	}
 
-	actGrad := lossGradient // Gradient respect the last activation.
-	for layer := len(n.Layers) - 1; layer >= 0; layer-- {
+	for layer := end - 1; layer >= 0; layer-- {
 		gradientList[layer], actGrad = n.Layers[layer].ComputeGradients(
 			states[layer],
 			actGrad,
@@ -207,42 +348,75 @@ func (n *NeuralNetwork) Backward(states []LayerState, lossGradient *t.Tensor) []
 	return gradientList
 }
 
+// backpropBatch runs a forward and backward pass over all the samples at
+// once, returning the gradients of the loss summed over them.
+func (n *NeuralNetwork) backpropBatch(samples []Sample) NetworkGrad {
+	in, expected := batchSamples(samples)
+	activation, states := n.Forward(in)
+	lossGradient, end := n.lossGradient(activation, expected)
+	return n.backward(states, lossGradient, end)
+}
+
+// lossGradient returns the gradient of the loss along with the number of
+// layers it still has to be backpropagated through.
+func (n *NeuralNetwork) lossGradient(output, expected *t.Tensor) (*t.Tensor, int) {
+	var last Layer
+	if len(n.Layers) > 0 {
+		last = n.Layers[len(n.Layers)-1]
+	}
+	grad, fused := outputLossGradient(n.loss(), last, output, expected)
+	if fused {
+		return grad, len(n.Layers) - 1
+	}
+	return grad, len(n.Layers)
+}
+
+// outputLossGradient returns the gradient of the loss for an output computed
+// by the layer last, which may be nil. Softmax followed by cross-entropy is
+// computed together, returning the gradient respecting the softmax's input
+// with fused set, since chaining both gradients is numerically unstable.
+func outputLossGradient(loss Loss, last Layer, output, expected *t.Tensor) (grad *t.Tensor, fused bool) {
+	if _, ok := loss.(CategoricalCrossEntropy); ok {
+		if _, ok := last.(*SoftmaxLayer); ok {
+			return softmaxCrossEntropyGradient(output, expected), true
+		}
+	}
+	return loss.Gradient(output, expected), false
+}
+
 // Shouldn't need a mutex on the NN since there should never be pending work while updating parameters.
 func backpropWorker(n *NeuralNetwork, workChan <-chan []Sample, gradChan chan<- NetworkGrad) {
 	// Get our work
 	for samples := range workChan {
-		// Process batch of samples
-		batchGrads := make([]LayerGrad, len(n.Layers))
-		for _, sample := range samples {
-			// Forward
-			activation, states := n.Forward(sample.In)
-
-			// Backward
-			lossGradient := computeLossGradient(activation, sample.Out)
-			gradients := n.Backward(states, lossGradient)
-
-			// Accummulate partial results
-			for layer := range batchGrads {
-				if batchGrads[layer] == nil {
-					batchGrads[layer] = gradients[layer]
-				} else {
-					batchGrads[layer].Add(gradients[layer])
-				}
-			}
-		}
-
-		// Send results back
-		gradChan <- batchGrads
+		// Process the samples as a single batch and send the results back
+		gradChan <- n.backpropBatch(samples)
 	}
 }
 
-func computeLossGradient(output, expectedOutput *t.Tensor) *t.Tensor {
-	// Initial gradient for output layer is
-	// dL/da_k = 2*(a_k - y_k) for MSE loss
-	return t.ScalarMult(t.Sub(output, expectedOutput), 2)
+// Save writes the network in the format described in format.go.
+func (n *NeuralNetwork) Save(w io.Writer) error {
+	// Everything written also goes through the checksum.
+	checksum := crc32.NewIEEE()
+	cw := io.MultiWriter(w, checksum)
+
+	metadata := n.savedMetadata().encode()
+	if len(metadata) > maxMetadataLength {
+		return errors.New(fmt.Sprint(
+			"Metadata is too long to save: ", len(metadata), " bytes, the limit is ", maxMetadataLength,
+		))
+	}
+	err := writeHeader(cw, metadata)
+	if err != nil {
+		return err
+	}
+	err = n.saveNetwork(cw)
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, checksum.Sum32())
 }
 
-func (n *NeuralNetwork) Save(w io.Writer) error {
+func (n *NeuralNetwork) saveNetwork(w io.Writer) error {
 	// Save the clipping limit
 	err := binary.Write(w, binary.LittleEndian, n.GradientClippingLimit)
 	if err != nil {
@@ -256,16 +430,69 @@ func (n *NeuralNetwork) Save(w io.Writer) error {
 		return err
 	}
 	for _, l := range n.Layers {
-		err = l.save(w)
+		err = saveLayer(w, l)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// The loss goes last so files saved before it was configurable still load.
+	return saveLoss(w, n.loss())
 }
 
+// Load reads a network written by Save, or by older versions without the
+// header. Optimizers aren't saved, the loaded network uses plain SGD, so set
+// Optimizer before resuming training. The type of the one used before is in
+// Metadata()[MetadataOptimizer].
 func Load(r io.Reader) (*NeuralNetwork, error) {
+	return load(r, loadLayer)
+}
+
+// load is Load reading each layer with readLayer.
+func load(r io.Reader, readLayer func(r io.Reader) (Layer, error)) (*NeuralNetwork, error) {
+	var magic [4]byte
+	_, err := io.ReadFull(r, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	if magic != modelMagic {
+		// Older files start with the network, put back what was read.
+		n, err := loadNetwork(io.MultiReader(bytes.NewReader(magic[:]), r), true, readLayer)
+		return n, unexpectedEOF(err)
+	}
+
+	// Everything read also goes through the checksum.
+	checksum := crc32.NewIEEE()
+	checksum.Write(magic[:])
+	cr := io.TeeReader(r, checksum)
+
+	metadata, err := readHeader(cr)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	n, err := loadNetwork(cr, false, readLayer)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	n.metadata, err = decodeMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected uint32
+	err = binary.Read(r, binary.LittleEndian, &expected)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if expected != checksum.Sum32() {
+		return nil, ErrChecksumMismatch
+	}
+	return n, nil
+}
+
+// loadNetwork reads what saveNetwork writes. Legacy files may end before
+// the loss.
+func loadNetwork(r io.Reader, legacy bool, readLayer func(r io.Reader) (Layer, error)) (*NeuralNetwork, error) {
 	// Read clipping limit
 	var clippingLimit float64
 	err := binary.Read(r, binary.LittleEndian, &clippingLimit)
@@ -276,21 +503,40 @@ func Load(r io.Reader) (*NeuralNetwork, error) {
 	var layerCount int32
 	err = binary.Read(r, binary.LittleEndian, &layerCount)
 	if err != nil {
-		return nil, err
+		return nil, unexpectedEOF(err)
+	}
+	if layerCount < 0 || layerCount > maxLayers {
+		return nil, formatError("Invalid number of layers: ", layerCount)
 	}
 
 	// Read that many layers
 	layers := make([]Layer, layerCount)
 	for i := int32(0); i < layerCount; i++ {
-		layers[i], err = loadLayer(r)
+		layers[i], err = readLayer(r)
 		if err != nil {
-			return nil, err
+			return nil, unexpectedEOF(err)
 		}
 	}
+	err = checkLayerChain(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older files end after the layers, those were all trained with MSE.
+	loss, err := loadLoss(r)
+	if err == io.EOF && legacy {
+		loss, err = MSE{}, nil
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
 
+	// The optimizer's state isn't saved, training resumes with plain SGD.
 	return &NeuralNetwork{
 		Layers:                layers,
 		GradientClippingLimit: clippingLimit,
+		Loss:                  loss,
+		Optimizer:             NewSGD(0, false),
 	}, nil
 }
 
@@ -310,6 +556,10 @@ func (n *NeuralNetwork) SaveToFile(path string) error {
 }
 
 func LoadFromFile(path string) (*NeuralNetwork, error) {
+	return loadFromFile(path, loadLayer)
+}
+
+func loadFromFile(path string, readLayer func(r io.Reader) (Layer, error)) (*NeuralNetwork, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -318,5 +568,5 @@ func LoadFromFile(path string) (*NeuralNetwork, error) {
 
 	// Buffered reader for performance
 	r := bufio.NewReader(f)
-	return Load(r)
+	return load(r, readLayer)
 }
@@ -16,6 +16,6 @@ func BenchmarkXor(b *testing.B) {
 
 	for b.Loop() {
 		n := NewMLP([]int32{2, 2, 1}, Sigmoid{}, NoActF{}, 1.0)
-		n.TrainConcurrent(data, 5000, 0.5, 1e-4, 0, 4, false)
+		n.TrainConcurrent(data, nil, 5000, NewInverseTimeDecay(0.5, 1e-4), 0, 4, false)
 	}
 }
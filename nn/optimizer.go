@@ -0,0 +1,326 @@
+package nn
+
+import (
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// Optimizer decides how parameters move given their gradients. Optimizers
+// keep per-parameter state (keyed by the parameter tensor), so an instance
+// should only be used by a single network.
+type Optimizer interface {
+	// Update modifies param in place according to its gradient.
+	Update(param, grad *t.Tensor, learningRate float64)
+}
+
+// WeightOptimizer is implemented by optimizers that update weight matrices
+// (and kernels) differently from other parameters like biases or
+// normalization scales, layers update their weights with UpdateWeights.
+type WeightOptimizer interface {
+	Optimizer
+	UpdateWeights(weights, grad *t.Tensor, learningRate float64)
+}
+
+// updateWeights updates weights with UpdateWeights when opt has it.
+func updateWeights(opt Optimizer, weights, grad *t.Tensor, learningRate float64) {
+	if wo, ok := opt.(WeightOptimizer); ok {
+		wo.UpdateWeights(weights, grad, learningRate)
+	} else {
+		opt.Update(weights, grad, learningRate)
+	}
+}
+
+// SparseOptimizer is implemented by optimizers that can update only some rows
+// of a weight matrix, like the vectors an embedding layer's batch used. Rows
+// maps each row's index to its gradient, rows not in it are left as they are,
+// state like momentum included.
+type SparseOptimizer interface {
+	Optimizer
+	UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64)
+}
+
+// updateRows updates the rows of weights with UpdateRows when opt has it,
+// otherwise with a dense gradient.
+func updateRows(opt Optimizer, weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	if so, ok := opt.(SparseOptimizer); ok {
+		so.UpdateRows(weights, rows, learningRate)
+		return
+	}
+	dense := t.New(weights.Shape...)
+	features := weights.Cols()
+	for index, row := range rows {
+		copy(dense.Data[index*features:], row)
+	}
+	updateWeights(opt, weights, dense, learningRate)
+}
+
+// forEachRow calls f with the offset of each row in weights and its gradient.
+func forEachRow(weights *t.Tensor, rows map[int32][]float64, f func(offset int, grad []float64)) {
+	assert.Equal(weights.Dims(), 2, "Weights must be a matrix")
+
+	features := weights.Cols()
+	for index, row := range rows {
+		assert.True(index >= 0 && index < weights.Rows(), "Rows must be in the weights")
+		assert.Equal(int32(len(row)), features, "Rows must match the weights")
+		f(int(index*features), row)
+	}
+}
+
+// Added to denominators to avoid dividing by 0.
+const optimizerEpsilon = 1e-8
+
+// SGD Stochastic gradient descent, optionally with (Nesterov) momentum.
+type SGD struct {
+	Momentum   float64
+	Nesterov   bool
+	velocities map[*t.Tensor]*t.Tensor
+}
+
+var _ SparseOptimizer = &SGD{}
+
+// NewSGD a momentum of 0 gives plain gradient descent.
+func NewSGD(momentum float64, nesterov bool) *SGD {
+	return &SGD{
+		Momentum:   momentum,
+		Nesterov:   nesterov,
+		velocities: make(map[*t.Tensor]*t.Tensor),
+	}
+}
+
+func (o *SGD) Update(param, grad *t.Tensor, learningRate float64) {
+	assert.True(t.EqDims(param, grad), "Gradient must match parameter shape")
+
+	o.step(param, 0, grad.Data, learningRate)
+}
+
+func (o *SGD) UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	forEachRow(weights, rows, func(offset int, grad []float64) {
+		o.step(weights, offset, grad, learningRate)
+	})
+}
+
+// step updates the elements of param from offset on with their gradient.
+func (o *SGD) step(param *t.Tensor, offset int, grad []float64, learningRate float64) {
+	if o.Momentum == 0 {
+		for i, g := range grad {
+			param.Data[offset+i] -= learningRate * g
+		}
+		return
+	}
+
+	if o.velocities == nil {
+		o.velocities = make(map[*t.Tensor]*t.Tensor)
+	}
+	v, ok := o.velocities[param]
+	if !ok {
+		v = t.New(param.Shape...)
+		o.velocities[param] = v
+	}
+
+	for i, g := range grad {
+		// v = momentum*v + g
+		v.Data[offset+i] = o.Momentum*v.Data[offset+i] + g
+
+		// Nesterov looks ahead, using the gradient at the point momentum takes us to.
+		step := v.Data[offset+i]
+		if o.Nesterov {
+			step = g + o.Momentum*v.Data[offset+i]
+		}
+		param.Data[offset+i] -= learningRate * step
+	}
+}
+
+// RMSProp scales the step by a moving average of the squared gradients.
+type RMSProp struct {
+	Decay   float64
+	squares map[*t.Tensor]*t.Tensor
+}
+
+var _ SparseOptimizer = &RMSProp{}
+
+// NewRMSProp decay is usually 0.9.
+func NewRMSProp(decay float64) *RMSProp {
+	return &RMSProp{
+		Decay:   decay,
+		squares: make(map[*t.Tensor]*t.Tensor),
+	}
+}
+
+func (o *RMSProp) Update(param, grad *t.Tensor, learningRate float64) {
+	assert.True(t.EqDims(param, grad), "Gradient must match parameter shape")
+
+	o.step(param, 0, grad.Data, learningRate)
+}
+
+func (o *RMSProp) UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	forEachRow(weights, rows, func(offset int, grad []float64) {
+		o.step(weights, offset, grad, learningRate)
+	})
+}
+
+// step updates the elements of param from offset on with their gradient.
+func (o *RMSProp) step(param *t.Tensor, offset int, grad []float64, learningRate float64) {
+	if o.squares == nil {
+		o.squares = make(map[*t.Tensor]*t.Tensor)
+	}
+	s, ok := o.squares[param]
+	if !ok {
+		s = t.New(param.Shape...)
+		o.squares[param] = s
+	}
+
+	for i, g := range grad {
+		j := offset + i
+		s.Data[j] = o.Decay*s.Data[j] + (1-o.Decay)*g*g
+		param.Data[j] -= learningRate * g / (math.Sqrt(s.Data[j]) + optimizerEpsilon)
+	}
+}
+
+// Adagrad scales the step by the accumulated squared gradients, so
+// frequently updated parameters slow down.
+type Adagrad struct {
+	sums map[*t.Tensor]*t.Tensor
+}
+
+var _ SparseOptimizer = &Adagrad{}
+
+func NewAdagrad() *Adagrad {
+	return &Adagrad{sums: make(map[*t.Tensor]*t.Tensor)}
+}
+
+func (o *Adagrad) Update(param, grad *t.Tensor, learningRate float64) {
+	assert.True(t.EqDims(param, grad), "Gradient must match parameter shape")
+
+	o.step(param, 0, grad.Data, learningRate)
+}
+
+func (o *Adagrad) UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	forEachRow(weights, rows, func(offset int, grad []float64) {
+		o.step(weights, offset, grad, learningRate)
+	})
+}
+
+// step updates the elements of param from offset on with their gradient.
+func (o *Adagrad) step(param *t.Tensor, offset int, grad []float64, learningRate float64) {
+	if o.sums == nil {
+		o.sums = make(map[*t.Tensor]*t.Tensor)
+	}
+	s, ok := o.sums[param]
+	if !ok {
+		s = t.New(param.Shape...)
+		o.sums[param] = s
+	}
+
+	for i, g := range grad {
+		j := offset + i
+		s.Data[j] += g * g
+		param.Data[j] -= learningRate * g / (math.Sqrt(s.Data[j]) + optimizerEpsilon)
+	}
+}
+
+// Adam keeps moving averages of the gradients (first moment) and their
+// squares (second moment), correcting their bias towards 0 on early steps.
+// Sparse updates only move the touched rows' moments, but count as a step
+// for the bias correction of all of them.
+type Adam struct {
+	Beta1, Beta2 float64
+	moments      map[*t.Tensor]*adamMoments
+}
+
+type adamMoments struct {
+	m, v *t.Tensor
+	step int
+}
+
+var _ SparseOptimizer = &Adam{}
+
+// NewAdam betas are usually 0.9 and 0.999.
+func NewAdam(beta1, beta2 float64) *Adam {
+	return &Adam{
+		Beta1:   beta1,
+		Beta2:   beta2,
+		moments: make(map[*t.Tensor]*adamMoments),
+	}
+}
+
+func (o *Adam) Update(param, grad *t.Tensor, learningRate float64) {
+	assert.True(t.EqDims(param, grad), "Gradient must match parameter shape")
+
+	s := o.nextStep(param)
+	o.step(s, param, 0, grad.Data, learningRate)
+}
+
+func (o *Adam) UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	s := o.nextStep(weights)
+	forEachRow(weights, rows, func(offset int, grad []float64) {
+		o.step(s, weights, offset, grad, learningRate)
+	})
+}
+
+// nextStep returns the moments of param, counting a new step.
+func (o *Adam) nextStep(param *t.Tensor) *adamMoments {
+	if o.moments == nil {
+		o.moments = make(map[*t.Tensor]*adamMoments)
+	}
+	s, ok := o.moments[param]
+	if !ok {
+		s = &adamMoments{m: t.New(param.Shape...), v: t.New(param.Shape...)}
+		o.moments[param] = s
+	}
+	s.step++
+	return s
+}
+
+// step updates the elements of param from offset on with their gradient.
+func (o *Adam) step(s *adamMoments, param *t.Tensor, offset int, grad []float64, learningRate float64) {
+	correction1 := 1 - math.Pow(o.Beta1, float64(s.step))
+	correction2 := 1 - math.Pow(o.Beta2, float64(s.step))
+	for i, g := range grad {
+		j := offset + i
+		s.m.Data[j] = o.Beta1*s.m.Data[j] + (1-o.Beta1)*g
+		s.v.Data[j] = o.Beta2*s.v.Data[j] + (1-o.Beta2)*g*g
+
+		mHat := s.m.Data[j] / correction1
+		vHat := s.v.Data[j] / correction2
+		param.Data[j] -= learningRate * mHat / (math.Sqrt(vHat) + optimizerEpsilon)
+	}
+}
+
+// AdamW Adam with weight decay applied directly to the weights instead of
+// through the gradient, so it isn't rescaled by the moments. Other
+// parameters, like biases, aren't decayed. Sparse updates only decay the
+// touched rows.
+type AdamW struct {
+	Adam
+	WeightDecay float64
+}
+
+var (
+	_ WeightOptimizer = &AdamW{}
+	_ SparseOptimizer = &AdamW{}
+)
+
+// NewAdamW weightDecay is usually around 0.01.
+func NewAdamW(beta1, beta2, weightDecay float64) *AdamW {
+	return &AdamW{
+		Adam:        *NewAdam(beta1, beta2),
+		WeightDecay: weightDecay,
+	}
+}
+
+func (o *AdamW) UpdateWeights(weights, grad *t.Tensor, learningRate float64) {
+	weights.ScaleInPlace(1 - learningRate*o.WeightDecay)
+	o.Adam.Update(weights, grad, learningRate)
+}
+
+func (o *AdamW) UpdateRows(weights *t.Tensor, rows map[int32][]float64, learningRate float64) {
+	forEachRow(weights, rows, func(offset int, _ []float64) {
+		row := weights.Data[offset : offset+int(weights.Cols())]
+		for i := range row {
+			row[i] *= 1 - learningRate*o.WeightDecay
+		}
+	})
+	o.Adam.UpdateRows(weights, rows, learningRate)
+}
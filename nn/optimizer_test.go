@@ -0,0 +1,126 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestOptimizers_Converge(t *testing.T) {
+	// Minimize Sum((p_i - 3)^2), whose gradient is 2*(p - 3).
+	tests := []struct {
+		name         string
+		opt          Optimizer
+		learningRate float64
+	}{
+		{"SGD", NewSGD(0, false), 0.1},
+		{"Momentum", NewSGD(0.9, false), 0.01},
+		{"Nesterov", NewSGD(0.9, true), 0.01},
+		{"RMSProp", NewRMSProp(0.9), 0.01},
+		{"Adagrad", NewAdagrad(), 0.5},
+		{"Adam", NewAdam(0.9, 0.999), 0.05},
+		{"AdamW", NewAdamW(0.9, 0.999, 0), 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := ts.ColumnVector(-2, 0, 10)
+			target := ts.ColumnVector(3, 3, 3)
+			for range 2000 {
+				grad := ts.ScalarMult(ts.Sub(param, target), 2)
+				tt.opt.Update(param, grad, tt.learningRate)
+			}
+			for i, p := range param.Data {
+				if math.Abs(p-3) > 1e-2 {
+					t.Errorf("param[%d] = %v, want 3", i, p)
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizers_UpdateRows(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  func() SparseOptimizer
+	}{
+		{"SGD", func() SparseOptimizer { return NewSGD(0, false) }},
+		{"Nesterov", func() SparseOptimizer { return NewSGD(0.9, true) }},
+		{"RMSProp", func() SparseOptimizer { return NewRMSProp(0.9) }},
+		{"Adagrad", func() SparseOptimizer { return NewAdagrad() }},
+		{"Adam", func() SparseOptimizer { return NewAdam(0.9, 0.999) }},
+		{"AdamW", func() SparseOptimizer { return NewAdamW(0.9, 0.999, 0.1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The rows of a sparse update move like the whole matrix with a
+			// dense one, the others don't move at all.
+			sparse, dense := tt.opt(), tt.opt()
+			weights := randomTensor(4, 3)
+			sparseWeights, denseWeights := weights.Copy(), weights.Copy()
+			for range 3 {
+				rows := map[int32][]float64{1: randomTensor(3).Data, 3: randomTensor(3).Data}
+				grad := ts.New(4, 3)
+				copy(grad.Data[3:], rows[1])
+				copy(grad.Data[9:], rows[3])
+
+				sparse.UpdateRows(sparseWeights, rows, 0.1)
+				updateWeights(dense, denseWeights, grad, 0.1)
+			}
+
+			for _, row := range []int32{1, 3} {
+				if got, want := sparseWeights.Slice(0, row, row+1), denseWeights.Slice(0, row, row+1); !approxEq(got, want) {
+					t.Errorf("UpdateRows() row %d = %v, want %v", row, got.Contiguous().Data, want.Contiguous().Data)
+				}
+			}
+			for _, row := range []int32{0, 2} {
+				if got, want := sparseWeights.Slice(0, row, row+1), weights.Slice(0, row, row+1); !ts.Eq(got, want) {
+					t.Errorf("UpdateRows() row %d = %v, want unchanged", row, got.Contiguous().Data)
+				}
+			}
+		})
+	}
+}
+
+func TestAdamW_DecaysWeights(t *testing.T) {
+	opt := NewAdamW(0.9, 0.999, 0.1)
+	weights := ts.WithData([]int32{1, 2}, []float64{1, 1})
+	biases := ts.ColumnVector(1)
+	opt.UpdateWeights(weights, ts.New(1, 2), 0.5)
+	opt.Update(biases, ts.ColumnVector(0), 0.5)
+
+	// No gradient, so only the decay should have moved the weights.
+	if want := 1 - 0.5*0.1; math.Abs(weights.Data[0]-want) > 1e-12 {
+		t.Errorf("weights = %v, want %v", weights.Data, want)
+	}
+	if biases.Data[0] != 1 {
+		t.Errorf("biases = %v, want 1", biases.Data[0])
+	}
+
+	// Layers only decay their weights.
+	l := NewLayerNormLayer(2)
+	fc := NewFullyConnectedLayer(2, 2, NoActF{})
+	fc.Biases = ts.ColumnVector(1, 1)
+	n := &NeuralNetwork{Layers: []Layer{fc, l}, GradientClippingLimit: 10, Optimizer: NewAdamW(0.9, 0.999, 0.1)}
+	weights = fc.Weights.Copy()
+	n.BackpropStepSingleThreaded([]Sample{{In: ts.ColumnVector(0, 0), Out: ts.ColumnVector(0, 0)}}, 0.5)
+	if !approxEq(fc.Weights, ts.ScalarMult(weights, 1-0.5*0.1)) {
+		t.Errorf("weights = %v, want decayed %v", fc.Weights.Data, weights.Data)
+	}
+	if !ts.Eq(fc.Biases, ts.ColumnVector(1, 1)) || !ts.Eq(l.Gamma, ts.ColumnVector(1, 1)) {
+		t.Errorf("biases = %v, gamma = %v, want unchanged", fc.Biases.Data, l.Gamma.Data)
+	}
+}
+
+func TestNeuralNetwork_DefaultOptimizer(t *testing.T) {
+	// Networks built without NewMLP have no optimizer set, they use SGD.
+	l := NewFullyConnectedLayer(1, 1, NoActF{})
+	l.Weights, l.Biases = ts.WithData([]int32{1, 1}, []float64{2}), ts.ColumnVector(0)
+	n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 10}
+	n.BackpropStepSingleThreaded([]Sample{{In: ts.ColumnVector(1), Out: ts.ColumnVector(0)}}, 0.1)
+
+	// MSE's gradient is 2*(2 - 0) for both parameters.
+	if l.Weights.Data[0] != 1.6 || l.Biases.Data[0] != -0.4 {
+		t.Errorf("parameters = %v, %v, want 1.6, -0.4", l.Weights.Data[0], l.Biases.Data[0])
+	}
+}
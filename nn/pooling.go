@@ -0,0 +1,269 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// poolingWindow has the configuration shared by pooling layers. Like
+// Conv2DLayer, they take (channels x height x width x batch) inputs, a
+// single (channels x height x width) image being a batch of one.
+type poolingWindow struct {
+	KernelSize int32
+	Stride     int32
+	Padding    int32 // Padded positions are never part of the result
+}
+
+func newPoolingWindow(kernelSize, stride, padding int32) poolingWindow {
+	assert.GreaterThan(kernelSize, 0, "Kernel size must be positive")
+	assert.GreaterThan(stride, 0, "Stride must be positive")
+	assert.True(padding >= 0 && padding < kernelSize, "Padding must be smaller than the kernel")
+
+	return poolingWindow{KernelSize: kernelSize, Stride: stride, Padding: padding}
+}
+
+// OutputSize returns the height (or width) of the output for an input of
+// the given height (or width).
+func (p poolingWindow) OutputSize(inSize int32) int32 {
+	return (inSize+2*p.Padding-p.KernelSize)/p.Stride + 1
+}
+
+// batchShape returns the shape of the input as a batch, adding the batch of
+// one of single images.
+func batchShape(shape []int32) []int32 {
+	if len(shape) == 3 {
+		return append(slices.Clone(shape), 1)
+	}
+	return shape
+}
+
+// outputShape checks the input, already a batch, and returns the shape of
+// the output.
+func (p poolingWindow) outputShape(in *t.Tensor) []int32 {
+	assert.Equal(in.Dims(), 4, "Input must be channels x height x width x batch")
+
+	outH, outW := p.OutputSize(in.Dim(1)), p.OutputSize(in.Dim(2))
+	assert.True(outH > 0 && outW > 0, "Input is smaller than the kernel")
+	return []int32{in.Dim(0), outH, outW, in.Dim(3)}
+}
+
+// forEachWindow calls f for every pair of output element and input element
+// in its window, with the offsets of the first sample of the batch. The
+// rest of the samples come right after.
+func (p poolingWindow) forEachWindow(inShape, outShape []int32, f func(outOffset, inOffset int32)) {
+	channels, inH, inW, n := inShape[0], inShape[1], inShape[2], inShape[3]
+	outH, outW := outShape[1], outShape[2]
+
+	for c := range channels {
+		for outY := range outH {
+			for outX := range outW {
+				outOffset := ((c*outH+outY)*outW + outX) * n
+				for ky := range p.KernelSize {
+					inY := outY*p.Stride - p.Padding + ky
+					if inY < 0 || inY >= inH {
+						continue
+					}
+					for kx := range p.KernelSize {
+						inX := outX*p.Stride - p.Padding + kx
+						if inX < 0 || inX >= inW {
+							continue
+						}
+						f(outOffset, ((c*inH+inY)*inW+inX)*n)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Pooling keeps the channels.
+func (p poolingWindow) features() (in, out int32) {
+	return -1, -1
+}
+
+func (p poolingWindow) save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, []int32{p.KernelSize, p.Stride, p.Padding})
+}
+
+func loadPoolingWindow(r io.Reader) (poolingWindow, error) {
+	config := make([]int32, 3)
+	err := binary.Read(r, binary.LittleEndian, config)
+	if err != nil {
+		return poolingWindow{}, err
+	}
+	if config[0] <= 0 || config[1] <= 0 || config[2] < 0 || config[2] >= config[0] {
+		return poolingWindow{}, formatError("Pooling layer with invalid kernel size, stride or padding: ", config)
+	}
+	return poolingWindow{KernelSize: config[0], Stride: config[1], Padding: config[2]}, nil
+}
+
+// MaxPool2DLayer keeps the largest value of each window.
+type MaxPool2DLayer struct {
+	poolingWindow
+}
+
+var _ Layer = &MaxPool2DLayer{}
+
+// MaxPool2DLayerState remembers where each output came from, the only input
+// that gets a gradient.
+type MaxPool2DLayerState struct {
+	InputShape []int32
+	ArgMax     []int32 // Offset into the input's Data of each output element
+}
+
+var _ LayerState = MaxPool2DLayerState{}
+
+func (MaxPool2DLayerState) layerState() {}
+
+func NewMaxPool2DLayer(kernelSize, stride, padding int32) *MaxPool2DLayer {
+	return &MaxPool2DLayer{newPoolingWindow(kernelSize, stride, padding)}
+}
+
+func (l *MaxPool2DLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	inputShape := slices.Clone(in.Shape)
+	in = in.Contiguous().Reshape(batchShape(inputShape)...)
+	out := t.New(l.outputShape(in)...)
+	n := in.Dim(3)
+
+	for i := range out.Data {
+		out.Data[i] = math.Inf(-1)
+	}
+	argMax := make([]int32, len(out.Data))
+	l.forEachWindow(in.Shape, out.Shape, func(outOffset, inOffset int32) {
+		for i := range n {
+			if v := in.Data[inOffset+i]; v > out.Data[outOffset+i] {
+				out.Data[outOffset+i] = v
+				argMax[outOffset+i] = inOffset + i
+			}
+		}
+	})
+
+	return out, MaxPool2DLayerState{InputShape: inputShape, ArgMax: argMax}
+}
+
+func (l *MaxPool2DLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(MaxPool2DLayerState)
+	assert.True(ok, "State must match layer type")
+
+	// The offsets are the same with or without the batch of one.
+	nextLayerGrad = nextLayerGrad.Contiguous()
+	prevLayerGrad := t.New(state.InputShape...)
+	for i, from := range state.ArgMax {
+		prevLayerGrad.Data[from] += nextLayerGrad.Data[i]
+	}
+	return noGrad{}, prevLayerGrad
+}
+
+func (l *MaxPool2DLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *MaxPool2DLayer) TypeName() string { return "MaxPool2D" }
+
+func (l *MaxPool2DLayer) Save(w io.Writer) error {
+	return l.poolingWindow.save(w)
+}
+
+func loadMaxPool2DLayer(r io.Reader) (*MaxPool2DLayer, error) {
+	p, err := loadPoolingWindow(r)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxPool2DLayer{p}, nil
+}
+
+// AvgPool2DLayer averages each window, not counting padding.
+type AvgPool2DLayer struct {
+	poolingWindow
+}
+
+var _ Layer = &AvgPool2DLayer{}
+
+type AvgPool2DLayerState struct {
+	InputShape []int32
+}
+
+var _ LayerState = AvgPool2DLayerState{}
+
+func (AvgPool2DLayerState) layerState() {}
+
+func NewAvgPool2DLayer(kernelSize, stride, padding int32) *AvgPool2DLayer {
+	return &AvgPool2DLayer{newPoolingWindow(kernelSize, stride, padding)}
+}
+
+func (l *AvgPool2DLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	inputShape := slices.Clone(in.Shape)
+	in = in.Contiguous().Reshape(batchShape(inputShape)...)
+	out := t.New(l.outputShape(in)...)
+	n := in.Dim(3)
+
+	l.forEachWindow(in.Shape, out.Shape, func(outOffset, inOffset int32) {
+		for i := range n {
+			out.Data[outOffset+i] += in.Data[inOffset+i]
+		}
+	})
+	counts := l.windowSizes(in.Shape, out.Shape)
+	for i := range out.Data {
+		out.Data[i] /= counts[i]
+	}
+
+	return out, AvgPool2DLayerState{InputShape: inputShape}
+}
+
+func (l *AvgPool2DLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(AvgPool2DLayerState)
+	assert.True(ok, "State must match layer type")
+
+	// Each input gets an equal share of the gradient of every window it's in.
+	nextLayerGrad = nextLayerGrad.Contiguous()
+	inShape := batchShape(state.InputShape)
+	counts := l.windowSizes(inShape, nextLayerGrad.Shape)
+	prevLayerGrad := t.New(inShape...)
+	n := inShape[3]
+	l.forEachWindow(inShape, nextLayerGrad.Shape, func(outOffset, inOffset int32) {
+		for i := range n {
+			prevLayerGrad.Data[inOffset+i] += nextLayerGrad.Data[outOffset+i] / counts[outOffset+i]
+		}
+	})
+	return noGrad{}, prevLayerGrad.Reshape(state.InputShape...)
+}
+
+// windowSizes returns the number of (non padding) elements in the window of
+// each output.
+func (l *AvgPool2DLayer) windowSizes(inShape, outShape []int32) []float64 {
+	counts := make([]float64, outShape[0]*outShape[1]*outShape[2]*outShape[3])
+	n := inShape[3]
+	l.forEachWindow(inShape, outShape, func(outOffset, inOffset int32) {
+		for i := range n {
+			counts[outOffset+i]++
+		}
+	})
+	return counts
+}
+
+func (l *AvgPool2DLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *AvgPool2DLayer) TypeName() string { return "AvgPool2D" }
+
+func (l *AvgPool2DLayer) Save(w io.Writer) error {
+	return l.poolingWindow.save(w)
+}
+
+func loadAvgPool2DLayer(r io.Reader) (*AvgPool2DLayer, error) {
+	p, err := loadPoolingWindow(r)
+	if err != nil {
+		return nil, err
+	}
+	return &AvgPool2DLayer{p}, nil
+}
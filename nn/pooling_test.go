@@ -0,0 +1,114 @@
+package nn
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestPooling_Forward(t *testing.T) {
+	// A single 4x4 image with values 1..16
+	in := ts.New(1, 4, 4, 1)
+	for i := range in.Data {
+		in.Data[i] = float64(i + 1)
+	}
+
+	tests := []struct {
+		name  string
+		layer Layer
+		want  *ts.Tensor
+	}{
+		{
+			name:  "max 2x2",
+			layer: NewMaxPool2DLayer(2, 2, 0),
+			want:  ts.WithData([]int32{1, 2, 2, 1}, []float64{6, 8, 14, 16}),
+		},
+		{
+			name:  "max 3x3 stride 1",
+			layer: NewMaxPool2DLayer(3, 1, 0),
+			want:  ts.WithData([]int32{1, 2, 2, 1}, []float64{11, 12, 15, 16}),
+		},
+		{
+			name:  "max with padding",
+			layer: NewMaxPool2DLayer(2, 2, 1),
+			want:  ts.WithData([]int32{1, 3, 3, 1}, []float64{1, 3, 4, 9, 11, 12, 13, 15, 16}),
+		},
+		{
+			name:  "avg 2x2",
+			layer: NewAvgPool2DLayer(2, 2, 0),
+			want:  ts.WithData([]int32{1, 2, 2, 1}, []float64{3.5, 5.5, 11.5, 13.5}),
+		},
+		{
+			name:  "avg with padding",
+			layer: NewAvgPool2DLayer(2, 2, 1),
+			want:  ts.WithData([]int32{1, 3, 3, 1}, []float64{1, 2.5, 4, 7, 8.5, 10, 13, 14.5, 16}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := tt.layer.Forward(in)
+			if !ts.Eq(got, tt.want) {
+				t.Errorf("Forward() = %v, want %v", got.Data, tt.want.Data)
+			}
+
+			// A single image is a batch of one, and gets back a gradient of its
+			// own shape.
+			single := in.Reshape(1, 4, 4)
+			got, state := tt.layer.Forward(single)
+			if !ts.Eq(got, tt.want) {
+				t.Errorf("Forward() of a single image = %v, want %v", got, tt.want)
+			}
+			if _, grad := tt.layer.ComputeGradients(state, got, 1); !ts.EqDims(grad, single) {
+				t.Errorf("ComputeGradients() of a single image has shape %v, want %v", grad.Shape, single.Shape)
+			}
+		})
+	}
+}
+
+func TestPooling_Gradients(t *testing.T) {
+	configs := []struct{ kernel, stride, padding int32 }{
+		{2, 2, 0},
+		{3, 1, 1},
+		{3, 2, 2},
+	}
+	for _, c := range configs {
+		layers := []Layer{
+			NewMaxPool2DLayer(c.kernel, c.stride, c.padding),
+			NewAvgPool2DLayer(c.kernel, c.stride, c.padding),
+		}
+		for _, l := range layers {
+			t.Run(fmt.Sprintf("%T k%d s%d p%d", l, c.kernel, c.stride, c.padding), func(t *testing.T) {
+				n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+				// Distinct values far apart, so the differences never change
+				// which one is the max.
+				in := ts.New(2, 5, 5, 3)
+				for i, v := range rand.Perm(len(in.Data)) {
+					in.Data[i] = float64(v) / 10
+				}
+				out, _ := l.Forward(in)
+				checkInputGradient(t, n, in, randomTensor(out.Shape...))
+			})
+		}
+	}
+}
+
+func TestPooling_SaveLoad(t *testing.T) {
+	n := &NeuralNetwork{
+		Layers: []Layer{NewMaxPool2DLayer(3, 2, 1), NewAvgPool2DLayer(2, 1, 0)},
+		Loss:   MSE{},
+	}
+
+	loaded := saveAndLoad(t, n)
+
+	maxPool, ok := loaded.Layers[0].(*MaxPool2DLayer)
+	if !ok || maxPool.poolingWindow != n.Layers[0].(*MaxPool2DLayer).poolingWindow {
+		t.Errorf("Load() layer 0 = %+v, want %+v", loaded.Layers[0], n.Layers[0])
+	}
+	avgPool, ok := loaded.Layers[1].(*AvgPool2DLayer)
+	if !ok || avgPool.poolingWindow != n.Layers[1].(*AvgPool2DLayer).poolingWindow {
+		t.Errorf("Load() layer 1 = %+v, want %+v", loaded.Layers[1], n.Layers[1])
+	}
+}
@@ -0,0 +1,184 @@
+package nn
+
+import (
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+/* Positional encodings add a vector depending on each step's position to
+   (steps x features x batch) sequences, since attention by itself doesn't
+   know the order of the steps.
+*/
+
+// PositionalEncodingLayerState is empty, the encodings' gradients don't
+// depend on their input.
+type PositionalEncodingLayerState struct{}
+
+var _ LayerState = PositionalEncodingLayerState{}
+
+func (PositionalEncodingLayerState) layerState() {}
+
+// SinusoidalPositionalEncodingLayer adds fixed sines and cosines of
+// different frequencies to each step:
+//
+//	PE(pos, 2i)   = sin(pos / 10000^(2i/features))
+//	PE(pos, 2i+1) = cos(pos / 10000^(2i/features))
+type SinusoidalPositionalEncodingLayer struct{}
+
+var _ Layer = &SinusoidalPositionalEncodingLayer{}
+
+func NewSinusoidalPositionalEncodingLayer() *SinusoidalPositionalEncodingLayer {
+	return &SinusoidalPositionalEncodingLayer{}
+}
+
+// sinusoidalEncoding returns the (steps x features x 1) encodings.
+func sinusoidalEncoding(steps, features int32) *t.Tensor {
+	encoding := t.New(steps, features, 1)
+	for pos := range steps {
+		for i := range features {
+			angle := float64(pos) / math.Pow(10000, float64(i-i%2)/float64(features))
+			if i%2 == 0 {
+				encoding.Data[pos*features+i] = math.Sin(angle)
+			} else {
+				encoding.Data[pos*features+i] = math.Cos(angle)
+			}
+		}
+	}
+	return encoding
+}
+
+// Forward takes (steps x features x batch) sequences, a (steps x features)
+// matrix is a single sequence. Not knowing the number of features, batches of
+// single feature sequences must be (steps x 1 x batch).
+func (l *SinusoidalPositionalEncodingLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	seq := asSequence(in, -1)
+	assert.Equal(seq.Dims(), 3, "Input must be a (steps x features x batch) sequence")
+
+	out := t.Add(seq, sinusoidalEncoding(seq.Dim(0), seq.Dim(1)))
+	return out.Reshape(in.Shape...), PositionalEncodingLayerState{}
+}
+
+func (l *SinusoidalPositionalEncodingLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	return noGrad{}, nextLayerGrad
+}
+
+func (l *SinusoidalPositionalEncodingLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+}
+
+func (l *SinusoidalPositionalEncodingLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *SinusoidalPositionalEncodingLayer) TypeName() string { return "SinusoidalPositionalEncoding" }
+
+// Nothing to save besides the type.
+func (l *SinusoidalPositionalEncodingLayer) Save(w io.Writer) error { return nil }
+
+// LearnedPositionalEncodingLayer adds a trainable vector to each step, so
+// sequences can be at most as long as the number of vectors.
+type LearnedPositionalEncodingLayer struct {
+	Positions *t.Tensor // MaxSteps x features
+
+	Regularization Regularization // Of the positions, not saved
+}
+
+var (
+	_ Layer            = &LearnedPositionalEncodingLayer{}
+	_ RegularizedLayer = &LearnedPositionalEncodingLayer{}
+)
+
+type LearnedPositionalEncodingLayerGradient struct {
+	Positions *t.Tensor
+}
+
+var _ LayerGrad = &LearnedPositionalEncodingLayerGradient{}
+
+func (g *LearnedPositionalEncodingLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*LearnedPositionalEncodingLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.Positions.AddInPlace(g2.Positions)
+}
+
+func (g *LearnedPositionalEncodingLayerGradient) Scale(factor float64) {
+	g.Positions.ScaleInPlace(factor)
+}
+
+func NewLearnedPositionalEncodingLayer(maxSteps, features int32) *LearnedPositionalEncodingLayer {
+	l := &LearnedPositionalEncodingLayer{Positions: t.New(maxSteps, features)}
+	for i := range l.Positions.Data {
+		l.Positions.Data[i] = 0.02 * rand.NormFloat64()
+	}
+	return l
+}
+
+func (l *LearnedPositionalEncodingLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	seq := asSequence(in, l.Positions.Cols())
+	assert.Equal(seq.Dims(), 3, "Input must be a (steps x features x batch) sequence")
+	assert.LessThanOrEqual(seq.Dim(0), l.Positions.Rows(), "Sequence is longer than the positions")
+	assert.Equal(seq.Dim(1), l.Positions.Cols(), "Input must have the right number of features")
+
+	positions := l.Positions.Slice(0, 0, seq.Dim(0)).Reshape(seq.Dim(0), seq.Dim(1), 1)
+	return t.Add(seq, positions).Reshape(in.Shape...), PositionalEncodingLayerState{}
+}
+
+func (l *LearnedPositionalEncodingLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	// Every sample's step adds to its position's gradient.
+	grad := &LearnedPositionalEncodingLayerGradient{Positions: t.New(l.Positions.Shape...)}
+	seqGrad := asSequence(nextLayerGrad, l.Positions.Cols())
+	copy(grad.Positions.Data, seqGrad.Sum(2, false).Contiguous().Data)
+
+	assert.True(grad.Positions.IsFinite(), "Grad must be finite")
+
+	return grad, nextLayerGrad
+}
+
+func (l *LearnedPositionalEncodingLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	pGrad, ok := grad.(*LearnedPositionalEncodingLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	l.Regularization.update(l.Positions, pGrad.Positions, opt, learningRate)
+}
+
+func (l *LearnedPositionalEncodingLayer) SetRegularization(r Regularization) {
+	l.Regularization = r
+}
+
+func (l *LearnedPositionalEncodingLayer) penalty() float64 {
+	return l.Regularization.penalty(l.Positions)
+}
+
+func (l *LearnedPositionalEncodingLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *LearnedPositionalEncodingLayer) TypeName() string { return "LearnedPositionalEncoding" }
+
+func (l *LearnedPositionalEncodingLayer) Save(w io.Writer) error {
+	return l.Positions.Save(w)
+}
+
+func loadLearnedPositionalEncodingLayer(r io.Reader) (*LearnedPositionalEncodingLayer, error) {
+	positions, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if positions.Dims() != 2 {
+		return nil, formatError("LearnedPositionalEncoding layer with positions ", positions.Shape)
+	}
+	return &LearnedPositionalEncodingLayer{Positions: positions}, nil
+}
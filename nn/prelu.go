@@ -0,0 +1,136 @@
+package nn
+
+import (
+	"io"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// PReLULayer is a LeakyReLU whose slope for negative values is learned.
+// Slopes has either a single value shared by every input, or one per feature
+// (the first dimension of the input), so after a Conv2DLayer each channel
+// gets its own.
+type PReLULayer struct {
+	Slopes *t.Tensor // (1 x 1) or (features x 1)
+}
+
+var _ Layer = &PReLULayer{}
+
+type PReLULayerGradient struct {
+	Slopes *t.Tensor
+}
+
+var _ LayerGrad = &PReLULayerGradient{}
+
+func (g *PReLULayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*PReLULayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.Slopes.AddInPlace(g2.Slopes)
+}
+
+func (g *PReLULayerGradient) Scale(factor float64) {
+	g.Slopes.ScaleInPlace(factor)
+}
+
+type PReLULayerState struct {
+	Input *t.Tensor
+}
+
+var _ LayerState = PReLULayerState{}
+
+func (PReLULayerState) layerState() {}
+
+// NewPReLULayer creates a layer with the given number of slopes (1 to share
+// it, or the number of features), all starting at initial (usually 0.25).
+func NewPReLULayer(slopes int32, initial float64) *PReLULayer {
+	assert.GreaterThan(slopes, 0, "Must have at least one slope")
+
+	l := &PReLULayer{Slopes: t.New(slopes, 1)}
+	for i := range l.Slopes.Data {
+		l.Slopes.Data[i] = initial
+	}
+	return l
+}
+
+// slopeIndex returns a function mapping an index into the input's Data to
+// the slope that applies to it.
+func (l *PReLULayer) slopeIndex(in *t.Tensor) func(i int) int {
+	if l.Slopes.Rows() == 1 {
+		return func(int) int { return 0 }
+	}
+	assert.GreaterThanOrEqual(in.Dims(), 1, "Input can't be a scalar with a slope per feature")
+	assert.Equal(in.Dim(0), l.Slopes.Rows(), "Input must have one feature per slope")
+
+	stride := int(in.Size() / in.Dim(0))
+	return func(i int) int { return i / stride }
+}
+
+func (l *PReLULayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	slope := l.slopeIndex(in)
+	out := in.Copy()
+	for i, v := range out.Data {
+		if v <= 0 {
+			out.Data[i] = l.Slopes.Data[slope(i)] * v
+		}
+	}
+	return out, PReLULayerState{Input: in}
+}
+
+func (l *PReLULayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(PReLULayerState)
+	assert.True(ok, "State must match layer type")
+
+	slope := l.slopeIndex(state.Input)
+	grad := &PReLULayerGradient{Slopes: t.New(l.Slopes.Shape...)}
+	prevLayerGrad := nextLayerGrad.Copy()
+	for i, x := range state.Input.Data {
+		if x <= 0 {
+			grad.Slopes.Data[slope(i)] += nextLayerGrad.Data[i] * x
+			prevLayerGrad.Data[i] *= l.Slopes.Data[slope(i)]
+		}
+	}
+
+	assert.True(grad.Slopes.IsFinite(), "Grad must be finite")
+
+	return grad, prevLayerGrad
+}
+
+func (l *PReLULayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	pGrad, ok := grad.(*PReLULayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	opt.Update(l.Slopes, pGrad.Slopes, learningRate)
+}
+
+// A shared slope accepts any input.
+func (l *PReLULayer) features() (in, out int32) {
+	if l.Slopes.Rows() == 1 {
+		return -1, -1
+	}
+	return l.Slopes.Rows(), -1
+}
+
+func (l *PReLULayer) TypeName() string { return "PReLU" }
+
+func (l *PReLULayer) Save(w io.Writer) error {
+	return l.Slopes.Save(w)
+}
+
+func loadPReLULayer(r io.Reader) (*PReLULayer, error) {
+	slopes, err := t.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if slopes.Dims() == 0 || !isFeatureVector(slopes, slopes.Dim(0)) || slopes.Dim(0) == 0 {
+		return nil, formatError("PReLU layer with slopes of shape ", slopes.Shape)
+	}
+	return &PReLULayer{Slopes: slopes}, nil
+}
@@ -0,0 +1,80 @@
+package nn
+
+import (
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestPReLULayer_Forward(t *testing.T) {
+	l := NewPReLULayer(2, 0.25)
+	l.Slopes.Data[1] = 0.5
+	in := ts.WithData([]int32{2, 2}, []float64{-4, 2, 3, -2})
+
+	got, _ := l.Forward(in)
+	want := ts.WithData([]int32{2, 2}, []float64{-1, 2, 3, -1})
+	if !ts.Eq(got, want) {
+		t.Errorf("Forward() = %v, want %v", got, want)
+	}
+}
+
+func TestPReLULayer_Gradients(t *testing.T) {
+	tests := []struct {
+		name    string
+		slopes  int32
+		inShape []int32
+	}{
+		{"shared", 1, []int32{4}},
+		{"per feature", 4, []int32{4}},
+		{"per channel", 2, []int32{2, 3, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewPReLULayer(tt.slopes, 0.25)
+			l.Slopes = randomTensor(tt.slopes, 1)
+			n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}, GradientClippingLimit: 1e9}
+
+			samples := make([]Sample, 3)
+			for i := range samples {
+				samples[i] = Sample{In: randomTensor(tt.inShape...), Out: randomTensor(tt.inShape...)}
+			}
+
+			grad := n.backpropBatch(samples)[0].(*PReLULayerGradient)
+			checkGradient(t, "slopes", n, samples, l.Slopes, grad.Slopes)
+
+			in, expected := batchSamples(samples)
+			checkInputGradient(t, n, in, expected)
+		})
+	}
+}
+
+func TestPReLULayer_Train(t *testing.T) {
+	// Learns the slope of a LeakyReLU from its outputs.
+	target := LeakyReLU{Slope: 0.1}
+	l := NewPReLULayer(1, 0.25)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}, Optimizer: NewSGD(0, false), GradientClippingLimit: 1e9}
+
+	samples := make([]Sample, 20)
+	for i := range samples {
+		in := randomTensor(1, 1)
+		samples[i] = Sample{In: in, Out: ts.ColumnVector(target.Apply(in.Data[0]))}
+	}
+	n.TrainSingleThreaded(samples, nil, 200, NewInverseTimeDecay(0.5, 0), 0)
+
+	if got := l.Slopes.Data[0]; got < 0.09 || got > 0.11 {
+		t.Errorf("Train() learned slope %v, want 0.1", got)
+	}
+}
+
+func TestPReLULayer_SaveLoad(t *testing.T) {
+	l := NewPReLULayer(3, 0.25)
+	l.Slopes = randomTensor(3, 1)
+	n := &NeuralNetwork{Layers: []Layer{l}, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+
+	l2, ok := loaded.Layers[0].(*PReLULayer)
+	if !ok || !ts.Eq(l.Slopes, l2.Slopes) {
+		t.Errorf("Load() = %+v, want %+v", loaded.Layers[0], l)
+	}
+}
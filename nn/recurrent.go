@@ -0,0 +1,390 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+/* Recurrent layers take sequences as (steps x features x batch) tensors and
+   go through them one step at a time, feeding each step's hidden state to
+   the next one. They output every hidden state, (steps x hidden x batch), or
+   only the last one, (hidden x batch), so they can be followed by regular
+   layers. A single (steps x features) sequence is a batch of one.
+
+   Gradients are backpropagated through time, optionally truncated: with
+   TruncateSteps set, the sequence is split into chunks of that many steps,
+   counting from the end, and gradients don't flow from one chunk's hidden
+   state into the previous chunk.
+
+   Each layer computes its gates from the same kind of parameters, stacked
+   one gate after the other:
+
+   z = InputWeights * x_t + HiddenWeights * h_(t-1) + Biases
+*/
+
+// recurrent has what SimpleRNNLayer, LSTMLayer and GRULayer share.
+type recurrent struct {
+	InputWeights  *t.Tensor // (gates*hidden) x features
+	HiddenWeights *t.Tensor // (gates*hidden) x hidden
+	Biases        *t.Tensor // (gates*hidden) length vector
+
+	ReturnSequences bool  // Output every step's hidden state instead of only the last
+	TruncateSteps   int32 // Steps the gradient flows back through, 0 for all of them
+
+	Regularization Regularization // Of the input and hidden weights, not saved
+}
+
+// RecurrentLayerGradient is the gradient of any of the recurrent layers.
+type RecurrentLayerGradient struct {
+	InputWeights  *t.Tensor
+	HiddenWeights *t.Tensor
+	Biases        *t.Tensor
+}
+
+var _ LayerGrad = &RecurrentLayerGradient{}
+
+func (g *RecurrentLayerGradient) Add(another LayerGrad) {
+	g2, ok := another.(*RecurrentLayerGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	g.InputWeights.AddInPlace(g2.InputWeights)
+	g.HiddenWeights.AddInPlace(g2.HiddenWeights)
+	g.Biases.AddInPlace(g2.Biases)
+}
+
+func (g *RecurrentLayerGradient) Scale(factor float64) {
+	g.InputWeights.ScaleInPlace(factor)
+	g.HiddenWeights.ScaleInPlace(factor)
+	g.Biases.ScaleInPlace(factor)
+}
+
+func newRecurrent(gates, inputSize, hiddenSize int32, returnSequences bool) recurrent {
+	assert.GreaterThan(inputSize, 0, "Input size must be positive")
+	assert.GreaterThan(hiddenSize, 0, "Hidden size must be positive")
+
+	r := recurrent{
+		InputWeights:    t.New(gates*hiddenSize, inputSize),
+		HiddenWeights:   t.New(gates*hiddenSize, hiddenSize),
+		Biases:          t.New(gates*hiddenSize, 1),
+		ReturnSequences: returnSequences,
+	}
+
+	// Uniform in +-1/sqrt(hidden), biases included
+	limit := 1 / math.Sqrt(float64(hiddenSize))
+	for _, param := range []*t.Tensor{r.InputWeights, r.HiddenWeights, r.Biases} {
+		for i := range param.Data {
+			param.Data[i] = limit * (2*rand.Float64() - 1)
+		}
+	}
+	return r
+}
+
+func (r *recurrent) inputSize() int32  { return r.InputWeights.Cols() }
+func (r *recurrent) hiddenSize() int32 { return r.HiddenWeights.Cols() }
+
+// splitSteps returns each step of the input as a (features x batch) matrix.
+// Sequences of a single feature can drop it, being (steps x batch), and a
+// single (steps x features) sequence is a batch of one.
+func (r *recurrent) splitSteps(in *t.Tensor) []*t.Tensor {
+	switch {
+	case in.Dims() == 2 && r.inputSize() == 1:
+		in = in.Contiguous().Reshape(in.Dim(0), 1, in.Dim(1))
+	case in.Dims() == 2 && in.Dim(1) == r.inputSize():
+		in = in.Contiguous().Reshape(in.Dim(0), in.Dim(1), 1)
+	}
+	assert.Equal(in.Dims(), 3, "Input must be a (steps x features x batch) sequence")
+	assert.Equal(in.Dim(1), r.inputSize(), "Input must have the right number of features")
+	in = in.Contiguous()
+
+	stepSize := in.Dim(1) * in.Dim(2)
+	steps := make([]*t.Tensor, in.Dim(0))
+	for s := range steps {
+		steps[s] = t.WithData(in.Shape[1:], in.Data[int32(s)*stepSize:int32(s+1)*stepSize])
+	}
+	return steps
+}
+
+// joinSteps is the inverse of splitSteps.
+func joinSteps(steps []*t.Tensor) *t.Tensor {
+	rows, cols := steps[0].Rows(), steps[0].Cols()
+	out := t.New(int32(len(steps)), rows, cols)
+	for s, step := range steps {
+		copy(out.Data[int32(s)*rows*cols:], step.Data)
+	}
+	return out
+}
+
+// initialState returns a zero hidden (or cell) state.
+func (r *recurrent) initialState(batchSize int32) *t.Tensor {
+	return t.New(r.hiddenSize(), batchSize)
+}
+
+// output returns the layer's output given the hidden state after each step.
+func (r *recurrent) output(hidden []*t.Tensor) *t.Tensor {
+	if r.ReturnSequences {
+		return joinSteps(hidden)
+	}
+	return hidden[len(hidden)-1]
+}
+
+// outputGrads splits the gradient of the output into each step's, nil for the
+// steps that aren't part of the output.
+func (r *recurrent) outputGrads(nextLayerGrad *t.Tensor, steps int) []*t.Tensor {
+	grads := make([]*t.Tensor, steps)
+	if !r.ReturnSequences {
+		grads[steps-1] = nextLayerGrad
+		return grads
+	}
+
+	nextLayerGrad = nextLayerGrad.Contiguous()
+	stepSize := nextLayerGrad.Dim(1) * nextLayerGrad.Dim(2)
+	for s := range grads {
+		grads[s] = t.WithData(nextLayerGrad.Shape[1:], nextLayerGrad.Data[int32(s)*stepSize:int32(s+1)*stepSize])
+	}
+	return grads
+}
+
+// hiddenGrad returns the gradient of the hidden state after the given step,
+// from the output and from the following step.
+func hiddenGrad(outputGrad, fromNext *t.Tensor) *t.Tensor {
+	switch {
+	case outputGrad == nil:
+		return fromNext
+	case fromNext == nil:
+		return outputGrad.Copy()
+	default:
+		return t.Add(outputGrad, fromNext)
+	}
+}
+
+// truncated reports whether the gradient stops before flowing from the given
+// step into the previous one.
+func (r *recurrent) truncated(step, steps int) bool {
+	return step == 0 || (r.TruncateSteps > 0 && int32(steps-step)%r.TruncateSteps == 0)
+}
+
+func (r *recurrent) newGradient() *RecurrentLayerGradient {
+	return &RecurrentLayerGradient{
+		InputWeights:  t.New(r.InputWeights.Shape...),
+		HiddenWeights: t.New(r.HiddenWeights.Shape...),
+		Biases:        t.New(r.Biases.Shape...),
+	}
+}
+
+// accumulate adds a step's contribution to the parameter gradients, given
+// the gradients of the input (and bias) part of the gates and of the hidden
+// part, which are the same except for GRULayer's.
+func (g *RecurrentLayerGradient) accumulate(inputDelta, hiddenDelta, input, prevHidden *t.Tensor) {
+	g.InputWeights.AddInPlace(t.MatMulTransB(inputDelta, input))
+	g.HiddenWeights.AddInPlace(t.MatMulTransB(hiddenDelta, prevHidden))
+	g.Biases.AddInPlace(inputDelta.Sum(1, true))
+}
+
+func (g *RecurrentLayerGradient) assertFinite() {
+	assert.True(g.InputWeights.IsFinite(), "Grad must be finite")
+	assert.True(g.HiddenWeights.IsFinite(), "Grad must be finite")
+	assert.True(g.Biases.IsFinite(), "Grad must be finite")
+}
+
+// inputGrad joins the gradient of each step's input in the input's shape.
+func inputGrad(steps []*t.Tensor, inputShape []int32) *t.Tensor {
+	return joinSteps(steps).Reshape(inputShape...)
+}
+
+func (r *recurrent) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	assert.GreaterThan(learningRate, 0, "Must be positive")
+
+	rGrad, ok := grad.(*RecurrentLayerGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	r.Regularization.update(r.InputWeights, rGrad.InputWeights, opt, learningRate)
+	r.Regularization.update(r.HiddenWeights, rGrad.HiddenWeights, opt, learningRate)
+	opt.Update(r.Biases, rGrad.Biases, learningRate)
+}
+
+func (r *recurrent) SetRegularization(reg Regularization) {
+	r.Regularization = reg
+}
+
+func (r *recurrent) penalty() float64 {
+	return r.Regularization.penalty(r.InputWeights) + r.Regularization.penalty(r.HiddenWeights)
+}
+
+// Sequences keep their length, while the last step is a (hidden x batch)
+// matrix.
+func (r *recurrent) features() (in, out int32) {
+	if r.ReturnSequences {
+		return -1, -1
+	}
+	return -1, r.hiddenSize()
+}
+
+func (r *recurrent) save(w io.Writer) error {
+	returnSequences := int32(0)
+	if r.ReturnSequences {
+		returnSequences = 1
+	}
+	err := binary.Write(w, binary.LittleEndian, []int32{returnSequences, r.TruncateSteps})
+	if err != nil {
+		return err
+	}
+	for _, param := range []*t.Tensor{r.InputWeights, r.HiddenWeights, r.Biases} {
+		err = param.Save(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadRecurrent(r io.Reader, gates int32) (recurrent, error) {
+	config := make([]int32, 2) // Return sequences and truncate steps
+	err := binary.Read(r, binary.LittleEndian, config)
+	if err != nil {
+		return recurrent{}, err
+	}
+	if config[0] < 0 || config[0] > 1 || config[1] < 0 {
+		return recurrent{}, formatError("Recurrent layer with invalid options: ", config)
+	}
+
+	params := make([]*t.Tensor, 3)
+	for i := range params {
+		params[i], err = t.Load(r)
+		if err != nil {
+			return recurrent{}, err
+		}
+	}
+	inputWeights, hiddenWeights, biases := params[0], params[1], params[2]
+	hidden := hiddenWeights.Cols()
+	if inputWeights.Dims() != 2 || hiddenWeights.Dims() != 2 || hidden == 0 ||
+		inputWeights.Rows() != gates*hidden || hiddenWeights.Rows() != gates*hidden ||
+		!isFeatureVector(biases, gates*hidden) {
+		return recurrent{}, formatError(
+			"Recurrent layer with weights ", inputWeights.Shape, " and ", hiddenWeights.Shape,
+			" and biases ", biases.Shape,
+		)
+	}
+
+	return recurrent{
+		InputWeights:    inputWeights,
+		HiddenWeights:   hiddenWeights,
+		Biases:          biases,
+		ReturnSequences: config[0] == 1,
+		TruncateSteps:   config[1],
+	}, nil
+}
+
+// SimpleRNNLayer is an Elman recurrent layer:
+//
+//	h_t = actF(InputWeights * x_t + HiddenWeights * h_(t-1) + Biases)
+type SimpleRNNLayer struct {
+	recurrent
+	actF ActivationFunction
+}
+
+var (
+	_ Layer            = &SimpleRNNLayer{}
+	_ RegularizedLayer = &SimpleRNNLayer{}
+)
+
+type SimpleRNNLayerState struct {
+	InputShape []int32
+	Inputs     []*t.Tensor // Each step's (features x batch) input
+	Hidden     []*t.Tensor // Hidden state before each step, and after the last
+	Z          []*t.Tensor // Each step's hidden state before the activation
+}
+
+var _ LayerState = SimpleRNNLayerState{}
+
+func (SimpleRNNLayerState) layerState() {}
+
+func NewSimpleRNNLayer(inputSize, hiddenSize int32, actF ActivationFunction, returnSequences bool) *SimpleRNNLayer {
+	return &SimpleRNNLayer{
+		recurrent: newRecurrent(1, inputSize, hiddenSize, returnSequences),
+		actF:      actF,
+	}
+}
+
+func (l *SimpleRNNLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	steps := l.splitSteps(in)
+	state := SimpleRNNLayerState{
+		InputShape: in.Shape,
+		Inputs:     steps,
+		Hidden:     make([]*t.Tensor, len(steps)+1),
+		Z:          make([]*t.Tensor, len(steps)),
+	}
+	state.Hidden[0] = l.initialState(steps[0].Cols())
+
+	for s, x := range steps {
+		z := t.MatMul(l.InputWeights, x).AddInPlace(t.MatMul(l.HiddenWeights, state.Hidden[s]))
+		state.Z[s] = z.AddInPlace(l.Biases)
+		state.Hidden[s+1] = t.Map(z, l.actF.Apply)
+	}
+
+	return l.output(state.Hidden[1:]), state
+}
+
+func (l *SimpleRNNLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(SimpleRNNLayerState)
+	assert.True(ok, "State must match layer type")
+
+	grad := l.newGradient()
+	outputGrads := l.outputGrads(nextLayerGrad, len(state.Inputs))
+	inputGrads := make([]*t.Tensor, len(state.Inputs))
+
+	// Gradient of the hidden state coming from the following step
+	var fromNext *t.Tensor
+	for s := len(state.Inputs) - 1; s >= 0; s-- {
+		dh := hiddenGrad(outputGrads[s], fromNext)
+		if dh == nil { // Nothing after this step depends on it
+			inputGrads[s] = t.New(state.Inputs[s].Shape...)
+			continue
+		}
+
+		// Same as FullyConnectedLayer's delta
+		delta := t.ElementMult(dh, t.Map(state.Z[s], l.actF.Derivative))
+		clipColumns(delta, gradClipping)
+
+		grad.accumulate(delta, delta, state.Inputs[s], state.Hidden[s])
+		inputGrads[s] = t.MatMulTransA(l.InputWeights, delta)
+		fromNext = nil
+		if !l.truncated(s, len(state.Inputs)) {
+			fromNext = t.MatMulTransA(l.HiddenWeights, delta)
+		}
+	}
+
+	grad.assertFinite()
+
+	return grad, inputGrad(inputGrads, state.InputShape)
+}
+
+func (l *SimpleRNNLayer) TypeName() string { return "SimpleRNN" }
+
+func (l *SimpleRNNLayer) Save(w io.Writer) error {
+	err := SaveActivation(w, l.actF)
+	if err != nil {
+		return err
+	}
+	return l.recurrent.save(w)
+}
+
+func loadSimpleRNNLayer(r io.Reader) (*SimpleRNNLayer, error) {
+	actF, err := LoadActivation(r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := loadRecurrent(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &SimpleRNNLayer{recurrent: rec, actF: actF}, nil
+}
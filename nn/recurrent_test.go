@@ -0,0 +1,168 @@
+package nn
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// recurrentLayers returns one of each recurrent layer, with 3 features and a
+// hidden size of 4.
+func recurrentLayers(returnSequences bool) []Layer {
+	return []Layer{
+		NewSimpleRNNLayer(3, 4, Tanh{}, returnSequences),
+		NewLSTMLayer(3, 4, returnSequences),
+		NewGRULayer(3, 4, returnSequences),
+	}
+}
+
+func recurrentParams(l Layer) *recurrent {
+	switch l := l.(type) {
+	case *SimpleRNNLayer:
+		return &l.recurrent
+	case *LSTMLayer:
+		return &l.recurrent
+	case *GRULayer:
+		return &l.recurrent
+	}
+	panic("not a recurrent layer")
+}
+
+func TestRecurrentLayers_Forward(t *testing.T) {
+	for _, returnSequences := range []bool{false, true} {
+		for _, l := range recurrentLayers(returnSequences) {
+			out, _ := l.Forward(randomTensor(5, 3, 2))
+			want := []int32{4, 2}
+			if returnSequences {
+				want = []int32{5, 4, 2}
+			}
+			if !slices.Equal(out.Shape, want) {
+				t.Errorf("%s Forward() shape = %v, want %v", l.TypeName(), out.Shape, want)
+			}
+		}
+	}
+}
+
+func TestRecurrentLayers_Batch(t *testing.T) {
+	// Each sample in a batch goes through the layer on its own.
+	for _, l := range recurrentLayers(true) {
+		in := randomTensor(4, 3, 2)
+		out, _ := l.Forward(in)
+		for n := range int32(2) {
+			single, _ := l.Forward(in.Slice(2, n, n+1))
+			if !approxEq(single, out.Slice(2, n, n+1)) {
+				t.Errorf("%s Forward() of sample %d = %v, want %v", l.TypeName(), n, single.Data, out.Data)
+			}
+		}
+	}
+}
+
+func TestRecurrentLayers_SingleSequence(t *testing.T) {
+	// A (steps x features) sequence is a batch of one.
+	for _, returnSequences := range []bool{false, true} {
+		for _, l := range recurrentLayers(returnSequences) {
+			in := randomTensor(5, 3)
+			out, _ := l.Forward(in)
+			want, _ := l.Forward(in.Reshape(5, 3, 1))
+			if !ts.Eq(out, want) || !slices.Equal(out.Shape, want.Shape) {
+				t.Errorf("%s Forward() = %v %v, want %v %v", l.TypeName(), out.Shape, out.Data, want.Shape, want.Data)
+			}
+
+			n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+			expected, _ := n.Forward(in)
+			checkInputGradient(t, n, in, randomTensor(expected.Shape...))
+		}
+	}
+}
+
+func TestRecurrentLayers_Gradients(t *testing.T) {
+	for _, returnSequences := range []bool{false, true} {
+		for _, l := range recurrentLayers(returnSequences) {
+			t.Run(l.TypeName(), func(t *testing.T) {
+				n := &NeuralNetwork{Layers: []Layer{l}, GradientClippingLimit: 1e9, Loss: MSE{}}
+				outShape := []int32{4}
+				if returnSequences {
+					outShape = []int32{5, 4}
+				}
+				samples := []Sample{
+					{In: randomTensor(5, 3), Out: randomTensor(outShape...)},
+					{In: randomTensor(5, 3), Out: randomTensor(outShape...)},
+				}
+
+				grad := n.backpropBatch(samples)[0].(*RecurrentLayerGradient)
+				params := recurrentParams(l)
+				checkGradient(t, "input weights", n, samples, params.InputWeights, grad.InputWeights)
+				checkGradient(t, "hidden weights", n, samples, params.HiddenWeights, grad.HiddenWeights)
+				checkGradient(t, "biases", n, samples, params.Biases, grad.Biases)
+
+				in, expected := batchSamples(samples)
+				checkInputGradient(t, n, in, expected)
+			})
+		}
+	}
+}
+
+func TestRecurrentLayers_TruncatedBPTT(t *testing.T) {
+	for _, l := range recurrentLayers(false) {
+		recurrentParams(l).TruncateSteps = 2
+		in := randomTensor(5, 3, 1)
+		out, state := l.Forward(in)
+		_, inGrad := l.ComputeGradients(state, out, math.Inf(1))
+
+		// Only the last chunk, steps 4 and 5, gets a gradient.
+		for step := range int32(5) {
+			stepGrad := inGrad.Slice(0, step, step+1)
+			zero := !stepGrad.Any(func(v float64) bool { return v != 0 })
+			if zero != (step < 3) {
+				t.Errorf("%s input gradient of step %d = %v", l.TypeName(), step, stepGrad.Contiguous().Data)
+			}
+		}
+	}
+}
+
+func TestRecurrentLayers_SaveLoad(t *testing.T) {
+	layers := append(recurrentLayers(true), recurrentLayers(false)...)
+	recurrentParams(layers[1]).TruncateSteps = 3
+	n := &NeuralNetwork{Layers: layers, Loss: MSE{}}
+
+	loaded := saveAndLoad(t, n)
+
+	for i, l := range loaded.Layers {
+		got, want := recurrentParams(l), recurrentParams(n.Layers[i])
+		if l.TypeName() != n.Layers[i].TypeName() || got.ReturnSequences != want.ReturnSequences ||
+			got.TruncateSteps != want.TruncateSteps || !ts.Eq(got.HiddenWeights, want.HiddenWeights) {
+			t.Errorf("Load() layer %d = %+v, want %+v", i, l, n.Layers[i])
+		}
+	}
+	in := randomTensor(5, 3, 1)
+	for i := range 3 {
+		want, _ := n.Layers[i].Forward(in)
+		got, _ := loaded.Layers[i].Forward(in)
+		if !ts.Eq(got, want) {
+			t.Errorf("Load() layer %d outputs %v, want %v", i, got.Data, want.Data)
+		}
+	}
+}
+
+func TestLSTMLayer_Training(t *testing.T) {
+	// Remembering the first element of a sequence.
+	samples := make([]Sample, 64)
+	for i := range samples {
+		in := randomTensor(6, 1)
+		samples[i] = Sample{In: in, Out: ts.ColumnVector(in.Data[0])}
+	}
+	n := &NeuralNetwork{
+		Layers:                []Layer{NewLSTMLayer(1, 8, false), NewFullyConnectedLayer(8, 1, NoActF{})},
+		GradientClippingLimit: 1,
+		Loss:                  MSE{},
+		Optimizer:             NewAdam(0.9, 0.999),
+	}
+
+	before := n.AverageLoss(samples)
+	n.TrainConcurrent(samples, nil, 100, NewInverseTimeDecay(0.01, 0), 16, 1, false)
+	if after := n.AverageLoss(samples); after > before/4 {
+		t.Errorf("AverageLoss() after training = %v, want below %v", after, before/4)
+	}
+}
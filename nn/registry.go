@@ -0,0 +1,113 @@
+package nn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+/* Layers and activation functions are saved with their type followed by
+   whatever their Save method writes, and loaded by the loader registered
+   for that type. Packages defining their own layers or activation functions
+   register them (usually from an init function) so models using them can be
+   loaded:
+
+   func init() {
+       nn.RegisterLayer("MyLayer", loadMyLayer)
+   }
+
+   Built-in types are written as a single byte, custom ones as a marker byte
+   followed by their name.
+*/
+
+// LayerLoader reads back a layer written by its Save method.
+type LayerLoader func(r io.Reader) (Layer, error)
+
+// ActivationLoader reads back an activation function's parameters, if it
+// has any.
+type ActivationLoader func(r io.Reader) (ActivationFunction, error)
+
+var (
+	registryLock      sync.RWMutex
+	layerLoaders      = map[string]LayerLoader{}
+	activationLoaders = map[string]ActivationLoader{}
+)
+
+// RegisterLayer makes layers with the given TypeName loadable. It panics if
+// the name is already taken, or is empty or longer than Load accepts.
+func RegisterLayer(name string, loader LayerLoader) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	register(layerLoaders, "layer", name, loader)
+}
+
+// RegisterActivation makes activation functions with the given TypeName
+// loadable. It panics if the name is already taken, or is empty or longer than
+// Load accepts.
+func RegisterActivation(name string, loader ActivationLoader) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	register(activationLoaders, "activation function", name, loader)
+}
+
+func register[L any](loaders map[string]L, kind, name string, loader L) {
+	if name == "" {
+		panic(fmt.Sprint("nn: empty ", kind, " name"))
+	}
+	if len(name) > maxTypeNameLength {
+		panic(fmt.Sprint("nn: ", kind, " name ", name, " is longer than ", maxTypeNameLength, " bytes"))
+	}
+	if _, ok := loaders[name]; ok {
+		panic(fmt.Sprint("nn: ", kind, " ", name, " registered twice"))
+	}
+	loaders[name] = loader
+}
+
+func writeTypeName[T ~byte](w io.Writer, name string, builtins []string, custom T) error {
+	if i := slices.Index(builtins, name); i != -1 {
+		return binary.Write(w, binary.LittleEndian, T(i))
+	}
+
+	err := binary.Write(w, binary.LittleEndian, custom)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, int32(len(name)))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, name)
+	return err
+}
+
+func readTypeName[T ~byte](r io.Reader, builtins []string, custom T, kind string) (string, error) {
+	var tag T
+	err := binary.Read(r, binary.LittleEndian, &tag)
+	if err != nil {
+		return "", err
+	}
+
+	if tag != custom {
+		if int(tag) >= len(builtins) {
+			return "", formatError("Invalid ", kind, " type found: ", tag)
+		}
+		return builtins[tag], nil
+	}
+
+	var length int32
+	err = binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	if length <= 0 || length > maxTypeNameLength {
+		return "", formatError("Invalid ", kind, " name length found: ", length)
+	}
+	name := make([]byte, length)
+	_, err = io.ReadFull(r, name)
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+	return string(name), nil
+}
@@ -0,0 +1,154 @@
+package nn_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ManuelGarciaF/neural-networks/nn"
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// Defined outside the nn package, like a user of it would.
+
+type scaledTanh struct{ Scale float64 }
+
+func (s scaledTanh) Apply(v float64) float64 { return s.Scale * math.Tanh(v) }
+
+func (s scaledTanh) Derivative(v float64) float64 {
+	tv := math.Tanh(v)
+	return s.Scale * (1 - tv*tv)
+}
+
+func (scaledTanh) TypeName() string { return "test.ScaledTanh" }
+
+func (s scaledTanh) Save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, s.Scale)
+}
+
+// scaleLayer multiplies its input by a constant before the activation.
+type scaleLayer struct {
+	Factor float64
+	actF   nn.ActivationFunction
+}
+
+type scaleLayerState struct {
+	nn.BaseLayerState
+	Z *ts.Tensor
+}
+
+type noParams struct{}
+
+func (noParams) Add(another nn.LayerGrad) {}
+func (noParams) Scale(factor float64)     {}
+
+func (l *scaleLayer) Forward(in *ts.Tensor) (*ts.Tensor, nn.LayerState) {
+	z := in.Copy().ScaleInPlace(l.Factor)
+	return ts.Map(z, l.actF.Apply), scaleLayerState{Z: z}
+}
+
+func (l *scaleLayer) ComputeGradients(s nn.LayerState, next *ts.Tensor, clip float64) (nn.LayerGrad, *ts.Tensor) {
+	grad := ts.ElementMult(next, ts.Map(s.(scaleLayerState).Z, l.actF.Derivative))
+	return noParams{}, grad.ScaleInPlace(l.Factor)
+}
+
+func (l *scaleLayer) UpdateParams(grads nn.LayerGrad, opt nn.Optimizer, learningRate float64) {}
+
+func (l *scaleLayer) TypeName() string { return "test.Scale" }
+
+func (l *scaleLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, l.Factor)
+	if err != nil {
+		return err
+	}
+	return nn.SaveActivation(w, l.actF)
+}
+
+func loadScaleLayer(r io.Reader) (nn.Layer, error) {
+	l := &scaleLayer{}
+	err := binary.Read(r, binary.LittleEndian, &l.Factor)
+	if err != nil {
+		return nil, err
+	}
+	l.actF, err = nn.LoadActivation(r)
+	return l, err
+}
+
+func init() {
+	nn.RegisterLayer("test.Scale", loadScaleLayer)
+	nn.RegisterActivation("test.ScaledTanh", func(r io.Reader) (nn.ActivationFunction, error) {
+		var s scaledTanh
+		err := binary.Read(r, binary.LittleEndian, &s.Scale)
+		return s, err
+	})
+}
+
+func TestRegistry_CustomTypes(t *testing.T) {
+	n := nn.NewMLP([]int32{3, 4, 2}, scaledTanh{Scale: 2}, nn.NoActF{}, 1)
+	n.Layers = append(n.Layers, &scaleLayer{Factor: 0.5, actF: nn.Sigmoid{}})
+	n.TrainConcurrent([]nn.Sample{{In: ts.ColumnVector(1, 2, 3), Out: ts.ColumnVector(0.2, 0.8)}},
+		nil, 2, nn.NewInverseTimeDecay(0.1, 0), 1, 1, false)
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := nn.Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	l, ok := loaded.Layers[2].(*scaleLayer)
+	if !ok || l.Factor != 0.5 || l.actF != (nn.Sigmoid{}) {
+		t.Errorf("Load() layer = %#v, want %#v", loaded.Layers[2], n.Layers[2])
+	}
+	in := ts.ColumnVector(-1, 0, 1)
+	want, _ := n.Forward(in)
+	got, _ := loaded.Forward(in)
+	if !ts.Eq(got, want) {
+		t.Errorf("Load() network outputs %v, want %v", got.Data, want.Data)
+	}
+}
+
+func TestRegistry_Unregistered(t *testing.T) {
+	l := &unregisteredLayer{scaleLayer{Factor: 1, actF: nn.NoActF{}}}
+	n := &nn.NeuralNetwork{Layers: []nn.Layer{l}, Loss: nn.MSE{}}
+
+	var buf bytes.Buffer
+	if err := n.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	_, err := nn.Load(&buf)
+	if err == nil || !strings.Contains(err.Error(), "test.Unregistered") {
+		t.Errorf("Load() error = %v, want one naming the unregistered type", err)
+	}
+}
+
+type unregisteredLayer struct{ scaleLayer }
+
+func (l *unregisteredLayer) TypeName() string { return "test.Unregistered" }
+
+func TestRegistry_InvalidNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		typeName string
+	}{
+		{"taken", "FullyConnected"},
+		{"empty", ""},
+		// Load wouldn't read it back.
+		{"too long", strings.Repeat("a", 257)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterLayer() with a %s name didn't panic", tt.name)
+				}
+			}()
+			nn.RegisterLayer(tt.typeName, loadScaleLayer)
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package nn
+
+import (
+	"math"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// Regularization keeps a layer's weights small, its zero value does nothing.
+// Biases are never regularized. It's part of the training setup, like the
+// optimizer, so it isn't saved with the layer. Networks set it on every
+// layer with SetRegularization, or NewMLPWithRegularization and Regularized
+// when building them.
+type Regularization struct {
+	// Penalties added to the loss, L1*Sum(|w|) + L2*Sum(w^2), whose gradients
+	// are added to the weights'.
+	L1, L2 float64
+	// WeightDecay shrinks the weights by learningRate*WeightDecay of their
+	// value on each update, decoupled from the gradient like AdamW does. It
+	// can't be combined with AdamW's own WeightDecay, use either one.
+	WeightDecay float64
+	// MaxNorm limits the norm of each unit's weights (each row of a weight
+	// matrix, each output channel's kernels), scaling down the ones over it
+	// after every update. 0 means no limit.
+	MaxNorm float64
+}
+
+// RegularizedLayer is implemented by layers with weights, and by the ones
+// containing them.
+type RegularizedLayer interface {
+	SetRegularization(r Regularization)
+	penalty() float64 // Added to the network's loss
+}
+
+// penalty returns the L1 and L2 penalty of the weights.
+func (r Regularization) penalty(weights *t.Tensor) float64 {
+	if r.L1 == 0 && r.L2 == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, w := range weights.Data {
+		sum += r.L1*math.Abs(w) + r.L2*w*w
+	}
+	return sum
+}
+
+// update updates the weights with the optimizer, their gradient already
+// averaged over the batch, applying every kind of regularization.
+func (r Regularization) update(weights, grad *t.Tensor, opt Optimizer, learningRate float64) {
+	r.check(opt)
+
+	if r.L1 != 0 || r.L2 != 0 {
+		grad = grad.Copy()
+		r.addGradient(weights.Data, grad.Data)
+	}
+	if r.WeightDecay != 0 {
+		weights.ScaleInPlace(1 - learningRate*r.WeightDecay)
+	}
+
+	updateWeights(opt, weights, grad, learningRate)
+
+	if r.MaxNorm != 0 {
+		limitRowNorms(weights, r.MaxNorm)
+	}
+}
+
+// updateRows is update for sparse gradients, only regularizing the rows in
+// them.
+func (r Regularization) updateRows(weights *t.Tensor, rows map[int32][]float64, opt Optimizer, learningRate float64) {
+	r.check(opt)
+
+	features := weights.Cols()
+	weightRow := func(index int32) []float64 {
+		return weights.Data[index*features : (index+1)*features]
+	}
+	if r.L1 != 0 || r.L2 != 0 {
+		regularized := make(map[int32][]float64, len(rows))
+		for index, row := range rows {
+			regularized[index] = slices.Clone(row)
+			r.addGradient(weightRow(index), regularized[index])
+		}
+		rows = regularized
+	}
+	if r.WeightDecay != 0 {
+		for index := range rows {
+			row := weightRow(index)
+			for i := range row {
+				row[i] *= 1 - learningRate*r.WeightDecay
+			}
+		}
+	}
+
+	updateRows(opt, weights, rows, learningRate)
+
+	if r.MaxNorm != 0 {
+		for index := range rows {
+			limitNorm(weightRow(index), r.MaxNorm)
+		}
+	}
+}
+
+func (r Regularization) check(opt Optimizer) {
+	assert.True(r.L1 >= 0 && r.L2 >= 0 && r.WeightDecay >= 0 && r.MaxNorm >= 0, "Regularization can't be negative")
+	if adamW, ok := opt.(*AdamW); ok {
+		assert.True(r.WeightDecay == 0 || adamW.WeightDecay == 0, "Weight decay must be set either in the regularization or in AdamW")
+	}
+}
+
+// addGradient adds the gradient of the L1 and L2 penalties to grad.
+func (r Regularization) addGradient(weights, grad []float64) {
+	for i, w := range weights {
+		// Sign(0) is 0, weights at 0 don't get pushed around.
+		grad[i] += r.L1*sign(w) + 2*r.L2*w
+	}
+}
+
+func sign(v float64) float64 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// limitRowNorms scales down every row (along the first dimension) whose norm
+// exceeds limit.
+func limitRowNorms(m *t.Tensor, limit float64) {
+	rows := m.Dim(0)
+	size := int32(len(m.Data)) / rows
+	for r := range rows {
+		limitNorm(m.Data[r*size:(r+1)*size], limit)
+	}
+}
+
+// limitNorm scales v down if its norm exceeds limit.
+func limitNorm(v []float64, limit float64) {
+	norm := 0.0
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm > limit {
+		for i := range v {
+			v[i] *= limit / norm
+		}
+	}
+}
+
+// Regularized sets r on a newly created layer and returns it, to regularize
+// layers as they are built:
+//
+//	nn.Regularized(nn.NewConv2DLayer(1, 8, 3, 1, 1, 1, nn.ReLU{}), r)
+func Regularized[L RegularizedLayer](l L, r Regularization) L {
+	l.SetRegularization(r)
+	return l
+}
+
+// setRegularization sets r on the layers that have weights.
+func setRegularization(layers []Layer, r Regularization) {
+	for _, l := range layers {
+		if rl, ok := l.(RegularizedLayer); ok {
+			rl.SetRegularization(r)
+		}
+	}
+}
+
+// regularizationPenalty sums the penalties of the layers that have one.
+func regularizationPenalty(layers []Layer) float64 {
+	sum := 0.0
+	for _, l := range layers {
+		if rl, ok := l.(RegularizedLayer); ok {
+			sum += rl.penalty()
+		}
+	}
+	return sum
+}
@@ -0,0 +1,18 @@
+//go:build !noasserts
+
+package nn
+
+import "testing"
+
+// Only asserts catch this, builds without them don't check.
+func TestRegularization_WeightDecayWithAdamW(t *testing.T) {
+	l := NewFullyConnectedLayer(2, 2, NoActF{})
+	l.Regularization = Regularization{WeightDecay: 0.1}
+	grad := &FullyConnectedLayerGradient{Weights: randomTensor(2, 2), Biases: randomTensor(2, 1)}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("UpdateParams() decaying with both the regularization and AdamW did not panic")
+		}
+	}()
+	l.UpdateParams(grad, NewAdamW(0.9, 0.999, 0.01), 0.1)
+}
@@ -0,0 +1,178 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestRegularization_PenaltyGradient(t *testing.T) {
+	n := NewMLP([]int32{3, 4, 2}, Tanh{}, NoActF{}, 1e9)
+	n.SetRegularization(Regularization{L1: 0.01, L2: 0.05})
+	samples := []Sample{
+		{In: randomTensor(3, 1), Out: randomTensor(2, 1)},
+		{In: randomTensor(3, 1), Out: randomTensor(2, 1)},
+	}
+	weights := n.Layers[0].(*FullyConnectedLayer).Weights
+
+	// Plain SGD with a learning rate of 1 moves the weights by their gradient,
+	// which must be the one of the reported loss.
+	before := weights.Copy()
+	numerical := ts.New(weights.Shape...)
+	const h = 1e-5
+	for i := range weights.Data {
+		original := weights.Data[i]
+		weights.Data[i] = original + h
+		plus := n.AverageLoss(samples)
+		weights.Data[i] = original - h
+		minus := n.AverageLoss(samples)
+		weights.Data[i] = original
+		numerical.Data[i] = (plus - minus) / (2 * h)
+	}
+	n.BackpropStepSingleThreaded(samples, 1)
+
+	for i := range weights.Data {
+		got := before.Data[i] - weights.Data[i]
+		if math.Abs(got-numerical.Data[i]) > 1e-5*max(1, math.Abs(numerical.Data[i])) {
+			t.Errorf("weights gradient[%d] = %v, want %v", i, got, numerical.Data[i])
+		}
+	}
+}
+
+func TestRegularization_Penalty(t *testing.T) {
+	l := NewFullyConnectedLayer(2, 2, NoActF{})
+	l.Weights = ts.WithData([]int32{2, 2}, []float64{1, -2, 0, 3})
+	l.Biases = ts.ColumnVector(10, 10)
+
+	l.Regularization = Regularization{L1: 0.5, L2: 0.1}
+
+	// 0.5 * (1 + 2 + 0 + 3) + 0.1 * (1 + 4 + 0 + 9), biases don't count.
+	if got := regularizationPenalty([]Layer{l, NewSoftmaxLayer()}); math.Abs(got-4.4) > 1e-12 {
+		t.Errorf("regularizationPenalty() = %v, want 4.4", got)
+	}
+	// Layers inside graphs count too.
+	g := NewGraph()
+	in := g.Input()
+	g.SetOutputs(g.Add(in, g.Layer(l, in)))
+	if got := regularizationPenalty([]Layer{g}); math.Abs(got-4.4) > 1e-12 {
+		t.Errorf("regularizationPenalty() of a graph = %v, want 4.4", got)
+	}
+}
+
+func TestRegularization_SetRegularization(t *testing.T) {
+	// Every layer with weights is regularized, nested ones included.
+	g := NewGraph()
+	in := g.Input()
+	g.SetOutputs(g.Layer(NewLSTMLayer(4, 3, true), in))
+	embedding := NewEmbeddingLayer(10, 4, -1)
+	n := &NeuralNetwork{Layers: []Layer{
+		embedding,
+		NewLearnedPositionalEncodingLayer(5, 4),
+		NewTransformerEncoderBlock(4, 2, 6, false),
+		g,
+		NewSoftmaxLayer(),
+	}}
+	n.SetRegularization(Regularization{L2: 1})
+
+	want := 0.0
+	addSquares := func(weights *ts.Tensor) {
+		for _, w := range weights.Data {
+			want += w * w
+		}
+	}
+	// The embedding's vectors only count once they are trained.
+	for _, weights := range []*ts.Tensor{
+		n.Layers[1].(*LearnedPositionalEncodingLayer).Positions,
+		n.Layers[2].(*TransformerEncoderBlock).FeedForwardHidden.Weights,
+		n.Layers[2].(*TransformerEncoderBlock).FeedForwardOutput.Weights,
+		g.Nodes[1].Layer.(*LSTMLayer).InputWeights,
+		g.Nodes[1].Layer.(*LSTMLayer).HiddenWeights,
+	} {
+		addSquares(weights)
+	}
+	for _, weights := range n.Layers[2].(*TransformerEncoderBlock).Attention.Weights {
+		addSquares(weights)
+	}
+	if got := regularizationPenalty(n.Layers); math.Abs(got-want) > 1e-9*want {
+		t.Errorf("regularizationPenalty() = %v, want %v", got, want)
+	}
+}
+
+func TestRegularization_EmbeddingRows(t *testing.T) {
+	// Only the vectors the batch used are regularized.
+	l := NewEmbeddingLayerWithWeights(ts.WithData([]int32{3, 2}, []float64{3, 4, 3, 4, 3, 4}), -1)
+	l.Regularization = Regularization{WeightDecay: 0.5, MaxNorm: 2}
+	grad := &EmbeddingLayerGradient{Rows: map[int32][]float64{1: {0, 0}}}
+	l.UpdateParams(grad, NewSGD(0, false), 1)
+
+	// Decayed to (1.5, 2), then limited to a norm of 2.
+	want := ts.WithData([]int32{3, 2}, []float64{3, 4, 1.2, 1.6, 3, 4})
+	if !approxEq(l.Weights, want) {
+		t.Errorf("UpdateParams() weights = %v, want %v", l.Weights.Data, want.Data)
+	}
+
+	// The penalty also only counts the updated vector, 1.2^2 + 1.6^2.
+	l.Regularization = Regularization{L2: 1}
+	if got := l.penalty(); math.Abs(got-4) > 1e-12 {
+		t.Errorf("penalty() = %v, want 4", got)
+	}
+}
+
+func TestRegularization_WeightDecayAndMaxNorm(t *testing.T) {
+	tests := []struct {
+		name           string
+		regularization Regularization
+		want           []float64
+	}{
+		{"none", Regularization{}, []float64{3, 4, 0.3, 0.4}},
+		// Scaled by 1 - 0.5*0.2
+		{"weight decay", Regularization{WeightDecay: 0.2}, []float64{2.7, 3.6, 0.27, 0.36}},
+		// The first row has norm 5, the second one is under the limit.
+		{"max norm", Regularization{MaxNorm: 1}, []float64{0.6, 0.8, 0.3, 0.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewFullyConnectedLayer(2, 2, NoActF{})
+			l.Weights = ts.WithData([]int32{2, 2}, []float64{3, 4, 0.3, 0.4})
+			l.Biases = ts.ColumnVector(10, 10)
+			l.Regularization = tt.regularization
+
+			grad := &FullyConnectedLayerGradient{Weights: ts.New(2, 2), Biases: ts.New(2, 1)}
+			l.UpdateParams(grad, NewSGD(0, false), 0.5)
+
+			if !approxEq(l.Weights, ts.WithData([]int32{2, 2}, tt.want)) {
+				t.Errorf("UpdateParams() weights = %v, want %v", l.Weights.Data, tt.want)
+			}
+			if !ts.Eq(l.Biases, ts.ColumnVector(10, 10)) {
+				t.Errorf("UpdateParams() biases = %v, want unchanged", l.Biases.Data)
+			}
+		})
+	}
+
+	// Each output channel's kernels are limited together.
+	l := NewConv2DLayer(2, 3, 3, 1, 0, 1, ReLU{})
+	l.Regularization = Regularization{MaxNorm: 0.5}
+	grad := &Conv2DLayerGradient{Kernels: ts.New(l.Kernels.Shape...), Biases: ts.New(3, 1)}
+	l.UpdateParams(grad, NewSGD(0, false), 1)
+	for c := range l.OutChannels {
+		if norm := l.Kernels.Slice(0, c, c+1).Contiguous().Reshape(-1, 1).ColVectorNorm2(); norm > 0.5+1e-12 {
+			t.Errorf("UpdateParams() channel %d kernels norm = %v, want at most 0.5", c, norm)
+		}
+	}
+}
+
+func TestRegularization_Constructors(t *testing.T) {
+	r := Regularization{L2: 0.1, MaxNorm: 3}
+	n := NewMLPWithRegularization([]int32{3, 4, 2}, ReLU{}, NoActF{}, 1, r)
+	for i, l := range n.Layers {
+		if got := l.(*FullyConnectedLayer).Regularization; got != r {
+			t.Errorf("NewMLPWithRegularization() layer %d regularization = %+v, want %+v", i, got, r)
+		}
+	}
+
+	conv := Regularized(NewConv2DLayer(1, 2, 3, 1, 1, 1, ReLU{}), r)
+	if conv.Regularization != r {
+		t.Errorf("Regularized() regularization = %+v, want %+v", conv.Regularization, r)
+	}
+}
@@ -0,0 +1,156 @@
+package nn
+
+import (
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// FlattenLayer turns each sample of its input into a column vector, so the
+// output of a Conv2DLayer can be fed to a FullyConnectedLayer. The batch
+// must be the last dimension of the input.
+//
+// A (channels x height x width) input could be a single image or a batch of
+// (steps x features) sequences. By default it's taken as a batch. Setting
+// SampleDims to 3 makes it a single image, flattened to a batch of one
+// (channels*height*width x 1) like Conv2DLayer does.
+type FlattenLayer struct {
+	SampleDims int32 // Dimensions of a single sample, 0 to take every input as a batch
+}
+
+var _ Layer = &FlattenLayer{}
+
+// ReshapeLayerState keeps the shape of the input, which the gradient is
+// given back.
+type ReshapeLayerState struct {
+	InputShape []int32
+}
+
+var _ LayerState = ReshapeLayerState{}
+
+func (ReshapeLayerState) layerState() {}
+
+func NewFlattenLayer() *FlattenLayer {
+	return &FlattenLayer{}
+}
+
+// NewFlattenLayerWithSampleDims creates a layer that takes inputs with
+// sampleDims dimensions as a single sample, see FlattenLayer.
+func NewFlattenLayerWithSampleDims(sampleDims int32) *FlattenLayer {
+	assert.GreaterThan(sampleDims, 0, "Samples must have at least one dimension")
+	return &FlattenLayer{SampleDims: sampleDims}
+}
+
+func (l *FlattenLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	state := ReshapeLayerState{InputShape: slices.Clone(in.Shape)}
+	if l.SampleDims != 0 && int32(in.Dims()) == l.SampleDims {
+		return in.Reshape(-1, 1), state
+	}
+
+	assert.GreaterThanOrEqual(in.Dims(), 2, "Input must have a batch dimension")
+	assert.True(l.SampleDims == 0 || int32(in.Dims()) == l.SampleDims+1, "Input must be a sample or a batch of them")
+	return in.Reshape(-1, in.Dim(in.Dims()-1)), state
+}
+
+func (l *FlattenLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(ReshapeLayerState)
+	assert.True(ok, "State must match layer type")
+
+	return noGrad{}, nextLayerGrad.Reshape(state.InputShape...)
+}
+
+func (l *FlattenLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *FlattenLayer) TypeName() string { return "Flatten" }
+
+func (l *FlattenLayer) Save(w io.Writer) error {
+	return binary.Write(w, binary.LittleEndian, l.SampleDims)
+}
+
+func loadFlattenLayer(r io.Reader) (*FlattenLayer, error) {
+	var sampleDims int32
+	err := binary.Read(r, binary.LittleEndian, &sampleDims)
+	if err != nil {
+		return nil, err
+	}
+	if sampleDims < 0 || sampleDims > maxReshapeDims {
+		return nil, formatError("Flatten layer with samples of ", sampleDims, " dimensions")
+	}
+	return &FlattenLayer{SampleDims: sampleDims}, nil
+}
+
+// ReshapeLayer gives each sample of its input a new shape with the same
+// number of elements. The batch stays as the last dimension.
+type ReshapeLayer struct {
+	Shape []int32 // Shape of a single sample, one dimension can be -1
+}
+
+var _ Layer = &ReshapeLayer{}
+
+func NewReshapeLayer(shape ...int32) *ReshapeLayer {
+	assert.GreaterThan(len(shape), 0, "Shape can't be empty")
+	return &ReshapeLayer{Shape: slices.Clone(shape)}
+}
+
+func (l *ReshapeLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	assert.GreaterThanOrEqual(in.Dims(), 2, "Input must have a batch dimension")
+
+	shape := append(slices.Clone(l.Shape), in.Dim(in.Dims()-1))
+	return in.Reshape(shape...), ReshapeLayerState{InputShape: slices.Clone(in.Shape)}
+}
+
+func (l *ReshapeLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(ReshapeLayerState)
+	assert.True(ok, "State must match layer type")
+
+	return noGrad{}, nextLayerGrad.Reshape(state.InputShape...)
+}
+
+func (l *ReshapeLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *ReshapeLayer) TypeName() string { return "Reshape" }
+
+func (l *ReshapeLayer) Save(w io.Writer) error {
+	err := binary.Write(w, binary.LittleEndian, int32(len(l.Shape)))
+	if err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, l.Shape)
+}
+
+func loadReshapeLayer(r io.Reader) (*ReshapeLayer, error) {
+	var dims int32
+	err := binary.Read(r, binary.LittleEndian, &dims)
+	if err != nil {
+		return nil, err
+	}
+	if dims <= 0 || dims > maxReshapeDims {
+		return nil, formatError("Reshape layer with ", dims, " dimensions")
+	}
+	shape := make([]int32, dims)
+	err = binary.Read(r, binary.LittleEndian, shape)
+	if err != nil {
+		return nil, err
+	}
+	inferred := 0
+	for _, dim := range shape {
+		if dim == -1 {
+			inferred++
+		}
+		if dim < -1 || inferred > 1 {
+			return nil, formatError("Reshape layer with invalid shape ", shape)
+		}
+	}
+	return &ReshapeLayer{Shape: shape}, nil
+}
@@ -0,0 +1,99 @@
+package nn
+
+import (
+	"slices"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestReshapeLayers_Forward(t *testing.T) {
+	in := randomTensor(2, 3, 4, 5)
+
+	tests := []struct {
+		name  string
+		layer Layer
+		want  []int32
+	}{
+		{"flatten", NewFlattenLayer(), []int32{24, 5}},
+		{"reshape", NewReshapeLayer(6, 4), []int32{6, 4, 5}},
+		{"reshape inferred", NewReshapeLayer(-1, 2), []int32{12, 2, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, state := tt.layer.Forward(in)
+			if !slices.Equal(got.Shape, tt.want) {
+				t.Fatalf("Forward() shape = %v, want %v", got.Shape, tt.want)
+			}
+			if !slices.Equal(got.Data, in.Data) {
+				t.Errorf("Forward() changed the order of the elements")
+			}
+
+			_, grad := tt.layer.ComputeGradients(state, got, 1)
+			if !ts.Eq(grad, in) {
+				t.Errorf("ComputeGradients() shape = %v, want %v", grad.Shape, in.Shape)
+			}
+		})
+	}
+}
+
+func TestFlattenLayer_SampleDims(t *testing.T) {
+	l := NewFlattenLayerWithSampleDims(3)
+	tests := []struct {
+		name string
+		in   *ts.Tensor
+		want []int32
+	}{
+		{"single image", randomTensor(2, 3, 4), []int32{24, 1}},
+		{"batch", randomTensor(2, 3, 4, 5), []int32{24, 5}},
+	}
+	for _, tt := range tests {
+		got, state := l.Forward(tt.in)
+		if !slices.Equal(got.Shape, tt.want) {
+			t.Errorf("Forward() of a %s shape = %v, want %v", tt.name, got.Shape, tt.want)
+		}
+		if _, grad := l.ComputeGradients(state, got, 1); !ts.Eq(grad, tt.in) {
+			t.Errorf("ComputeGradients() of a %s shape = %v, want %v", tt.name, grad.Shape, tt.in.Shape)
+		}
+	}
+
+	// By default it's a batch of sequences.
+	if got, _ := NewFlattenLayer().Forward(randomTensor(2, 3, 4)); !slices.Equal(got.Shape, []int32{6, 4}) {
+		t.Errorf("Forward() shape = %v, want [6 4]", got.Shape)
+	}
+}
+
+func TestFlattenLayer_ConvToDense(t *testing.T) {
+	conv := NewConv2DLayer(1, 2, 3, 1, 0, 1, Sigmoid{})
+	dense := NewFullyConnectedLayer(2*3*3, 2, NoActF{})
+	n := &NeuralNetwork{
+		Layers:                []Layer{conv, NewFlattenLayer(), dense},
+		GradientClippingLimit: 1e9,
+		Loss:                  MSE{},
+	}
+	samples := []Sample{
+		{In: randomTensor(1, 5, 5), Out: randomTensor(2)},
+		{In: randomTensor(1, 5, 5), Out: randomTensor(2)},
+	}
+
+	grads := n.backpropBatch(samples)
+	checkGradient(t, "kernel", n, samples, conv.Kernels, grads[0].(*Conv2DLayerGradient).Kernels)
+	checkGradient(t, "weights", n, samples, dense.Weights, grads[2].(*FullyConnectedLayerGradient).Weights)
+}
+
+func TestReshapeLayer_SaveLoad(t *testing.T) {
+	n := &NeuralNetwork{
+		Layers: []Layer{NewReshapeLayer(1, -1, 4), NewFlattenLayerWithSampleDims(3)},
+		Loss:   MSE{},
+	}
+
+	loaded := saveAndLoad(t, n)
+
+	reshape, ok := loaded.Layers[0].(*ReshapeLayer)
+	if !ok || !slices.Equal(reshape.Shape, []int32{1, -1, 4}) {
+		t.Errorf("Load() layer 0 = %+v, want %+v", loaded.Layers[0], n.Layers[0])
+	}
+	if flatten, ok := loaded.Layers[1].(*FlattenLayer); !ok || flatten.SampleDims != 3 {
+		t.Errorf("Load() layer 1 = %+v, want %+v", loaded.Layers[1], n.Layers[1])
+	}
+}
@@ -0,0 +1,239 @@
+package nn
+
+import (
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+// LRScheduler decides the learning rate used for each training step.
+type LRScheduler interface {
+	// Step is called before every parameter update and returns the learning
+	// rate to use for it.
+	Step() float64
+
+	// EndEpoch is called after every epoch with the validation loss, or NaN
+	// if no validation data was given.
+	EndEpoch(metric float64)
+}
+
+// InverseTimeDecay lr = initial / (1 + decay*epoch).
+type InverseTimeDecay struct {
+	Initial, Decay float64
+	epoch          int
+}
+
+var _ LRScheduler = &InverseTimeDecay{}
+
+func NewInverseTimeDecay(initial, decay float64) *InverseTimeDecay {
+	return &InverseTimeDecay{Initial: initial, Decay: decay}
+}
+
+func (s *InverseTimeDecay) Step() float64 {
+	return s.Initial / (1.0 + s.Decay*float64(s.epoch))
+}
+
+func (s *InverseTimeDecay) EndEpoch(metric float64) { s.epoch++ }
+
+// StepDecay Multiplies the learning rate by factor every few epochs.
+type StepDecay struct {
+	Initial, Factor float64
+	EpochsPerStep   int
+	epoch           int
+}
+
+var _ LRScheduler = &StepDecay{}
+
+func NewStepDecay(initial, factor float64, epochsPerStep int) *StepDecay {
+	assert.GreaterThan(epochsPerStep, 0, "Must be positive")
+	return &StepDecay{Initial: initial, Factor: factor, EpochsPerStep: epochsPerStep}
+}
+
+func (s *StepDecay) Step() float64 {
+	return s.Initial * math.Pow(s.Factor, float64(s.epoch/s.EpochsPerStep))
+}
+
+func (s *StepDecay) EndEpoch(metric float64) { s.epoch++ }
+
+// ExponentialDecay lr = initial * rate^epoch.
+type ExponentialDecay struct {
+	Initial, Rate float64
+	epoch         int
+}
+
+var _ LRScheduler = &ExponentialDecay{}
+
+func NewExponentialDecay(initial, rate float64) *ExponentialDecay {
+	return &ExponentialDecay{Initial: initial, Rate: rate}
+}
+
+func (s *ExponentialDecay) Step() float64 {
+	return s.Initial * math.Pow(s.Rate, float64(s.epoch))
+}
+
+func (s *ExponentialDecay) EndEpoch(metric float64) { s.epoch++ }
+
+// CosineAnnealing Follows half a cosine from Max down to Min over Period
+// steps, then restarts from Max. Every restart the period is multiplied by
+// PeriodMult (1 keeps it constant).
+type CosineAnnealing struct {
+	Max, Min   float64
+	Period     int
+	PeriodMult float64
+
+	step          int // Steps since the last restart
+	currentPeriod int
+}
+
+var _ LRScheduler = &CosineAnnealing{}
+
+func NewCosineAnnealing(maxLR, minLR float64, period int, periodMult float64) *CosineAnnealing {
+	assert.GreaterThan(period, 0, "Must be positive")
+	assert.GreaterThanOrEqual(periodMult, 1, "Periods can't shrink")
+	return &CosineAnnealing{
+		Max:           maxLR,
+		Min:           minLR,
+		Period:        period,
+		PeriodMult:    periodMult,
+		currentPeriod: period,
+	}
+}
+
+func (s *CosineAnnealing) Step() float64 {
+	if s.step >= s.currentPeriod { // Warm restart
+		s.step = 0
+		s.currentPeriod = int(math.Round(float64(s.currentPeriod) * s.PeriodMult))
+	}
+	progress := float64(s.step) / float64(s.currentPeriod)
+	s.step++
+	return cosineInterpolation(s.Max, s.Min, progress)
+}
+
+func (s *CosineAnnealing) EndEpoch(metric float64) {}
+
+// LinearWarmup Ramps the learning rate linearly from 0 to the one given by
+// the wrapped scheduler during the first WarmupSteps steps.
+type LinearWarmup struct {
+	Scheduler   LRScheduler
+	WarmupSteps int
+	step        int
+}
+
+var _ LRScheduler = &LinearWarmup{}
+
+func NewLinearWarmup(scheduler LRScheduler, warmupSteps int) *LinearWarmup {
+	return &LinearWarmup{Scheduler: scheduler, WarmupSteps: warmupSteps}
+}
+
+func (s *LinearWarmup) Step() float64 {
+	// Always step the wrapped scheduler to keep it in sync.
+	lr := s.Scheduler.Step()
+	if s.step < s.WarmupSteps {
+		lr *= float64(s.step+1) / float64(s.WarmupSteps)
+	}
+	s.step++
+	return lr
+}
+
+func (s *LinearWarmup) EndEpoch(metric float64) { s.Scheduler.EndEpoch(metric) }
+
+// OneCycle Increases the learning rate from Max/DivFactor up to Max during
+// the first PctStart of TotalSteps, then anneals it down to
+// Max/(DivFactor*FinalDivFactor), both following a cosine.
+type OneCycle struct {
+	Max                       float64
+	TotalSteps                int
+	PctStart                  float64
+	DivFactor, FinalDivFactor float64
+	step                      int
+}
+
+var _ LRScheduler = &OneCycle{}
+
+// NewOneCycle Common values are 0.3 for pctStart, 25 for divFactor and 1e4 for
+// finalDivFactor.
+func NewOneCycle(maxLR float64, totalSteps int, pctStart, divFactor, finalDivFactor float64) *OneCycle {
+	assert.GreaterThan(totalSteps, 0, "Must be positive")
+	assert.True(pctStart > 0 && pctStart < 1, "pctStart must be between 0 and 1")
+	return &OneCycle{
+		Max:            maxLR,
+		TotalSteps:     totalSteps,
+		PctStart:       pctStart,
+		DivFactor:      divFactor,
+		FinalDivFactor: finalDivFactor,
+	}
+}
+
+func (s *OneCycle) Step() float64 {
+	initial := s.Max / s.DivFactor
+	final := initial / s.FinalDivFactor
+	upSteps := max(1, int(s.PctStart*float64(s.TotalSteps)))
+	downSteps := max(1, s.TotalSteps-upSteps)
+
+	step := min(s.step, s.TotalSteps)
+	s.step++
+	if step < upSteps {
+		return cosineInterpolation(initial, s.Max, float64(step)/float64(upSteps))
+	}
+	return cosineInterpolation(s.Max, final, float64(step-upSteps)/float64(downSteps))
+}
+
+func (s *OneCycle) EndEpoch(metric float64) {}
+
+// ReduceOnPlateau Multiplies the learning rate by Factor when the validation
+// loss hasn't improved by more than Threshold (relative) for Patience epochs.
+// Epochs without a validation loss are ignored.
+type ReduceOnPlateau struct {
+	LearningRate float64
+	Factor       float64
+	Patience     int
+	Threshold    float64
+	MinLR        float64
+
+	best        float64
+	badEpochs   int
+	initialized bool
+}
+
+var _ LRScheduler = &ReduceOnPlateau{}
+
+// NewReduceOnPlateau Common values are 0.1 for factor, 10 for patience and
+// 1e-4 for threshold.
+func NewReduceOnPlateau(initial, factor float64, patience int, threshold, minLR float64) *ReduceOnPlateau {
+	assert.True(factor > 0 && factor < 1, "Factor must be between 0 and 1")
+	return &ReduceOnPlateau{
+		LearningRate: initial,
+		Factor:       factor,
+		Patience:     patience,
+		Threshold:    threshold,
+		MinLR:        minLR,
+	}
+}
+
+func (s *ReduceOnPlateau) Step() float64 {
+	return s.LearningRate
+}
+
+func (s *ReduceOnPlateau) EndEpoch(metric float64) {
+	if math.IsNaN(metric) {
+		return
+	}
+
+	if !s.initialized || metric < s.best*(1-s.Threshold) {
+		s.best = metric
+		s.badEpochs = 0
+		s.initialized = true
+		return
+	}
+
+	s.badEpochs++
+	if s.badEpochs > s.Patience {
+		s.LearningRate = max(s.MinLR, s.LearningRate*s.Factor)
+		s.badEpochs = 0
+	}
+}
+
+// cosineInterpolation goes from start to end as progress goes from 0 to 1.
+func cosineInterpolation(start, end, progress float64) float64 {
+	return end + 0.5*(start-end)*(1+math.Cos(math.Pi*progress))
+}
@@ -0,0 +1,80 @@
+package nn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLRSchedulers(t *testing.T) {
+	// Each scheduler runs 2 steps per epoch, the learning rates of every step are compared.
+	tests := []struct {
+		name      string
+		scheduler LRScheduler
+		metrics   []float64 // Validation loss for each epoch
+		want      []float64
+	}{
+		{
+			name:      "InverseTimeDecay",
+			scheduler: NewInverseTimeDecay(1, 1),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{1, 1, 0.5, 0.5, 1.0 / 3, 1.0 / 3},
+		},
+		{
+			name:      "StepDecay",
+			scheduler: NewStepDecay(1, 0.5, 2),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{1, 1, 1, 1, 0.5, 0.5},
+		},
+		{
+			name:      "ExponentialDecay",
+			scheduler: NewExponentialDecay(1, 0.1),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{1, 1, 0.1, 0.1, 0.01, 0.01},
+		},
+		{
+			name:      "CosineAnnealing with restarts",
+			scheduler: NewCosineAnnealing(1, 0, 2, 2),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{1, 0.5, 1, 1 - 0.5*(1-math.Cos(math.Pi/4)), 0.5, 0.5 * (1 - math.Cos(math.Pi/4))},
+		},
+		{
+			name:      "LinearWarmup",
+			scheduler: NewLinearWarmup(NewInverseTimeDecay(1, 1), 4),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{0.25, 0.5, 0.375, 0.5, 1.0 / 3, 1.0 / 3},
+		},
+		{
+			name:      "OneCycle",
+			scheduler: NewOneCycle(1, 4, 0.5, 10, 10),
+			metrics:   []float64{math.NaN(), math.NaN(), math.NaN()},
+			want:      []float64{0.1, 0.55, 1, 0.505, 0.01, 0.01},
+		},
+		{
+			name:      "ReduceOnPlateau",
+			scheduler: NewReduceOnPlateau(1, 0.5, 1, 0, 0),
+			metrics:   []float64{1, 1, 1},
+			want:      []float64{1, 1, 1, 1, 1, 1},
+		},
+		{
+			name:      "ReduceOnPlateau reduces after patience",
+			scheduler: NewReduceOnPlateau(1, 0.5, 1, 0, 0),
+			metrics:   []float64{1, 2, 2, 0.5},
+			want:      []float64{1, 1, 1, 1, 1, 1, 0.5, 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []float64
+			for _, metric := range tt.metrics {
+				got = append(got, tt.scheduler.Step(), tt.scheduler.Step())
+				tt.scheduler.EndEpoch(metric)
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("learning rates = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
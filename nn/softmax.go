@@ -0,0 +1,126 @@
+package nn
+
+import (
+	"io"
+	"math"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// SoftmaxLayer turns each column of its input into a probability
+// distribution. It has no parameters, and is meant to be the last layer of a
+// classifier trained with CategoricalCrossEntropy, in which case its
+// gradient is fused with the loss' one.
+type SoftmaxLayer struct{}
+
+var _ Layer = &SoftmaxLayer{}
+
+// SoftmaxLayerState keeps the output, since the Jacobian of the softmax only
+// depends on it.
+type SoftmaxLayerState struct {
+	Output *t.Tensor
+}
+
+var _ LayerState = SoftmaxLayerState{}
+
+func (SoftmaxLayerState) layerState() {}
+
+func NewSoftmaxLayer() *SoftmaxLayer {
+	return &SoftmaxLayer{}
+}
+
+func (l *SoftmaxLayer) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	assert.LessThanOrEqual(in.Dims(), 2, "Input must be a matrix")
+
+	out := t.New(in.Rows(), in.Cols())
+	column := make([]float64, in.Rows())
+	for c := range in.Cols() {
+		for r := range in.Rows() {
+			column[r] = in.At(r, c)
+		}
+
+		// softmax(z)_k = exp(z_k - logSumExp(z)), avoids overflowing exp.
+		lse := logSumExp(column)
+		for r := range in.Rows() {
+			out.Set(math.Exp(column[r]-lse), r, c)
+		}
+	}
+
+	return out, SoftmaxLayerState{Output: out}
+}
+
+func (l *SoftmaxLayer) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	/* With p = softmax(z), dp_j/dz_k = p_j * (delta_jk - p_k), so
+
+	   dL/dz_k = p_k * (dL/dp_k - Sum_j(dL/dp_j * p_j))
+	*/
+	state, ok := s.(SoftmaxLayerState)
+	assert.True(ok, "State must match layer type")
+
+	p := state.Output
+	prevLayerGrad := t.New(p.Rows(), p.Cols())
+	for c := range p.Cols() {
+		dot := 0.0
+		for r := range p.Rows() {
+			dot += nextLayerGrad.At(r, c) * p.At(r, c)
+		}
+		for r := range p.Rows() {
+			prevLayerGrad.Set(p.At(r, c)*(nextLayerGrad.At(r, c)-dot), r, c)
+		}
+	}
+
+	return noGrad{}, prevLayerGrad
+}
+
+func (l *SoftmaxLayer) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {}
+
+func (l *SoftmaxLayer) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *SoftmaxLayer) TypeName() string { return "Softmax" }
+
+func (l *SoftmaxLayer) Save(w io.Writer) error {
+	// No parameters, the type is enough.
+	return nil
+}
+
+// softmaxCrossEntropyGradient computes the gradient of the cross-entropy
+// respecting the softmax's input directly, which reduces to
+// dL/dz_k = p_k * Sum_j(y_j) - y_k and never divides by a probability.
+func softmaxCrossEntropyGradient(output, expected *t.Tensor) *t.Tensor {
+	assert.True(t.EqDims(output, expected), "Output and expected must have the same shape")
+
+	grad := t.New(output.Rows(), output.Cols())
+	for c := range output.Cols() {
+		sum := 0.0
+		for r := range output.Rows() {
+			sum += expected.At(r, c)
+		}
+		for r := range output.Rows() {
+			grad.Set(output.At(r, c)*sum-expected.At(r, c), r, c)
+		}
+	}
+	return grad
+}
+
+func logSumExp(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = max(m, v)
+	}
+	if math.IsInf(m, 0) {
+		return m
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += math.Exp(v - m)
+	}
+	return m + math.Log(sum)
+}
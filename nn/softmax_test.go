@@ -0,0 +1,68 @@
+package nn
+
+import (
+	"math"
+	"testing"
+
+	ts "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+func TestSoftmaxLayer_Forward(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *ts.Tensor
+		want *ts.Tensor
+	}{
+		{
+			name: "uniform",
+			in:   ts.ColumnVector(1, 1, 1, 1),
+			want: ts.ColumnVector(0.25, 0.25, 0.25, 0.25),
+		},
+		{
+			name: "large values don't overflow",
+			in:   ts.ColumnVector(1000, 1000),
+			want: ts.ColumnVector(0.5, 0.5),
+		},
+		{
+			name: "each column separately",
+			in:   ts.WithData([]int32{2, 2}, []float64{0, 5, math.Log(3), 5}),
+			want: ts.WithData([]int32{2, 2}, []float64{0.25, 0.5, 0.75, 0.5}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := NewSoftmaxLayer().Forward(tt.in)
+			for i := range got.Data {
+				if math.Abs(got.Data[i]-tt.want.Data[i]) > 1e-12 {
+					t.Errorf("SoftmaxLayer.Forward() = %v, want %v", got.Data, tt.want.Data)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSoftmaxLayer_FusedGradient(t *testing.T) {
+	// The fused gradient must match backpropagating the loss through the softmax.
+	n := &NeuralNetwork{
+		Layers: []Layer{NewSoftmaxLayer()},
+		Loss:   CategoricalCrossEntropy{},
+	}
+	in := ts.ColumnVector(0.3, -1.2, 2.0)
+	expected := ts.ColumnVector(0, 1, 0)
+
+	fused := n.backpropBatch([]Sample{{In: in, Out: expected}})
+	if _, ok := fused[0].(noGrad); !ok {
+		t.Fatalf("Softmax layer gradient = %T, want noGrad", fused[0])
+	}
+
+	out, states := n.Forward(in)
+	_, unfused := n.Layers[0].ComputeGradients(states[0], n.Loss.Gradient(out, expected), 1.0)
+	fusedGrad, _ := n.lossGradient(out, expected)
+	for i := range unfused.Data {
+		if math.Abs(unfused.Data[i]-fusedGrad.Data[i]) > 1e-9 {
+			t.Errorf("fused gradient = %v, want %v", fusedGrad.Data, unfused.Data)
+			break
+		}
+	}
+}
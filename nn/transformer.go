@@ -0,0 +1,187 @@
+package nn
+
+import (
+	"io"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
+
+// TransformerEncoderBlock is a transformer encoder layer over (steps x
+// features x batch) sequences: self-attention followed by a feed-forward
+// network applied to each step, each with a residual connection and layer
+// normalization after it.
+//
+//	x = AttentionNorm(in + Attention(in))
+//	out = FeedForwardNorm(x + FeedForwardOutput(FeedForwardHidden(x)))
+type TransformerEncoderBlock struct {
+	Attention         *MultiHeadAttentionLayer
+	AttentionNorm     *LayerNormLayer
+	FeedForwardHidden *FullyConnectedLayer
+	FeedForwardOutput *FullyConnectedLayer
+	FeedForwardNorm   *LayerNormLayer
+}
+
+var (
+	_ Layer            = &TransformerEncoderBlock{}
+	_ RegularizedLayer = &TransformerEncoderBlock{}
+)
+
+// TransformerEncoderBlockGradient has the gradient of each of the block's
+// layers, in the order returned by layers.
+type TransformerEncoderBlockGradient struct {
+	Layers []LayerGrad
+}
+
+var _ LayerGrad = &TransformerEncoderBlockGradient{}
+
+func (g *TransformerEncoderBlockGradient) Add(another LayerGrad) {
+	g2, ok := another.(*TransformerEncoderBlockGradient)
+	assert.True(ok, "The gradient must be of the same type")
+
+	for i := range g.Layers {
+		g.Layers[i].Add(g2.Layers[i])
+	}
+}
+
+func (g *TransformerEncoderBlockGradient) Scale(factor float64) {
+	for _, lg := range g.Layers {
+		lg.Scale(factor)
+	}
+}
+
+// TransformerEncoderBlockState has the state of each of the block's layers,
+// in the order returned by layers.
+type TransformerEncoderBlockState struct {
+	Steps      int32
+	InputShape []int32
+	Layers     []LayerState
+}
+
+var _ LayerState = TransformerEncoderBlockState{}
+
+func (TransformerEncoderBlockState) layerState() {}
+
+// NewTransformerEncoderBlock creates a block whose feed-forward network has
+// a hidden layer of the given size, with ReLU activations.
+func NewTransformerEncoderBlock(features, heads, feedForwardSize int32, causal bool) *TransformerEncoderBlock {
+	return &TransformerEncoderBlock{
+		Attention:         NewMultiHeadAttentionLayer(features, heads, causal),
+		AttentionNorm:     NewLayerNormLayer(features),
+		FeedForwardHidden: NewFullyConnectedLayer(features, feedForwardSize, ReLU{}),
+		FeedForwardOutput: NewFullyConnectedLayer(feedForwardSize, features, NoActF{}),
+		FeedForwardNorm:   NewLayerNormLayer(features),
+	}
+}
+
+func (l *TransformerEncoderBlock) layers() []Layer {
+	return []Layer{l.Attention, l.AttentionNorm, l.FeedForwardHidden, l.FeedForwardOutput, l.FeedForwardNorm}
+}
+
+func (l *TransformerEncoderBlock) Forward(in *t.Tensor) (*t.Tensor, LayerState) {
+	state := TransformerEncoderBlockState{Steps: in.Dim(0), InputShape: in.Shape, Layers: make([]LayerState, 5)}
+	in = asSequence(in, l.AttentionNorm.Gamma.Rows())
+
+	attended, s0 := l.Attention.Forward(in)
+	x, s1 := l.AttentionNorm.Forward(attended.AddInPlace(in))
+
+	// The feed-forward network sees each step of each sample as a column.
+	hidden, s2 := l.FeedForwardHidden.Forward(toColumns(x))
+	fedForward, s3 := l.FeedForwardOutput.Forward(hidden)
+	out, s4 := l.FeedForwardNorm.Forward(fromColumns(fedForward, state.Steps).AddInPlace(x))
+
+	copy(state.Layers, []LayerState{s0, s1, s2, s3, s4})
+	return out.Reshape(state.InputShape...), state
+}
+
+func (l *TransformerEncoderBlock) ComputeGradients(
+	s LayerState,
+	nextLayerGrad *t.Tensor,
+	gradClipping float64,
+) (LayerGrad, *t.Tensor) {
+	state, ok := s.(TransformerEncoderBlockState)
+	assert.True(ok, "State must match layer type")
+
+	grad := &TransformerEncoderBlockGradient{Layers: make([]LayerGrad, 5)}
+	var xGrad, hiddenGrad, columnsGrad, attendedGrad, inGrad *t.Tensor
+	nextLayerGrad = asSequence(nextLayerGrad, l.AttentionNorm.Gamma.Rows())
+
+	// The residual connections add the gradient of the sum to their input's.
+	grad.Layers[4], xGrad = l.FeedForwardNorm.ComputeGradients(state.Layers[4], nextLayerGrad, gradClipping)
+	grad.Layers[3], hiddenGrad = l.FeedForwardOutput.ComputeGradients(state.Layers[3], toColumns(xGrad), gradClipping)
+	grad.Layers[2], columnsGrad = l.FeedForwardHidden.ComputeGradients(state.Layers[2], hiddenGrad, gradClipping)
+	xGrad = fromColumns(columnsGrad, state.Steps).AddInPlace(xGrad)
+
+	grad.Layers[1], attendedGrad = l.AttentionNorm.ComputeGradients(state.Layers[1], xGrad, gradClipping)
+	grad.Layers[0], inGrad = l.Attention.ComputeGradients(state.Layers[0], attendedGrad, gradClipping)
+
+	return grad, inGrad.AddInPlace(attendedGrad).Reshape(state.InputShape...)
+}
+
+func (l *TransformerEncoderBlock) UpdateParams(grad LayerGrad, opt Optimizer, learningRate float64) {
+	tGrad, ok := grad.(*TransformerEncoderBlockGradient)
+	assert.True(ok, "Gradient must match layer type")
+
+	for i, layer := range l.layers() {
+		layer.UpdateParams(tGrad.Layers[i], opt, learningRate)
+	}
+}
+
+// SetRegularization sets r on the attention and feed-forward layers.
+func (l *TransformerEncoderBlock) SetRegularization(r Regularization) {
+	setRegularization(l.layers(), r)
+}
+
+func (l *TransformerEncoderBlock) penalty() float64 {
+	return regularizationPenalty(l.layers())
+}
+
+func (l *TransformerEncoderBlock) features() (in, out int32) {
+	return -1, -1
+}
+
+func (l *TransformerEncoderBlock) TypeName() string { return "TransformerEncoderBlock" }
+
+// Save writes each of the layers, their types are known.
+func (l *TransformerEncoderBlock) Save(w io.Writer) error {
+	for _, layer := range l.layers() {
+		err := layer.Save(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadTransformerEncoderBlock(r io.Reader) (*TransformerEncoderBlock, error) {
+	var err error
+	l := &TransformerEncoderBlock{}
+	l.Attention, err = loadMultiHeadAttentionLayer(r)
+	if err != nil {
+		return nil, err
+	}
+	l.AttentionNorm, err = loadLayerNormLayer(r)
+	if err != nil {
+		return nil, err
+	}
+	l.FeedForwardHidden, err = loadFullyConnectedLayer(r)
+	if err != nil {
+		return nil, err
+	}
+	l.FeedForwardOutput, err = loadFullyConnectedLayer(r)
+	if err != nil {
+		return nil, err
+	}
+	l.FeedForwardNorm, err = loadLayerNormLayer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	features := l.Attention.Weights[queryProjection].Rows()
+	if l.AttentionNorm.Gamma.Rows() != features || l.FeedForwardNorm.Gamma.Rows() != features ||
+		l.FeedForwardHidden.Weights.Cols() != features || l.FeedForwardOutput.Weights.Rows() != features ||
+		l.FeedForwardOutput.Weights.Cols() != l.FeedForwardHidden.Weights.Rows() {
+		return nil, formatError("TransformerEncoderBlock layers with mismatched sizes")
+	}
+	return l, nil
+}
@@ -1,6 +1,12 @@
 package nn
 
-import "math/rand"
+import (
+	"math/rand"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+	t "github.com/ManuelGarciaF/neural-networks/tensor"
+)
 
 func ceilingDiv(a, b int) int {
 	return (a + b - 1) / b
@@ -19,3 +25,49 @@ func randomSubset[T any](ts []T, n int) []T {
 	}
 	return subset
 }
+
+// batchSamples stacks the inputs and outputs of the samples into tensors
+// whose last dimension is the batch.
+func batchSamples(samples []Sample) (in, out *t.Tensor) {
+	ins := make([]*t.Tensor, len(samples))
+	outs := make([]*t.Tensor, len(samples))
+	for i, s := range samples {
+		ins[i] = s.In
+		outs[i] = s.Out
+	}
+	return stack(ins), stackTargets(outs)
+}
+
+// stack joins same-sized tensors along a new trailing dimension. Column
+// vectors are treated as plain vectors, so a list of them becomes a matrix
+// with one column per tensor, and scalars (like token IDs) become a vector.
+func stack(ts []*t.Tensor) *t.Tensor {
+	assert.GreaterThan(len(ts), 0, "Can't stack 0 tensors")
+
+	shape := slices.Clone(ts[0].Shape)
+	switch {
+	case len(shape) == 2 && shape[1] == 1:
+		shape = shape[:1]
+	}
+	batchSize := len(ts)
+	out := t.New(append(shape, int32(batchSize))...)
+
+	// The batch dimension is the fastest moving one.
+	for i, tensor := range ts {
+		assert.Equal(tensor.Size(), ts[0].Size(), "Tensors must have the same size")
+		for j, v := range tensor.Contiguous().Data {
+			out.Data[j*batchSize+i] = v
+		}
+	}
+	return out
+}
+
+// stackTargets stacks expected outputs, scalar ones become a row to match
+// the (1 x batch) output of a layer with a single unit.
+func stackTargets(ts []*t.Tensor) *t.Tensor {
+	out := stack(ts)
+	if ts[0].Dims() == 0 {
+		return out.Reshape(1, out.Dim(0))
+	}
+	return out
+}
@@ -0,0 +1,154 @@
+package tensor
+
+import (
+	"math"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+/* Elementwise operations between tensors follow NumPy's broadcasting rules:
+   shapes are aligned by their trailing dimensions, missing leading
+   dimensions count as 1, and a dimension of size 1 is repeated to match the
+   other tensor's. For example a (3, 1) column can be added to a (3, 4)
+   matrix, and a (4) vector to a (2, 3, 4) tensor.
+
+   Shapes considered equal by EqDims (which only differ in trailing
+   dimensions of size 1) are operated elementwise, keeping the first
+   tensor's shape.
+*/
+
+func Div(t1, t2 *Tensor) *Tensor {
+	return zipWith(t1, t2, func(a, b float64) float64 { return a / b })
+}
+
+// Pow raises each element of t1 to the corresponding element of t2.
+func Pow(t1, t2 *Tensor) *Tensor {
+	return zipWith(t1, t2, math.Pow)
+}
+
+// Maximum returns the largest of each pair of elements.
+func Maximum(t1, t2 *Tensor) *Tensor {
+	return zipWith(t1, t2, func(a, b float64) float64 { return max(a, b) })
+}
+
+// Minimum returns the smallest of each pair of elements.
+func Minimum(t1, t2 *Tensor) *Tensor {
+	return zipWith(t1, t2, func(a, b float64) float64 { return min(a, b) })
+}
+
+// BroadcastShape returns the shape of the result of an elementwise operation
+// between tensors of the given shapes, and whether they are compatible.
+func BroadcastShape(s1, s2 []int32) ([]int32, bool) {
+	dims := max(len(s1), len(s2))
+	shape := make([]int32, dims)
+	for i := 1; i <= dims; i++ {
+		d1, d2 := broadcastDim(s1, i), broadcastDim(s2, i)
+		switch {
+		case d1 == d2 || d2 == 1:
+			shape[dims-i] = d1
+		case d1 == 1:
+			shape[dims-i] = d2
+		default:
+			return nil, false
+		}
+	}
+	return shape, true
+}
+
+// broadcastDim returns the size of the i-th dimension counting from the end,
+// 1 if the shape doesn't have that many.
+func broadcastDim(shape []int32, i int) int32 {
+	if i > len(shape) {
+		return 1
+	}
+	return shape[len(shape)-i]
+}
+
+// zipWith applies f to each pair of elements, broadcasting as needed.
+func zipWith(t1, t2 *Tensor, f func(a, b float64) float64) *Tensor {
+	if EqDims(t1, t2) {
+		out := t1.Copy()
+		data2 := t2.Contiguous().Data
+		for i := range out.Data {
+			out.Data[i] = f(out.Data[i], data2[i])
+		}
+		return out
+	}
+
+	shape, ok := BroadcastShape(t1.Shape, t2.Shape)
+	assert.True(ok, "Tensors can't be broadcast together")
+
+	out := New(shape...)
+	forEachBroadcast(out, t1, t2, func(i, i1, i2 int32) {
+		out.Data[i] = f(t1.Data[i1], t2.Data[i2])
+	})
+	return out
+}
+
+// zipWithInPlace is like zipWith, storing the results in t1. t2 must
+// broadcast to t1's shape.
+func zipWithInPlace(t1, t2 *Tensor, f func(a, b float64) float64) *Tensor {
+	if EqDims(t1, t2) {
+		if t1.IsContiguous() {
+			data2 := t2.Contiguous().Data
+			for i := range t1.Data {
+				t1.Data[i] = f(t1.Data[i], data2[i])
+			}
+			return t1
+		}
+		// Give t2 the exact same shape, so it's walked like t1.
+		t2 = t2.Reshape(t1.Shape...)
+	}
+
+	shape, ok := BroadcastShape(t1.Shape, t2.Shape)
+	assert.True(ok && slices.Equal(shape, t1.Shape), "Tensor can't be broadcast to the receiver's shape")
+
+	forEachBroadcast(t1, t1, t2, func(i, i1, i2 int32) {
+		t1.Data[i] = f(t1.Data[i1], t2.Data[i2])
+	})
+	return t1
+}
+
+// forEachBroadcast calls f with the index into Data of every element of out,
+// and the indices of the elements of t1 and t2 that correspond to it.
+func forEachBroadcast(out, t1, t2 *Tensor, f func(i, i1, i2 int32)) {
+	shape := out.Shape
+	strides := broadcastStrides(out, shape)
+	strides1 := broadcastStrides(t1, shape)
+	strides2 := broadcastStrides(t2, shape)
+
+	index := make([]int32, len(shape))
+	i, i1, i2 := int32(0), int32(0), int32(0)
+	for range out.Size() {
+		f(i, i1, i2)
+
+		// Advance the index like an odometer, from the last dimension.
+		for d := len(shape) - 1; d >= 0; d-- {
+			index[d]++
+			i += strides[d]
+			i1 += strides1[d]
+			i2 += strides2[d]
+			if index[d] < shape[d] {
+				break
+			}
+			i -= strides[d] * shape[d]
+			i1 -= strides1[d] * shape[d]
+			i2 -= strides2[d] * shape[d]
+			index[d] = 0
+		}
+	}
+}
+
+// broadcastStrides returns the strides to walk t as if it had the given
+// shape, 0 along the dimensions where it gets repeated.
+func broadcastStrides(t *Tensor, shape []int32) []int32 {
+	strides := make([]int32, len(shape))
+	offset := len(shape) - t.Dims()
+	for d := range t.Dims() {
+		if t.Shape[d] != 1 {
+			strides[offset+d] = t.strides[d]
+		}
+	}
+	return strides
+}
@@ -0,0 +1,16 @@
+//go:build !noasserts
+
+package tensor
+
+import "testing"
+
+// Only asserts catch this, builds without them don't check.
+func TestAddInPlaceBroadcastPanic(t *testing.T) {
+	m := WithData([]int32{2, 2}, []float64{1, 2, 3, 4})
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("AddInPlace() with a bigger tensor did not panic")
+		}
+	}()
+	ColumnVector(1, 2).AddInPlace(m)
+}
@@ -0,0 +1,106 @@
+package tensor
+
+import (
+	"testing"
+)
+
+func TestBroadcastShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		s1, s2 []int32
+		want   []int32
+		wantOk bool
+	}{
+		{"same", []int32{2, 3}, []int32{2, 3}, []int32{2, 3}, true},
+		{"column to matrix", []int32{3, 1}, []int32{3, 4}, []int32{3, 4}, true},
+		{"row to matrix", []int32{1, 4}, []int32{3, 4}, []int32{3, 4}, true},
+		{"vector aligns with last dim", []int32{4}, []int32{2, 3, 4}, []int32{2, 3, 4}, true},
+		{"scalar", []int32{}, []int32{2, 3}, []int32{2, 3}, true},
+		{"both expand", []int32{3, 1}, []int32{1, 4}, []int32{3, 4}, true},
+		{"incompatible", []int32{3, 2}, []int32{3, 4}, nil, false},
+		{"vector doesn't align with first dim", []int32{3}, []int32{3, 4}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := BroadcastShape(tt.s1, tt.s2)
+			if ok != tt.wantOk || (ok && !Eq(New(got...), New(tt.want...))) {
+				t.Errorf("BroadcastShape() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestBroadcastOps(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(t1, t2 *Tensor) *Tensor
+		t1   *Tensor
+		t2   *Tensor
+		want *Tensor
+	}{
+		{
+			name: "Add bias column to batch",
+			op:   Add,
+			t1:   WithData([]int32{2, 3}, []float64{1, 2, 3, 4, 5, 6}),
+			t2:   ColumnVector(10, 20),
+			want: WithData([]int32{2, 3}, []float64{11, 12, 13, 24, 25, 26}),
+		},
+		{
+			name: "Sub row from matrix",
+			op:   Sub,
+			t1:   WithData([]int32{2, 2}, []float64{1, 2, 3, 4}),
+			t2:   RowVector(1, 2),
+			want: WithData([]int32{2, 2}, []float64{0, 0, 2, 2}),
+		},
+		{
+			name: "ElementMult outer product",
+			op:   ElementMult,
+			t1:   ColumnVector(1, 2),
+			t2:   RowVector(3, 4, 5),
+			want: WithData([]int32{2, 3}, []float64{3, 4, 5, 6, 8, 10}),
+		},
+		{
+			name: "Div by scalar",
+			op:   Div,
+			t1:   ColumnVector(2, 4),
+			t2:   Scalar(2),
+			want: ColumnVector(1, 2),
+		},
+		{
+			name: "Pow",
+			op:   Pow,
+			t1:   RowVector(2, 3),
+			t2:   Scalar(2),
+			want: RowVector(4, 9),
+		},
+		{
+			name: "Maximum",
+			op:   Maximum,
+			t1:   RowVector(-1, 3, 0),
+			t2:   Scalar(0),
+			want: RowVector(0, 3, 0),
+		},
+		{
+			name: "Minimum 3D",
+			op:   Minimum,
+			t1:   WithData([]int32{2, 1, 2}, []float64{1, 5, 2, 6}),
+			t2:   WithData([]int32{2, 1}, []float64{3, 4}),
+			want: WithData([]int32{2, 2, 2}, []float64{1, 3, 1, 4, 2, 3, 2, 4}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.op(tt.t1, tt.t2); !Eq(got, tt.want) {
+				t.Errorf("got %v (shape %v), want %v (shape %v)", got.Data, got.Shape, tt.want.Data, tt.want.Shape)
+			}
+		})
+	}
+}
+
+func TestAddInPlaceBroadcast(t *testing.T) {
+	m := WithData([]int32{2, 2}, []float64{1, 2, 3, 4})
+	m.AddInPlace(ColumnVector(1, 2))
+	if want := WithData([]int32{2, 2}, []float64{2, 3, 5, 6}); !Eq(m, want) {
+		t.Errorf("AddInPlace() = %v, want %v", m.Data, want.Data)
+	}
+}
@@ -0,0 +1,174 @@
+package tensor
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+// Sizes of the tiles the multiplication is split into, chosen so a tile of
+// the right operand fits comfortably in L2 cache.
+const (
+	tileRows  = 64
+	tileInner = 128
+	tileCols  = 256
+)
+
+// Multiplications with fewer multiply-adds than this run on a single
+// goroutine, spawning more wouldn't pay off.
+const parallelThreshold = 1 << 18
+
+var matMulWorkers atomic.Int32
+
+func init() {
+	matMulWorkers.Store(int32(runtime.NumCPU()))
+}
+
+// SetMatMulWorkers sets the maximum number of goroutines a single matrix
+// multiplication can use, 1 disables parallelism. Defaults to the number of
+// CPUs.
+func SetMatMulWorkers(n int) {
+	assert.GreaterThan(n, 0, "Must be positive")
+	matMulWorkers.Store(int32(n))
+}
+
+// MatMul returns left * right.
+func MatMul(left, right *Tensor) *Tensor {
+	assert.LessThanOrEqual(left.Dims(), 2, "Element is not a matrix")
+	assert.LessThanOrEqual(right.Dims(), 2, "Element is not a matrix")
+	assert.Equal(left.Cols(), right.Rows(), "Matrix dimensions do not match")
+	left, right = left.Contiguous(), right.Contiguous()
+
+	m, k, n := int(left.Rows()), int(left.Cols()), int(right.Cols())
+	out := New(int32(m), int32(n))
+
+	if n == 1 { // Matrix-vector, each output is a dot product
+		parallelRows(m, m*k, func(from, to int) {
+			for i := from; i < to; i++ {
+				out.Data[i] = dot(left.Data[i*k:(i+1)*k], right.Data[:k])
+			}
+		})
+		return out
+	}
+
+	parallelRows(m, m*k*n, func(from, to int) {
+		matMulNN(left.Data, right.Data, out.Data, from, to, k, n)
+	})
+	return out
+}
+
+// MatMulTransA returns left^T * right, without transposing left.
+func MatMulTransA(left, right *Tensor) *Tensor {
+	assert.LessThanOrEqual(left.Dims(), 2, "Element is not a matrix")
+	assert.LessThanOrEqual(right.Dims(), 2, "Element is not a matrix")
+	assert.Equal(left.Rows(), right.Rows(), "Matrix dimensions do not match")
+	left, right = left.Contiguous(), right.Contiguous()
+
+	k, m, n := int(left.Rows()), int(left.Cols()), int(right.Cols())
+	out := New(int32(m), int32(n))
+
+	parallelRows(m, m*k*n, func(from, to int) {
+		// Every row of left contributes to each output row, scaled by
+		// the corresponding row of right.
+		for p0 := 0; p0 < k; p0 += tileInner {
+			p1 := min(p0+tileInner, k)
+			for i := from; i < to; i++ {
+				outRow := out.Data[i*n : (i+1)*n]
+				for p := p0; p < p1; p++ {
+					axpy(left.Data[p*m+i], right.Data[p*n:(p+1)*n], outRow)
+				}
+			}
+		}
+	})
+	return out
+}
+
+// MatMulTransB returns left * right^T, without transposing right.
+func MatMulTransB(left, right *Tensor) *Tensor {
+	assert.LessThanOrEqual(left.Dims(), 2, "Element is not a matrix")
+	assert.LessThanOrEqual(right.Dims(), 2, "Element is not a matrix")
+	assert.Equal(left.Cols(), right.Cols(), "Matrix dimensions do not match")
+	left, right = left.Contiguous(), right.Contiguous()
+
+	m, k, n := int(left.Rows()), int(left.Cols()), int(right.Rows())
+	out := New(int32(m), int32(n))
+
+	parallelRows(m, m*k*n, func(from, to int) {
+		// Both operands are traversed along their rows, so every output is
+		// a dot product of contiguous memory.
+		for j0 := 0; j0 < n; j0 += tileRows {
+			j1 := min(j0+tileRows, n)
+			for i := from; i < to; i++ {
+				leftRow := left.Data[i*k : (i+1)*k]
+				for j := j0; j < j1; j++ {
+					out.Data[i*n+j] = dot(leftRow, right.Data[j*k:(j+1)*k])
+				}
+			}
+		}
+	})
+	return out
+}
+
+// matMulNN computes rows [from, to) of out = a * b, where a has k columns
+// and b has n columns.
+func matMulNN(a, b, out []float64, from, to, k, n int) {
+	// The i-p-j order walks b and out along their rows. Tiling keeps the
+	// part of b being used in cache while all the rows are processed.
+	for j0 := 0; j0 < n; j0 += tileCols {
+		j1 := min(j0+tileCols, n)
+		for p0 := 0; p0 < k; p0 += tileInner {
+			p1 := min(p0+tileInner, k)
+			for i := from; i < to; i++ {
+				outRow := out[i*n+j0 : i*n+j1]
+				for p := p0; p < p1; p++ {
+					axpy(a[i*k+p], b[p*n+j0:p*n+j1], outRow)
+				}
+			}
+		}
+	}
+}
+
+// parallelRows splits rows [0, rows) in blocks processed by different
+// goroutines, as long as the amount of work justifies it.
+func parallelRows(rows, work int, f func(from, to int)) {
+	workers := min(int(matMulWorkers.Load()), ceilDiv(rows, tileRows))
+	if workers <= 1 || work < parallelThreshold {
+		f(0, rows)
+		return
+	}
+
+	blockSize := ceilDiv(rows, workers)
+	var wg sync.WaitGroup
+	for from := 0; from < rows; from += blockSize {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(from, min(from+blockSize, rows))
+		}()
+	}
+	wg.Wait()
+}
+
+func dot(x, y []float64) float64 {
+	y = y[:len(x)] // Lets the compiler drop the bounds checks
+	sum := 0.0
+	for i, v := range x {
+		sum += v * y[i]
+	}
+	return sum
+}
+
+// axpy computes y += alpha*x. Zero alphas aren't skipped, 0*NaN and 0*Inf
+// must still give NaN.
+func axpy(alpha float64, x, y []float64) {
+	y = y[:len(x)]
+	for i, v := range x {
+		y[i] += alpha * v
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,157 @@
+package tensor
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// naiveMatMul is the original implementation, kept as a reference.
+func naiveMatMul(left, right *Tensor) *Tensor {
+	outRows := left.Rows()
+	outCols := right.Cols()
+	sumLen := left.Cols()
+
+	out := New(outRows, outCols)
+	for row := range outRows {
+		for col := range outCols {
+			val := 0.0
+			for i := range sumLen {
+				val += left.At(row, i) * right.At(i, col)
+			}
+			out.Set(val, row, col)
+		}
+	}
+
+	return out
+}
+
+func randomMatrix(rows, cols int32) *Tensor {
+	m := New(rows, cols)
+	for i := range m.Data {
+		m.Data[i] = rand.NormFloat64()
+	}
+	return m
+}
+
+func approxEq(t1, t2 *Tensor) bool {
+	if !EqDims(t1, t2) {
+		return false
+	}
+	for i := range t1.Data {
+		if math.Abs(t1.Data[i]-t2.Data[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMatMulVariants(t *testing.T) {
+	// Sizes around the tile boundaries, and big enough to run in parallel.
+	sizes := [][3]int32{
+		{1, 1, 1},
+		{3, 5, 1},
+		{7, 130, 3},
+		{65, 129, 257},
+		{200, 300, 100},
+	}
+
+	for _, size := range sizes {
+		m, k, n := size[0], size[1], size[2]
+		left := randomMatrix(m, k)
+		right := randomMatrix(k, n)
+		want := naiveMatMul(left, right)
+
+		t.Run(fmt.Sprintf("%dx%d*%dx%d", m, k, k, n), func(t *testing.T) {
+			if got := MatMul(left, right); !approxEq(got, want) {
+				t.Errorf("MatMul() differs from the naive implementation")
+			}
+			if got := MatMulTransA(MatTranspose(left), right); !approxEq(got, want) {
+				t.Errorf("MatMulTransA() differs from the naive implementation")
+			}
+			if got := MatMulTransB(left, MatTranspose(right)); !approxEq(got, want) {
+				t.Errorf("MatMulTransB() differs from the naive implementation")
+			}
+		})
+	}
+}
+
+func TestMatMulVariants_NaN(t *testing.T) {
+	// 0 * NaN is NaN, zeros in the left operand can't hide it.
+	left := WithData([]int32{2, 2}, []float64{0, 1, 1, 1})
+	right := WithData([]int32{2, 2}, []float64{math.NaN(), 2, 3, 4})
+
+	results := map[string]*Tensor{
+		"MatMul":       MatMul(left, right),
+		"MatMulTransA": MatMulTransA(MatTranspose(left), right),
+		"MatMulTransB": MatMulTransB(left, MatTranspose(right)),
+	}
+	for name, got := range results {
+		if !math.IsNaN(got.At(0, 0)) || !math.IsNaN(got.At(1, 0)) {
+			t.Errorf("%s() = %v, want NaN in the first column", name, got.Data)
+		}
+	}
+}
+
+func BenchmarkMatMul(b *testing.B) {
+	sizes := [][3]int32{
+		{64, 64, 64},
+		{256, 256, 256},
+		{256, 784, 1},  // A MNIST sample through the first layer
+		{256, 784, 32}, // A MNIST mini-batch through the first layer
+	}
+
+	for _, size := range sizes {
+		left := randomMatrix(size[0], size[1])
+		right := randomMatrix(size[1], size[2])
+		name := fmt.Sprintf("%dx%d*%dx%d", size[0], size[1], size[1], size[2])
+
+		b.Run("naive/"+name, func(b *testing.B) {
+			for b.Loop() {
+				naiveMatMul(left, right)
+			}
+		})
+		b.Run("fast/"+name, func(b *testing.B) {
+			for b.Loop() {
+				MatMul(left, right)
+			}
+		})
+		b.Run("single-threaded/"+name, func(b *testing.B) {
+			SetMatMulWorkers(1)
+			defer SetMatMulWorkers(runtime.NumCPU())
+			for b.Loop() {
+				MatMul(left, right)
+			}
+		})
+	}
+}
+
+func BenchmarkMatMulTransposed(b *testing.B) {
+	// The shapes used when computing the gradients of a MNIST mini-batch.
+	delta := randomMatrix(256, 32)
+	input := randomMatrix(784, 32)
+	weights := randomMatrix(256, 784)
+
+	b.Run("MatTranspose+MatMul/delta*input^T", func(b *testing.B) {
+		for b.Loop() {
+			MatMul(delta, MatTranspose(input))
+		}
+	})
+	b.Run("MatMulTransB/delta*input^T", func(b *testing.B) {
+		for b.Loop() {
+			MatMulTransB(delta, input)
+		}
+	})
+	b.Run("MatTranspose+MatMul/weights^T*delta", func(b *testing.B) {
+		for b.Loop() {
+			MatMul(MatTranspose(weights), delta)
+		}
+	})
+	b.Run("MatMulTransA/weights^T*delta", func(b *testing.B) {
+		for b.Loop() {
+			MatMulTransA(weights, delta)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package tensor
+
+import (
+	"math"
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+/* Reductions collapse one axis of the tensor. Negative axes count from the
+   end, -1 being the last one. With keepDims the reduced axis is kept with
+   size 1, so the result broadcasts against the original tensor, otherwise
+   it's removed.
+*/
+
+func (t *Tensor) Sum(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, func(lane []float64) float64 {
+		sum := 0.0
+		for _, v := range lane {
+			sum += v
+		}
+		return sum
+	})
+}
+
+func (t *Tensor) Prod(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, func(lane []float64) float64 {
+		prod := 1.0
+		for _, v := range lane {
+			prod *= v
+		}
+		return prod
+	})
+}
+
+func (t *Tensor) Mean(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, mean)
+}
+
+func (t *Tensor) Max(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, slices.Max[[]float64])
+}
+
+func (t *Tensor) Min(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, slices.Min[[]float64])
+}
+
+// ArgMax returns the index of the largest element along the axis, the first
+// one in case of ties.
+func (t *Tensor) ArgMax(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, func(lane []float64) float64 {
+		return float64(argBest(lane, func(a, b float64) bool { return a > b }))
+	})
+}
+
+// ArgMin returns the index of the smallest element along the axis, the
+// first one in case of ties.
+func (t *Tensor) ArgMin(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, func(lane []float64) float64 {
+		return float64(argBest(lane, func(a, b float64) bool { return a < b }))
+	})
+}
+
+// Var returns the population variance (dividing by N) along the axis.
+func (t *Tensor) Var(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, variance)
+}
+
+// Std returns the population standard deviation along the axis.
+func (t *Tensor) Std(axis int, keepDims bool) *Tensor {
+	return t.reduce(axis, keepDims, func(lane []float64) float64 {
+		return math.Sqrt(variance(lane))
+	})
+}
+
+// reduce calls f with every lane of elements along the axis, storing the
+// results in a tensor without that axis (or with size 1 if keepDims).
+func (t *Tensor) reduce(axis int, keepDims bool, f func(lane []float64) float64) *Tensor {
+	if axis < 0 {
+		axis += t.Dims()
+	}
+	assert.True(axis >= 0 && axis < t.Dims(), "Invalid axis")
+	assert.GreaterThan(t.Shape[axis], 0, "Can't reduce an empty axis")
+
+	// View the tensor as (outer, n, inner), with n the axis being reduced.
+	c := t.Contiguous()
+	n := c.Shape[axis]
+	inner := int32(1)
+	for _, dim := range c.Shape[axis+1:] {
+		inner *= dim
+	}
+	outer := c.Size() / (n * inner)
+
+	shape := slices.Clone(c.Shape)
+	if keepDims {
+		shape[axis] = 1
+	} else {
+		shape = slices.Delete(shape, axis, axis+1)
+	}
+	out := New(shape...)
+
+	lane := make([]float64, n)
+	for o := range outer {
+		for i := range inner {
+			for k := range n {
+				lane[k] = c.Data[(o*n+k)*inner+i]
+			}
+			out.Data[o*inner+i] = f(lane)
+		}
+	}
+	return out
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func variance(values []float64) float64 {
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values))
+}
+
+// argBest returns the index of the first value that no other is better than.
+func argBest(values []float64, better func(a, b float64) bool) int {
+	best := 0
+	for i, v := range values {
+		if better(v, values[best]) {
+			best = i
+		}
+	}
+	return best
+}
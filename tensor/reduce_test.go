@@ -0,0 +1,58 @@
+package tensor
+
+import (
+	"testing"
+)
+
+func TestReductions(t *testing.T) {
+	// [[1 -5 3]
+	//  [4  2 3]]
+	m := WithData([]int32{2, 3}, []float64{1, -5, 3, 4, 2, 3})
+	// Two 2x2 matrices stacked
+	cube := WithData([]int32{2, 2, 2}, []float64{1, 2, 3, 4, 5, 6, 7, 8})
+
+	tests := []struct {
+		name string
+		got  *Tensor
+		want *Tensor
+	}{
+		{"Sum rows", m.Sum(0, false), WithData([]int32{3}, []float64{5, -3, 6})},
+		{"Sum cols keepDims", m.Sum(1, true), ColumnVector(-1, 9)},
+		{"Sum negative axis", m.Sum(-1, false), WithData([]int32{2}, []float64{-1, 9})},
+		{"Prod", m.Prod(0, false), WithData([]int32{3}, []float64{4, -10, 9})},
+		{"Mean", m.Mean(1, false), WithData([]int32{2}, []float64{-1.0 / 3, 3})},
+		{"Max", m.Max(1, false), WithData([]int32{2}, []float64{3, 4})},
+		{"Min", m.Min(0, true), RowVector(1, -5, 3)},
+		{"ArgMax negative values", WithData([]int32{3}, []float64{-3, -1, -2}).ArgMax(0, false), Scalar(1)},
+		{"ArgMax ties", m.ArgMax(0, false), WithData([]int32{3}, []float64{1, 1, 0})},
+		{"ArgMin", m.ArgMin(1, false), WithData([]int32{2}, []float64{1, 1})},
+		{"Var", RowVector(1, 2, 3, 4).Var(1, false), WithData([]int32{1}, []float64{1.25})},
+		{"Std", RowVector(2, 4, 4, 4, 5, 5, 7, 9).Std(1, false), WithData([]int32{1}, []float64{2})},
+		{"Sum 3D middle axis", cube.Sum(1, false), WithData([]int32{2, 2}, []float64{4, 6, 12, 14})},
+		{"Max 3D first axis", cube.Max(0, true), WithData([]int32{1, 2, 2}, []float64{5, 6, 7, 8})},
+		{"Sum of a view", m.Transpose().Sum(0, false), WithData([]int32{2}, []float64{-1, 9})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !approxEq(tt.got, tt.want) || len(tt.got.Shape) != len(tt.want.Shape) {
+				t.Errorf("got %v (shape %v), want %v (shape %v)", tt.got.Data, tt.got.Shape, tt.want.Data, tt.want.Shape)
+			}
+		})
+	}
+}
+
+func TestNormalizeWithReductions(t *testing.T) {
+	// One feature per row, one sample per column.
+	data := WithData([]int32{2, 3}, []float64{1, 2, 3, 10, 20, 30})
+	normalized := Div(Sub(data, data.Mean(1, true)), data.Std(1, true))
+
+	for r := range int32(2) {
+		row := normalized.Row(r)
+		if mean := row.Mean(1, false).Data[0]; mean > 1e-12 || mean < -1e-12 {
+			t.Errorf("row %d mean = %v, want 0", r, mean)
+		}
+		if std := row.Std(1, false).Data[0]; std-1 > 1e-12 || 1-std > 1e-12 {
+			t.Errorf("row %d std = %v, want 1", r, std)
+		}
+	}
+}
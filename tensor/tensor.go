@@ -32,6 +32,19 @@ func New(shape ...int32) *Tensor {
 		size *= dim
 	}
 
+	return &Tensor{
+		Data:    make([]float64, size),
+		Shape:   shape,
+		strides: contiguousStrides(shape),
+	}
+}
+
+// contiguousStrides returns the strides of a row-major tensor of that shape.
+func contiguousStrides(shape []int32) []int32 {
+	if len(shape) == 0 {
+		return []int32{1}
+	}
+
 	// Strides are built up from the end
 	strides := make([]int32, len(shape))
 	strides[len(shape)-1] = 1
@@ -39,12 +52,7 @@ func New(shape ...int32) *Tensor {
 	for i := len(shape) - 2; i >= 0; i-- {
 		strides[i] = strides[i+1] * shape[i+1]
 	}
-
-	return &Tensor{
-		Data:    make([]float64, size),
-		Shape:   shape,
-		strides: strides,
-	}
+	return strides
 }
 
 func WithData(shape []int32, data []float64) *Tensor {
@@ -101,15 +109,23 @@ func (t *Tensor) Cols() int32 {
 	return t.Dim(1)
 }
 
+// Copy returns a contiguous copy of the tensor, even if it's a view.
 func (t *Tensor) Copy() *Tensor {
-	data := make([]float64, len(t.Data))
-	copy(data, t.Data)
 	shape := make([]int32, len(t.Shape))
 	copy(shape, t.Shape)
-	strides := make([]int32, len(t.strides))
-	copy(strides, t.strides)
 
-	return &Tensor{Data: data, Shape: shape, strides: strides}
+	data := make([]float64, t.Size())
+	if t.IsContiguous() {
+		copy(data, t.Data)
+	} else {
+		i := 0
+		t.forEachOffset(func(offset int32) {
+			data[i] = t.Data[offset]
+			i++
+		})
+	}
+
+	return &Tensor{Data: data, Shape: shape, strides: contiguousStrides(shape)}
 }
 
 func EqDims(t1, t2 *Tensor) bool {
@@ -125,85 +141,29 @@ func EqDims(t1, t2 *Tensor) bool {
 }
 
 func Eq(t1, t2 *Tensor) bool {
-	return EqDims(t1, t2) && slices.Equal(t1.Data, t2.Data)
+	return EqDims(t1, t2) && slices.Equal(t1.Contiguous().Data, t2.Contiguous().Data)
 }
 
-func MatMul(left, right *Tensor) *Tensor {
-	assert.LessThanOrEqual(left.Dims(), 2, "Element is not a matrix")
-	assert.LessThanOrEqual(right.Dims(), 2, "Element is not a matrix")
-	assert.Equal(left.Cols(), right.Rows(), "Matrix dimensions do not match")
-
-	outRows := left.Rows()
-	outCols := right.Cols()
-	sumLen := left.Cols()
-
-	out := New(outRows, outCols)
-	for row := range outRows {
-		for col := range outCols {
-			val := 0.0
-			for i := range sumLen {
-				val += left.At(row, i) * right.At(i, col)
-			}
-			out.Set(val, row, col)
-		}
-	}
-
-	return out
-}
-
-// The receiver is modified
+// The receiver is modified, t2 is broadcast to its shape.
 func (t1 *Tensor) AddInPlace(t2 *Tensor) *Tensor {
-	assert.True(EqDims(t1, t2), "Tensors do not have the same shape")
-
-	for i := range t1.Data {
-		t1.Data[i] += t2.Data[i]
-	}
-
-	return t1
+	return zipWithInPlace(t1, t2, func(a, b float64) float64 { return a + b })
 }
 
 func Add(t1, t2 *Tensor) *Tensor {
-	assert.True(EqDims(t1, t2), "Tensors do not have the same shape")
-
-	new := t1.Copy()
-	for i := range new.Data {
-		new.Data[i] += t2.Data[i]
-	}
-
-	return new
+	return zipWith(t1, t2, func(a, b float64) float64 { return a + b })
 }
 
-// The receiver is modified
+// The receiver is modified, t2 is broadcast to its shape.
 func (t1 *Tensor) SubInPlace(t2 *Tensor) *Tensor {
-	assert.True(EqDims(t1, t2), "Tensors do not have the same shape")
-
-	for i := range t1.Data {
-		t1.Data[i] -= t2.Data[i]
-	}
-
-	return t1
+	return zipWithInPlace(t1, t2, func(a, b float64) float64 { return a - b })
 }
 
 func Sub(t1, t2 *Tensor) *Tensor {
-	assert.True(EqDims(t1, t2), "Tensors do not have the same shape")
-
-	new := t1.Copy()
-	for i := range new.Data {
-		new.Data[i] -= t2.Data[i]
-	}
-
-	return new
+	return zipWith(t1, t2, func(a, b float64) float64 { return a - b })
 }
 
 func ElementMult(t1, t2 *Tensor) *Tensor {
-	assert.True(EqDims(t1, t2), "Tensors do not have the same shape")
-
-	new := t1.Copy()
-	for i := range new.Data {
-		new.Data[i] *= t2.Data[i]
-	}
-
-	return new
+	return zipWith(t1, t2, func(a, b float64) float64 { return a * b })
 }
 
 // Applies a function to each element of the tensor.
@@ -232,6 +192,11 @@ func ScalarMult(t *Tensor, v float64) *Tensor {
 }
 
 func (t *Tensor) ScaleInPlace(v float64) *Tensor {
+	if !t.IsContiguous() {
+		t.forEachOffset(func(offset int32) { t.Data[offset] *= v })
+		return t
+	}
+
 	for i := range t.Data {
 		t.Data[i] *= v
 	}
@@ -240,6 +205,7 @@ func (t *Tensor) ScaleInPlace(v float64) *Tensor {
 
 func (t *Tensor) ColVectorNorm1() float64 {
 	assert.Equal(t.Cols(), 1, "Not a column vector")
+	t = t.Contiguous()
 
 	sum := 0.0
 	for _, v := range t.Data {
@@ -250,6 +216,7 @@ func (t *Tensor) ColVectorNorm1() float64 {
 
 func (t *Tensor) ColVectorNorm2() float64 {
 	assert.Equal(t.Cols(), 1, "Not a column vector")
+	t = t.Contiguous()
 
 	sum := 0.0
 	for _, v := range t.Data {
@@ -258,17 +225,9 @@ func (t *Tensor) ColVectorNorm2() float64 {
 	return math.Sqrt(sum)
 }
 
+// MatTranspose returns a transposed copy, see Transpose for a view.
 func MatTranspose(t *Tensor) *Tensor {
-	assert.LessThanOrEqual(t.Dims(), 2, "Element is not a matrix")
-
-	new := New(t.Cols(), t.Rows())
-	for r := int32(0); r < t.Rows(); r++ {
-		for c := int32(0); c < t.Cols(); c++ {
-			new.Set(t.At(r, c), c, r)
-		}
-	}
-
-	return new
+	return t.Transpose().Copy()
 }
 
 func (t *Tensor) MatrixNormInf() float64 {
@@ -289,11 +248,11 @@ func (t *Tensor) MatrixNormInf() float64 {
 }
 
 func (t *Tensor) Contains(v float64) bool {
-	return slices.Contains(t.Data, v)
+	return slices.Contains(t.Contiguous().Data, v)
 }
 
 func (t *Tensor) Any(f func(v float64) bool) bool {
-	return slices.ContainsFunc(t.Data, f)
+	return slices.ContainsFunc(t.Contiguous().Data, f)
 }
 
 func (t *Tensor) IsFinite() bool {
@@ -304,6 +263,7 @@ func (t *Tensor) IsFinite() bool {
 // Serialization functions
 func (t *Tensor) Save(w io.Writer) error {
 	// We just need to save the data and shapes, strides is computed on creation.
+	t = t.Contiguous()
 
 	// Shape
 	dims := int32(len(t.Shape)) // Cast to keep standard sizes
@@ -330,6 +290,26 @@ func (t *Tensor) Save(w io.Writer) error {
 	return nil
 }
 
+// Limits on what Load accepts, anything bigger is taken as a corrupted
+// file. They can be raised to load bigger tensors.
+var (
+	MaxLoadDims int32 = 32
+	MaxLoadSize int32 = 1 << 27 // Elements, 1 GiB of data
+)
+
+// LoadError is returned by Load when the data doesn't describe a tensor.
+type LoadError struct {
+	Reason string
+}
+
+func (e *LoadError) Error() string {
+	return "Invalid saved tensor: " + e.Reason
+}
+
+// Data is read in chunks of this many elements, so a truncated stream fails
+// before allocating the whole size it claims.
+const loadChunkSize = 1 << 14
+
 func Load(r io.Reader) (*Tensor, error) {
 	// Read dims
 	var dims int32
@@ -337,26 +317,59 @@ func Load(r io.Reader) (*Tensor, error) {
 	if err != nil {
 		return nil, err
 	}
+	if dims < 0 || dims > MaxLoadDims {
+		return nil, &LoadError{fmt.Sprint("invalid number of dimensions ", dims)}
+	}
 	shape := make([]int32, dims)
 	err = binary.Read(r, binary.LittleEndian, shape)
 	if err != nil {
-		return nil, err
+		return nil, unexpectedEOF(err)
+	}
+
+	size := int32(1)
+	for _, dim := range shape {
+		if dim < 0 {
+			return nil, &LoadError{fmt.Sprint("negative dimension in shape ", shape)}
+		}
+		// Checked before multiplying so it can't overflow.
+		if dim > 0 && size > MaxLoadSize/dim {
+			return nil, &LoadError{fmt.Sprint("shape ", shape, " is too big")}
+		}
+		size *= dim
 	}
 
 	var dataSize int32
 	err = binary.Read(r, binary.LittleEndian, &dataSize)
 	if err != nil {
-		return nil, err
+		return nil, unexpectedEOF(err)
 	}
-	data := make([]float64, dataSize)
-	err = binary.Read(r, binary.LittleEndian, data)
-	if err != nil {
-		return nil, err
+	if dataSize != size {
+		return nil, &LoadError{fmt.Sprint("shape ", shape, " needs ", size, " elements, found ", dataSize)}
+	}
+
+	data := make([]float64, 0, min(size, loadChunkSize))
+	chunk := make([]float64, min(size, loadChunkSize))
+	for int32(len(data)) < size {
+		n := min(size-int32(len(data)), loadChunkSize)
+		err = binary.Read(r, binary.LittleEndian, chunk[:n])
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		data = append(data, chunk[:n]...)
 	}
 
 	return WithData(shape, data), nil
 }
 
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, for reads after the
+// first one.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 func isInf(v float64) bool {
 	return math.IsInf(v, 0)
 }
@@ -419,9 +432,7 @@ func (t *Tensor) getDataIndex(indices []int32) int32 {
 		}
 
 		// Just in case, check there are no extra non-0 indices
-		for i := t.Dims(); i < len(indices); i++ {
-			assert.Equal(0, indices[i], "Index out of bounds")
-		}
+		assertExtraIndicesZero(indices, t.Dims())
 
 		return dataIndex
 	}
@@ -438,6 +449,7 @@ func (t *Tensor) getDataIndex2D(indices []int32) int32 {
 
 	j := indices[1]
 	assert.True(j >= 0 && j < t.Shape[1], "Index out of bounds")
+	assertExtraIndicesZero(indices, 2)
 
 	return i*t.strides[0] + j*t.strides[1]
 }
@@ -445,5 +457,14 @@ func (t *Tensor) getDataIndex2D(indices []int32) int32 {
 func (t *Tensor) getDataIndex1D(indices []int32) int32 {
 	i := indices[0]
 	assert.True(i >= 0 && i < t.Shape[0], "Index out of bounds")
-	return i
+	assertExtraIndicesZero(indices, 1)
+	return i * t.strides[0]
+}
+
+// assertExtraIndicesZero checks indices past the tensor's dimensions, which
+// are only valid as 0.
+func assertExtraIndicesZero(indices []int32, dims int) {
+	for i := dims; i < len(indices); i++ {
+		assert.Equal(indices[i], 0, "Index out of bounds")
+	}
 }
@@ -1,6 +1,10 @@
 package tensor
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
 	"reflect"
 	"testing"
 )
@@ -197,3 +201,87 @@ func TestEq(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveLoad(t *testing.T) {
+	tensors := []*Tensor{
+		Scalar(3),
+		ColumnVector(1, 2, 3),
+		WithData([]int32{2, 3}, []float64{1, 2, 3, 4, 5, 6}),
+		New(2, 0, 3),
+		New(3, 200, 100), // Bigger than a chunk
+	}
+	for _, tensor := range tensors {
+		var buf bytes.Buffer
+		if err := tensor.Save(&buf); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		loaded, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(loaded.Shape, tensor.Shape) || !Eq(loaded, tensor) {
+			t.Errorf("Load() = %v %v, want %v %v", loaded.Shape, loaded.Data, tensor.Shape, tensor.Data)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	// Writes the int32 header fields followed by n float64s.
+	encode := func(n int, fields ...int32) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, fields)
+		binary.Write(&buf, binary.LittleEndian, make([]float64, n))
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"negative dims", encode(0, -1), &LoadError{}},
+		{"too many dims", encode(0, 1000), &LoadError{}},
+		{"negative dimension", encode(0, 2, 3, -3, 9), &LoadError{}},
+		{"too big", encode(0, 2, 1<<20, 1<<20, 0), &LoadError{}},
+		{"size doesn't match shape", encode(5, 2, 2, 3, 5), &LoadError{}},
+		{"huge size without data", encode(0, 1, 1<<26, 1<<26), io.ErrUnexpectedEOF},
+		{"truncated data", encode(5, 2, 2, 3, 6), io.ErrUnexpectedEOF},
+		{"truncated shape", encode(0, 3, 1), io.ErrUnexpectedEOF},
+		{"empty", nil, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(bytes.NewReader(tt.data))
+			var loadErr *LoadError
+			if _, typed := tt.wantErr.(*LoadError); typed && !errors.As(err, &loadErr) {
+				t.Errorf("Load() error = %v, want a LoadError", err)
+			}
+			if _, typed := tt.wantErr.(*LoadError); !typed && err != tt.wantErr {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func FuzzLoad(f *testing.F) {
+	for _, tensor := range []*Tensor{Scalar(1), ColumnVector(1, 2), New(2, 3, 4)} {
+		var buf bytes.Buffer
+		tensor.Save(&buf)
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tensor, err := Load(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Anything loaded must be a valid tensor.
+		var buf bytes.Buffer
+		if err := tensor.Save(&buf); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if !bytes.HasPrefix(data, buf.Bytes()) {
+			t.Errorf("Save() = %v, want the loaded bytes %v", buf.Bytes(), data)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package tensor
+
+import (
+	"slices"
+
+	"github.com/ManuelGarciaF/neural-networks/assert"
+)
+
+/* Views share their Data with the tensor they come from, so modifying one
+   modifies the other. A view's Data starts at its first element (the offset
+   into the original Data), and its strides may not be the ones New would
+   compute, in which case the tensor isn't contiguous: Data may contain
+   elements that aren't part of the view, in any order. Operations that
+   work on Data directly call Contiguous first.
+*/
+
+// Size returns the number of elements in the tensor.
+func (t *Tensor) Size() int32 {
+	size := int32(1)
+	for _, dim := range t.Shape {
+		size *= dim
+	}
+	return size
+}
+
+// IsContiguous reports whether Data holds exactly the elements of the tensor
+// in row-major order.
+func (t *Tensor) IsContiguous() bool {
+	if int32(len(t.Data)) != t.Size() {
+		return false
+	}
+	stride := int32(1)
+	for d := t.Dims() - 1; d >= 0; d-- {
+		if t.Shape[d] != 1 && t.strides[d] != stride {
+			return false
+		}
+		stride *= t.Shape[d]
+	}
+	return true
+}
+
+// Contiguous returns the tensor itself if it's contiguous, or a contiguous
+// copy of it otherwise.
+func (t *Tensor) Contiguous() *Tensor {
+	if t.IsContiguous() {
+		return t
+	}
+	return t.Copy()
+}
+
+// Reshape returns a view with the same elements in a different shape. One
+// of the dimensions can be -1, in which case it's inferred from the rest.
+// Non-contiguous tensors are copied first.
+func (t *Tensor) Reshape(shape ...int32) *Tensor {
+	shape = slices.Clone(shape)
+	inferred := -1
+	size := int32(1)
+	for i, dim := range shape {
+		if dim == -1 {
+			assert.Equal(inferred, -1, "Only one dimension can be inferred")
+			inferred = i
+			continue
+		}
+		assert.GreaterThanOrEqual(dim, 0, "Invalid dimension size")
+		size *= dim
+	}
+	if inferred != -1 {
+		assert.True(size != 0 && t.Size()%size == 0, "Can't infer the dimension's size")
+		shape[inferred] = t.Size() / size
+		size *= shape[inferred]
+	}
+	assert.Equal(size, t.Size(), "The new shape must have the same number of elements")
+
+	return &Tensor{
+		Data:    t.Contiguous().Data,
+		Shape:   shape,
+		strides: contiguousStrides(shape),
+	}
+}
+
+// Slice returns a view of the elements with indices in [start, end) along
+// the given dimension.
+func (t *Tensor) Slice(dim int, start, end int32) *Tensor {
+	assert.True(dim >= 0 && dim < t.Dims(), "Invalid dimension")
+	assert.True(start >= 0 && start <= end && end <= t.Shape[dim], "Slice out of bounds")
+
+	shape := slices.Clone(t.Shape)
+	shape[dim] = end - start
+	if start == end { // Start might point past the end of Data
+		return newView(nil, shape, slices.Clone(t.strides))
+	}
+	return newView(t.Data[start*t.strides[dim]:], shape, slices.Clone(t.strides))
+}
+
+// Permute returns a view with the dimensions reordered, dimension i of the
+// view being dimension dims[i] of t.
+func (t *Tensor) Permute(dims ...int) *Tensor {
+	assert.Equal(len(dims), t.Dims(), "Must list every dimension")
+
+	shape := make([]int32, len(dims))
+	strides := make([]int32, len(dims))
+	seen := make([]bool, len(dims))
+	for i, d := range dims {
+		assert.True(d >= 0 && d < t.Dims() && !seen[d], "Invalid permutation")
+		seen[d] = true
+		shape[i] = t.Shape[d]
+		strides[i] = t.strides[d]
+	}
+	return newView(t.Data, shape, strides)
+}
+
+// Transpose returns a transposed view of a matrix (or vector).
+func (t *Tensor) Transpose() *Tensor {
+	assert.LessThanOrEqual(t.Dims(), 2, "Element is not a matrix")
+	if t.Dims() < 2 {
+		return t.Unsqueeze(t.Dims()).Permute(1, 0)
+	}
+	return t.Permute(1, 0)
+}
+
+// Squeeze returns a view without the given dimensions, which must have size
+// 1. Without arguments, every dimension of size 1 is removed.
+func (t *Tensor) Squeeze(dims ...int) *Tensor {
+	remove := make([]bool, t.Dims())
+	for _, d := range dims {
+		assert.True(d >= 0 && d < t.Dims(), "Invalid dimension")
+		assert.Equal(t.Shape[d], 1, "Only dimensions of size 1 can be squeezed")
+		remove[d] = true
+	}
+
+	var shape, strides []int32
+	for d := range t.Dims() {
+		if remove[d] || (len(dims) == 0 && t.Shape[d] == 1) {
+			continue
+		}
+		shape = append(shape, t.Shape[d])
+		strides = append(strides, t.strides[d])
+	}
+	return newView(t.Data, shape, strides)
+}
+
+// Unsqueeze returns a view with a new dimension of size 1 at position dim.
+func (t *Tensor) Unsqueeze(dim int) *Tensor {
+	assert.True(dim >= 0 && dim <= t.Dims(), "Invalid dimension")
+
+	// The stride of a dimension of size 1 is never used, but keep it
+	// consistent with the ones around it.
+	stride := int32(1)
+	if dim < t.Dims() {
+		stride = t.strides[dim] * t.Shape[dim]
+	}
+	shape := slices.Insert(slices.Clone(t.Shape), dim, 1)
+	strides := slices.Insert(slices.Clone(t.strides[:t.Dims()]), dim, stride)
+	return newView(t.Data, shape, strides)
+}
+
+// Row returns a (1 x cols) view of a matrix's row.
+func (t *Tensor) Row(i int32) *Tensor {
+	assert.Equal(t.Dims(), 2, "Element is not a matrix")
+	return t.Slice(0, i, i+1)
+}
+
+// Col returns a (rows x 1) view of a matrix's column.
+func (t *Tensor) Col(j int32) *Tensor {
+	assert.Equal(t.Dims(), 2, "Element is not a matrix")
+	return t.Slice(1, j, j+1)
+}
+
+// newView trims data to the elements reachable with the given shape and
+// strides.
+func newView(data []float64, shape, strides []int32) *Tensor {
+	span := int32(1)
+	for d, dim := range shape {
+		if dim == 0 {
+			span = 0
+			break
+		}
+		span += (dim - 1) * strides[d]
+	}
+	if len(shape) == 0 {
+		strides = []int32{1}
+	}
+	return &Tensor{Data: data[:span], Shape: shape, strides: strides}
+}
+
+// forEachOffset calls f with the index into Data of every element, in
+// row-major order.
+func (t *Tensor) forEachOffset(f func(offset int32)) {
+	if t.Size() == 0 {
+		return
+	}
+
+	index := make([]int32, t.Dims())
+	offset := int32(0)
+	for range t.Size() {
+		f(offset)
+
+		for d := t.Dims() - 1; d >= 0; d-- {
+			index[d]++
+			offset += t.strides[d]
+			if index[d] < t.Shape[d] {
+				break
+			}
+			offset -= t.strides[d] * t.Shape[d]
+			index[d] = 0
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package tensor
+
+import (
+	"testing"
+)
+
+func TestViews(t *testing.T) {
+	// 2x3 matrix: [[0 1 2] [3 4 5]]
+	m := WithData([]int32{2, 3}, []float64{0, 1, 2, 3, 4, 5})
+
+	tests := []struct {
+		name           string
+		view           *Tensor
+		want           *Tensor
+		wantContiguous bool
+	}{
+		{"Reshape", m.Reshape(3, 2), WithData([]int32{3, 2}, []float64{0, 1, 2, 3, 4, 5}), true},
+		{"Reshape inferred", m.Reshape(-1), WithData([]int32{6}, []float64{0, 1, 2, 3, 4, 5}), true},
+		{"Slice rows", m.Slice(0, 1, 2), WithData([]int32{1, 3}, []float64{3, 4, 5}), true},
+		{"Slice cols", m.Slice(1, 1, 3), WithData([]int32{2, 2}, []float64{1, 2, 4, 5}), false},
+		{"Transpose", m.Transpose(), WithData([]int32{3, 2}, []float64{0, 3, 1, 4, 2, 5}), false},
+		{"Row", m.Row(1), RowVector(3, 4, 5), true},
+		{"Col", m.Col(2), ColumnVector(2, 5), false},
+		{"Unsqueeze", m.Unsqueeze(0), WithData([]int32{1, 2, 3}, []float64{0, 1, 2, 3, 4, 5}), true},
+		{"Squeeze", m.Row(0).Squeeze(), WithData([]int32{3}, []float64{0, 1, 2}), true},
+		{"Slice of transpose", m.Transpose().Slice(0, 1, 3), WithData([]int32{2, 2}, []float64{1, 4, 2, 5}), false},
+		{
+			"Permute 3D",
+			WithData([]int32{2, 2, 2}, []float64{0, 1, 2, 3, 4, 5, 6, 7}).Permute(2, 0, 1),
+			WithData([]int32{2, 2, 2}, []float64{0, 2, 4, 6, 1, 3, 5, 7}),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !Eq(tt.view, tt.want) {
+				t.Errorf("view = %v, want %v", tt.view.Copy().Data, tt.want.Data)
+			}
+			for i := range tt.want.Shape {
+				if tt.view.Dim(i) != tt.want.Dim(i) {
+					t.Errorf("view shape = %v, want %v", tt.view.Shape, tt.want.Shape)
+				}
+			}
+			if got := tt.view.IsContiguous(); got != tt.wantContiguous {
+				t.Errorf("IsContiguous() = %v, want %v", got, tt.wantContiguous)
+			}
+		})
+	}
+}
+
+func TestViewsShareData(t *testing.T) {
+	m := WithData([]int32{2, 3}, []float64{0, 1, 2, 3, 4, 5})
+
+	m.Col(1).ScaleInPlace(10)
+	m.Transpose().Set(-1, 2, 0)
+	m.Slice(1, 0, 1).AddInPlace(ColumnVector(100, 100))
+
+	want := WithData([]int32{2, 3}, []float64{100, 10, -1, 103, 40, 5})
+	if !Eq(m, want) {
+		t.Errorf("after modifying views, m = %v, want %v", m.Data, want.Data)
+	}
+}
+
+func TestContiguous(t *testing.T) {
+	m := WithData([]int32{2, 3}, []float64{0, 1, 2, 3, 4, 5})
+	if m.Contiguous() != m {
+		t.Errorf("Contiguous() copied a contiguous tensor")
+	}
+
+	c := m.Transpose().Contiguous()
+	if !c.IsContiguous() || len(c.Data) != 6 {
+		t.Errorf("Contiguous() = %v, not contiguous", c.Data)
+	}
+	c.Data[0] = 42
+	if m.Data[0] == 42 {
+		t.Errorf("Contiguous() of a view shares its data")
+	}
+}